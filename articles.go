@@ -0,0 +1,87 @@
+package goafweb
+
+import (
+	"context"
+	"fmt"
+)
+
+type articleService struct {
+	articleDB ArticleDB
+	roleDB    RoleDB
+}
+
+// NewArticleService returns an articleService that implements the ArticleService interface.
+// The RoleDB is used to look up the permissions of the User making changes.
+func NewArticleService(articleDB ArticleDB, roleDB RoleDB) *articleService {
+	return &articleService{
+		articleDB: articleDB,
+		roleDB:    roleDB,
+	}
+}
+
+// GetByID retreives a single Article, anyone can view an Article.
+func (as *articleService) GetByID(ctx context.Context, id int) (*Article, error) {
+	return as.articleDB.GetByID(ctx, id)
+}
+
+// List retreives a page of Articles, anyone can view Articles.
+func (as *articleService) List(ctx context.Context, query *ArticleQuery) (*ArticleList, error) {
+	return as.articleDB.List(ctx, query)
+}
+
+// Create stores a new Article written by user.
+// The user must have permission to publish Articles.
+func (as *articleService) Create(ctx context.Context, user *User, article *Article) error {
+	if err := as.authorize(ctx, user, nil, PermArticlePublish); err != nil {
+		return err
+	}
+	article.Author = user.ID
+	return as.articleDB.Create(ctx, article)
+}
+
+// Update stores changes to an existing Article if user is allowed to modify it.
+// The author and creation date of an Article can not be changed.
+func (as *articleService) Update(ctx context.Context, user *User, article *Article) error {
+	existing, err := as.articleDB.GetByID(ctx, article.ID)
+	if err != nil {
+		return err
+	}
+	if err := as.authorize(ctx, user, existing, PermArticleEditAny); err != nil {
+		return err
+	}
+	article.Author = existing.Author
+	article.CreatedAt = existing.CreatedAt
+	return as.articleDB.Update(ctx, article)
+}
+
+// Delete removes an existing Article if user is allowed to modify it.
+func (as *articleService) Delete(ctx context.Context, user *User, id int) error {
+	existing, err := as.articleDB.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := as.authorize(ctx, user, existing, PermArticleDeleteAny); err != nil {
+		return err
+	}
+	return as.articleDB.Delete(ctx, id)
+}
+
+// authorize checks user is allowed to act on article.
+// The author of an Article can always modify it, anyone else needs perm.
+// Returns ErrForbidden if they are not allowed.
+func (as *articleService) authorize(ctx context.Context, user *User, article *Article, perm string) error {
+	if user == nil {
+		return ErrForbidden
+	}
+	if article != nil && user.ID == article.Author {
+		return nil
+	}
+	roles, err := as.roleDB.ByUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("Could not retreive roles: %w", err)
+	}
+	if !PermissionsFor(roles).Has(perm) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type mockArticleDB struct {
+	articles []*Article
+}
+
+func (m *mockArticleDB) GetByID(ctx context.Context, id int) (*Article, error) {
+	for _, article := range m.articles {
+		if article.ID == id {
+			return article, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+func (m *mockArticleDB) List(ctx context.Context, query *ArticleQuery) (*ArticleList, error) {
+	return &ArticleList{Articles: m.articles, Total: len(m.articles)}, nil
+}
+func (m *mockArticleDB) Create(ctx context.Context, article *Article) error {
+	m.articles = append(m.articles, article)
+	return nil
+}
+func (*mockArticleDB) Update(ctx context.Context, article *Article) error {
+	return nil
+}
+func (*mockArticleDB) Delete(ctx context.Context, id int) error {
+	return nil
+}
+
+type mockRoleDB map[int][]string
+
+func (m mockRoleDB) ByUser(ctx context.Context, userID int) ([]string, error) {
+	return m[userID], nil
+}
+func (m mockRoleDB) Grant(ctx context.Context, userID int, role string) error {
+	m[userID] = append(m[userID], role)
+	return nil
+}
+func (mockRoleDB) Revoke(ctx context.Context, userID int, role string) error {
+	return nil
+}
+
+func TestArticleAuthorization(t *testing.T) {
+	ctx := context.Background()
+	mockDB := &mockArticleDB{}
+	roleDB := mockRoleDB{}
+	roleDB.Grant(ctx, 2, RoleEditor)
+	roleDB.Grant(ctx, 3, RoleAdmin)
+	roleDB.Grant(ctx, 4, RoleCustomer)
+	as := NewArticleService(mockDB, roleDB)
+	mockDB.Create(ctx, &Article{ID: 1, Title: "title", Content: "content", Author: 1})
+
+	tests := map[string]struct {
+		want error
+		user *User
+		id   int
+	}{
+		"Author":     {want: nil, user: &User{ID: 1}, id: 1},
+		"Editor":     {want: nil, user: &User{ID: 2}, id: 1},
+		"Admin":      {want: nil, user: &User{ID: 3}, id: 1},
+		"Customer":   {want: ErrForbidden, user: &User{ID: 4}, id: 1},
+		"No roles":   {want: ErrForbidden, user: &User{ID: 5}, id: 1},
+		"No user":    {want: ErrForbidden, user: nil, id: 1},
+		"Unknown ID": {want: ErrNotFound, user: &User{ID: 1}, id: 2},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := as.Update(ctx, tc.user, &Article{ID: tc.id, Title: "new title", Author: 5})
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Update: got %v, wanted %v", err, tc.want)
+			}
+			if err := as.Delete(ctx, tc.user, tc.id); !errors.Is(err, tc.want) {
+				t.Errorf("Delete: got %v, wanted %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goafweb/storage"
+	"strconv"
+	"time"
+)
+
+// command is a subcommand that can be run from the command line instead of starting the server.
+type command func(services *Services, args []string) error
+
+var commands = map[string]command{
+	"role":    roleCmd,
+	"keys":    keysCmd,
+	"migrate": migrateCmd,
+}
+
+// runCommand runs the subcommand named by the first argument.
+func runCommand(services *Services, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown command %q", args[0])
+	}
+	return cmd(services, args[1:])
+}
+
+// roleCmd grants or revokes a role from the command line.
+// This is how the first admin is created, as only an admin can grant roles through the api.
+// usage: role grant|revoke <email> <role>
+func roleCmd(services *Services, args []string) error {
+	if len(args) != 3 {
+		return errors.New("usage: role grant|revoke <email> <role>")
+	}
+	ctx := context.Background()
+	user, err := services.UserService.GetByEmail(ctx, args[1])
+	if err != nil {
+		return fmt.Errorf("Could not find user: %w", err)
+	}
+	switch args[0] {
+	case "grant":
+		err = services.UserService.GrantRole(ctx, user.ID, args[2])
+	case "revoke":
+		err = services.UserService.RevokeRole(ctx, user.ID, args[2])
+	default:
+		return fmt.Errorf("Unknown role action %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s: %s\n", args[0], args[2], user.Email)
+	return nil
+}
+
+// keysCmd reports how many stored hashes were made with a retired pepper or HMAC key.
+// A retired key can be removed from the config once nothing uses it. Passwords are rehashed
+// when their user next logs in, sessions when next used, other tokens expire.
+// usage: keys status
+func keysCmd(services *Services, args []string) error {
+	if len(args) != 1 || args[0] != "status" {
+		return errors.New("usage: keys status")
+	}
+	hashes := []struct {
+		table, column, current string
+	}{
+		{"users", "password_hash", services.peppers.Current},
+		{"sessions", "token_hash", services.hmacKeys.Current},
+		{"rotated_tokens", "token_hash", services.hmacKeys.Current},
+		{"email_verifications", "token_hash", services.hmacKeys.Current},
+		{"pw_resets", "token_hash", services.hmacKeys.Current},
+		{"recovery_codes", "code_hash", services.hmacKeys.Current},
+	}
+	if services.gorm == nil {
+		return errNoDatabase
+	}
+	kdb := storage.NewKeyUsageDB(services.gorm)
+	fmt.Printf("current pepper: %s, current hmac key: %s\n", services.peppers.Current, services.hmacKeys.Current)
+	for _, h := range hashes {
+		old, total, err := kdb.Count(h.table, h.column, h.current)
+		if err != nil {
+			return fmt.Errorf("Could not count %s: %w", h.table, err)
+		}
+		fmt.Printf("%s.%s: %d of %d use old keys\n", h.table, h.column, old, total)
+	}
+	return nil
+}
+
+// migrateCmd applies or rolls back database migrations, or lists them with when they were applied.
+// down rolls back the last migration, or the last n.
+// usage: migrate up|down [n]|status
+func migrateCmd(services *Services, args []string) error {
+	usage := errors.New("usage: migrate up|down [n]|status")
+	if len(args) == 0 {
+		return usage
+	}
+	migrator, err := services.Migrator()
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		done, err := migrator.Up()
+		for _, id := range done {
+			fmt.Printf("applied %s\n", id)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case args[0] == "down" && len(args) <= 2:
+		n := 1
+		if len(args) == 2 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return usage
+			}
+		}
+		done, err := migrator.Down(n)
+		for _, id := range done {
+			fmt.Printf("rolled back %s\n", id)
+		}
+		return err
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s: %s\n", s.ID, applied)
+		}
+		return nil
+	default:
+		return usage
+	}
+}
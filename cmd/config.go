@@ -1,30 +1,57 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"goafweb"
+	"goafweb/hash"
+	"goafweb/mail"
+	"goafweb/password"
 	"log"
 	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	Port     int           `json:"port"`     // Port to run app on
-	Env      string        `json:"env"`      // Environment i.e. production/development
-	PWPepper string        `json:"pwPepper"` // For passwords
-	HMACKey  string        `json:"hmacKey"`  // For hashing rememberTokens
-	Database dbConfig      `json:"database"` // Database information
-	Mailgun  mailgunConfig `json:"mailgun"`  // Mailgun config
-	Paypal   paypalConfig  `json:"paypal"`   // Paypal integration config
+	Port      int            `json:"port"`      // Port to run app on
+	Env       string         `json:"env"`       // Environment i.e. production/development
+	PWPepper  string         `json:"pwPepper"`  // For passwords hashed before PWPeppers
+	PWPeppers keyringConfig  `json:"pwPeppers"` // For passwords
+	PWHash    pwHashConfig   `json:"pwHash"`    // How passwords are hashed
+	PWPolicy  pwPolicyConfig `json:"pwPolicy"`  // How strong new passwords must be
+	PWReset   pwResetConfig  `json:"pwReset"`   // Password reset tokens
+	HMACKey   string         `json:"hmacKey"`   // For tokens hashed before HMACKeys
+	HMACKeys  keyringConfig  `json:"hmacKeys"`  // For hashing session and reset tokens
+	TokenKeys keyringConfig  `json:"tokenKeys"` // For signing access tokens, derived from HMACKeys if not set
+	TOTP      totpConfig     `json:"totp"`      // Two factor authentication, disabled without a key
+	Lockout   lockoutConfig  `json:"lockout"`   // Brute force protection
+	Database  dbConfig       `json:"database"`  // Database information
+	Mail      mailConfig     `json:"mail"`      // How emails are sent
+	Mailgun   mailgunConfig  `json:"mailgun"`   // Mailgun config
+	Paypal    paypalConfig   `json:"paypal"`    // Paypal integration config
 }
 
 // Config values by default if user does not provide a config file
 func defaultConfig() Config {
 	return Config{
-		Port:     3000,                   // standard for localhost
-		Env:      "dev",                  // default to development
-		PWPepper: "secret-random-string", // random dev assignment
-		HMACKey:  "secret-hmac-key",      // random dev assignment
-		Database: defaultDBConfig(),      // Defaults to dev database
+		Port:      3000,                           // standard for localhost
+		Env:       "dev",                          // default to development
+		PWPepper:  "secret-random-string",         // random dev assignment
+		PWHash:    defaultPWHashConfig(),          // Argon2id
+		PWPolicy:  defaultPWPolicyConfig(),        // No breached password list
+		PWReset:   defaultPWResetConfig(),         // 12 hour tokens, purged hourly
+		HMACKey:   "secret-hmac-key",              // random dev assignment
+		TokenKeys: devKeyring("secret-token-key"), // random dev assignment
+		TOTP:      defaultTOTPConfig(),            // random dev assignment
+		Lockout:   defaultLockoutConfig(),         // sensible defaults
+		Database:  defaultDBConfig(),              // Defaults to dev database
+		Mail:      defaultMailConfig(),            // Written to ./maildir
 	}
 }
 
@@ -58,10 +85,359 @@ func (c Config) isProd() bool {
 	return c.Env == "prod"
 }
 
+// Keyring configuration
+// Current is the ID of the key used for new values, Keys holds every key by ID.
+// When rotating, add the new key and set it as current, but keep the old key
+// until anything it produced has expired.
+type keyringConfig struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// Returns the keyring with the key used before keyrings were supported added as hash.LegacyKeyID.
+// Hashes without a key ID were made with it. If no current key is set the legacy key stays current,
+// so existing config files keep working unchanged.
+func (kc keyringConfig) withLegacy(legacy string) keyringConfig {
+	keys := make(map[string]string, len(kc.Keys)+1)
+	for id, key := range kc.Keys {
+		keys[id] = key
+	}
+	if legacy != "" {
+		keys[hash.LegacyKeyID] = legacy
+	}
+	current := kc.Current
+	if current == "" {
+		current = hash.LegacyKeyID
+	}
+	return keyringConfig{Current: current, Keys: keys}
+}
+
+// Returns the keyring, or if it has no keys a keyring holding one key derived from the current key of from.
+// Config files written before the keyring was added keep working unchanged, but the derived key changes
+// when from is rotated, so name must be added to the config file before then.
+func (kc keyringConfig) orDerived(from keyringConfig, name string) keyringConfig {
+	secret := from.Keys[from.Current]
+	if len(kc.Keys) > 0 || secret == "" {
+		return kc
+	}
+	log.Printf("No %s in config file, deriving them from the current HMAC key. Add %s before rotating hmacKeys.", name, name)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(name))
+	return keyringConfig{
+		Current: "derived",
+		Keys:    map[string]string{"derived": base64.RawURLEncoding.EncodeToString(mac.Sum(nil))},
+	}
+}
+
+// Keyring holding a single key, used in development
+func devKeyring(key string) keyringConfig {
+	return keyringConfig{
+		Current: "dev",
+		Keys:    map[string]string{"dev": key},
+	}
+}
+
+// Two factor authentication configuration
+// Issuer is shown next to the account in authenticator apps
+// Key encrypts TOTP secrets at rest, changing it disables two factor authentication for every user
+// Without a key two factor authentication can't be enabled
+type totpConfig struct {
+	Issuer string `json:"issuer"`
+	Key    string `json:"key"`
+}
+
+func defaultTOTPConfig() totpConfig {
+	return totpConfig{
+		Issuer: "goafweb",
+		Key:    "secret-totp-key",
+	}
+}
+
+// Password hashing configuration
+// Algorithm is "argon2id" or "bcrypt". Changing the algorithm or its cost only affects new hashes,
+// existing passwords are rehashed with the new settings the next time their user logs in.
+// Argon2 memory is in KiB.
+type pwHashConfig struct {
+	Algorithm         string `json:"algorithm"`
+	BcryptCost        int    `json:"bcryptCost"`
+	Argon2Memory      uint32 `json:"argon2Memory"`
+	Argon2Iterations  uint32 `json:"argon2Iterations"`
+	Argon2Parallelism uint8  `json:"argon2Parallelism"`
+}
+
+func defaultPWHashConfig() pwHashConfig {
+	params := hash.DefaultArgon2idParams()
+	return pwHashConfig{
+		Algorithm:         hash.AlgArgon2id,
+		BcryptCost:        bcrypt.DefaultCost,
+		Argon2Memory:      params.Memory,
+		Argon2Iterations:  params.Iterations,
+		Argon2Parallelism: params.Parallelism,
+	}
+}
+
+// Returns the PasswordHasher for the configured algorithm
+// Config files from before the setting existed keep using bcrypt at its default cost.
+func (hc pwHashConfig) hasher() (hash.PasswordHasher, error) {
+	switch hc.Algorithm {
+	case hash.AlgArgon2id:
+		params := hash.DefaultArgon2idParams()
+		params.Memory, params.Iterations, params.Parallelism = hc.Argon2Memory, hc.Argon2Iterations, hc.Argon2Parallelism
+		if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+			return hash.PasswordHasher{}, fmt.Errorf("Argon2 memory, iterations and parallelism must be set")
+		}
+		return hash.NewArgon2idHasher(params), nil
+	case hash.AlgBcrypt, "":
+		cost := hc.BcryptCost
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return hash.PasswordHasher{}, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return hash.NewBcryptHasher(cost), nil
+	default:
+		return hash.PasswordHasher{}, fmt.Errorf("Unsupported password hash algorithm %q", hc.Algorithm)
+	}
+}
+
+// Password policy configuration
+// New passwords need at least MinLength characters and MinEntropy bits of estimated entropy.
+// BreachedFile lists the SHA-1 hashes of breached passwords, one per line as in the Pwned Passwords
+// downloads, they are loaded into a bloom filter with a false positive rate of BreachedFPRate.
+// Leave BreachedFile empty to skip the check.
+type pwPolicyConfig struct {
+	MinLength      int     `json:"minLength"`
+	MinEntropy     float64 `json:"minEntropy"`
+	BreachedFile   string  `json:"breachedFile"`
+	BreachedFPRate float64 `json:"breachedFPRate"`
+}
+
+func defaultPWPolicyConfig() pwPolicyConfig {
+	policy := password.DefaultPolicy()
+	return pwPolicyConfig{
+		MinLength:      policy.MinLength,
+		MinEntropy:     policy.MinEntropy,
+		BreachedFPRate: 0.001,
+	}
+}
+
+// Returns the password.Policy, loading the breached password list if there is one
+// Config files from before the setting existed get the default policy.
+func (pc pwPolicyConfig) policy() (*password.Policy, error) {
+	policy := password.DefaultPolicy()
+	if pc.MinLength > 0 {
+		policy.MinLength = pc.MinLength
+	}
+	if pc.MinEntropy > 0 {
+		policy.MinEntropy = pc.MinEntropy
+	}
+	if pc.BreachedFile != "" {
+		rate := pc.BreachedFPRate
+		if rate <= 0 || rate >= 1 {
+			rate = defaultPWPolicyConfig().BreachedFPRate
+		}
+		breached, err := password.LoadBreached(pc.BreachedFile, rate)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// Password reset configuration
+// Reset tokens can be used for TTLMinutes, expired ones are deleted every PurgeIntervalMinutes.
+// Config files from before the setting existed get the defaults.
+type pwResetConfig struct {
+	TTLMinutes           int `json:"ttlMinutes"`
+	PurgeIntervalMinutes int `json:"purgeIntervalMinutes"`
+}
+
+func defaultPWResetConfig() pwResetConfig {
+	return pwResetConfig{
+		TTLMinutes:           12 * 60,
+		PurgeIntervalMinutes: 60,
+	}
+}
+
+// Returns how long a reset token can be used for
+func (rc pwResetConfig) ttl() time.Duration {
+	if rc.TTLMinutes <= 0 {
+		rc.TTLMinutes = defaultPWResetConfig().TTLMinutes
+	}
+	return time.Duration(rc.TTLMinutes) * time.Minute
+}
+
+// Returns how often expired reset tokens are purged
+func (rc pwResetConfig) purgeInterval() time.Duration {
+	if rc.PurgeIntervalMinutes <= 0 {
+		rc.PurgeIntervalMinutes = defaultPWResetConfig().PurgeIntervalMinutes
+	}
+	return time.Duration(rc.PurgeIntervalMinutes) * time.Minute
+}
+
+// Brute force protection configuration
+// Each failed login delays the next by BaseDelaySeconds, doubling up to MaxDelaySeconds.
+// After MaxFailures for an account, or IPMaxFailures from one IP address, it is locked for LockMinutes.
+// Failures are forgotten after WindowMinutes without one.
+// MaxResetRequests limits password reset emails per account or IP address in the same window.
+// Setting MaxFailures to 0 turns protection off.
+type lockoutConfig struct {
+	MaxFailures      int `json:"maxFailures"`
+	IPMaxFailures    int `json:"ipMaxFailures"`
+	BaseDelaySeconds int `json:"baseDelaySeconds"`
+	MaxDelaySeconds  int `json:"maxDelaySeconds"`
+	LockMinutes      int `json:"lockMinutes"`
+	WindowMinutes    int `json:"windowMinutes"`
+	MaxResetRequests int `json:"maxResetRequests"`
+}
+
+func defaultLockoutConfig() lockoutConfig {
+	return lockoutConfig{
+		MaxFailures:      10,
+		IPMaxFailures:    100,
+		BaseDelaySeconds: 1,
+		MaxDelaySeconds:  60,
+		LockMinutes:      15,
+		WindowMinutes:    15,
+		MaxResetRequests: 5,
+	}
+}
+
+// Returns the policy the UserService understands
+func (lc lockoutConfig) policy() goafweb.LockoutPolicy {
+	return goafweb.LockoutPolicy{
+		MaxFailures:      lc.MaxFailures,
+		IPMaxFailures:    lc.IPMaxFailures,
+		BaseDelay:        time.Duration(lc.BaseDelaySeconds) * time.Second,
+		MaxDelay:         time.Duration(lc.MaxDelaySeconds) * time.Second,
+		LockDuration:     time.Duration(lc.LockMinutes) * time.Minute,
+		Window:           time.Duration(lc.WindowMinutes) * time.Minute,
+		MaxResetRequests: lc.MaxResetRequests,
+	}
+}
+
+// Mail configuration
+// Backend is "mailgun", "smtp", "file" or "memory", config files from before it existed use mailgun.
+// file writes emails to Dir as a Maildir and memory keeps them until the server stops,
+// neither sends anything so they are for development and testing.
+// Emails are rendered from the templates in TemplateDir, branded with the sender and site.
+// BaseURL is where links in emails point. Any brand setting left out keeps its default.
+type mailConfig struct {
+	Backend       string     `json:"backend"`
+	Dir           string     `json:"dir"`
+	SMTP          smtpConfig `json:"smtp"`
+	TemplateDir   string     `json:"templateDir"`
+	SenderName    string     `json:"senderName"`
+	SenderAddress string     `json:"senderAddress"`
+	SiteName      string     `json:"siteName"`
+	BaseURL       string     `json:"baseURL"`
+	// Queue configures delivering emails from the outbox
+	Queue mailQueueConfig `json:"queue"`
+}
+
+func defaultMailConfig() mailConfig {
+	return mailConfig{
+		Backend:       "file",
+		Dir:           "maildir",
+		TemplateDir:   "mail/templates",
+		SenderName:    "Leanne",
+		SenderAddress: "support@leannesbowtique.com",
+		SiteName:      "Leanne's Bowtique",
+		BaseURL:       "https://leannesbowtique.com",
+	}
+}
+
+// Returns the email templates, with defaults for anything not set
+func (mc mailConfig) templates() (*mail.Templates, error) {
+	def := defaultMailConfig()
+	orDefault := func(v, d string) string {
+		if v == "" {
+			return d
+		}
+		return v
+	}
+	brand := mail.Brand{
+		SenderName:    orDefault(mc.SenderName, def.SenderName),
+		SenderAddress: orDefault(mc.SenderAddress, def.SenderAddress),
+		SiteName:      orDefault(mc.SiteName, def.SiteName),
+		BaseURL:       strings.TrimSuffix(orDefault(mc.BaseURL, def.BaseURL), "/"),
+	}
+	return mail.NewTemplates(orDefault(mc.TemplateDir, def.TemplateDir), brand)
+}
+
+// Returns the mail.Sender for the backend
+func (mc mailConfig) sender(mgcfg mailgunConfig) (mail.Sender, error) {
+	switch mc.Backend {
+	case "", "mailgun":
+		return mail.NewMailgunSender(mgcfg.Domain, mgcfg.APIKey), nil
+	case "smtp":
+		return mail.NewSMTPSender(mc.SMTP.config()), nil
+	case "file":
+		return mail.NewFileSender(mc.Dir)
+	case "memory":
+		return mail.NewRecorder(), nil
+	}
+	return nil, fmt.Errorf("Unknown mail backend %q", mc.Backend)
+}
+
+// Mail queue configuration
+// Failed emails are retried after BaseDelaySeconds, doubling each time up to MaxDelayMinutes,
+// until MaxAttempts have been made. Anything not set uses mail.DefaultQueueConfig.
+type mailQueueConfig struct {
+	Workers             int `json:"workers"`
+	PollIntervalSeconds int `json:"pollIntervalSeconds"`
+	MaxAttempts         int `json:"maxAttempts"`
+	BaseDelaySeconds    int `json:"baseDelaySeconds"`
+	MaxDelayMinutes     int `json:"maxDelayMinutes"`
+	SendTimeoutSeconds  int `json:"sendTimeoutSeconds"`
+}
+
+func (qc mailQueueConfig) config() mail.QueueConfig {
+	return mail.QueueConfig{
+		Workers:      qc.Workers,
+		PollInterval: time.Duration(qc.PollIntervalSeconds) * time.Second,
+		MaxAttempts:  qc.MaxAttempts,
+		BaseDelay:    time.Duration(qc.BaseDelaySeconds) * time.Second,
+		MaxDelay:     time.Duration(qc.MaxDelayMinutes) * time.Minute,
+		SendTimeout:  time.Duration(qc.SendTimeoutSeconds) * time.Second,
+	}
+}
+
+// SMTP configuration
+// ImplicitTLS is for servers expecting TLS from the start, usually port 465, otherwise STARTTLS is
+// used when the server offers it. RequireTLS refuses to send if it doesn't.
+type smtpConfig struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	ImplicitTLS bool   `json:"implicitTLS"`
+	RequireTLS  bool   `json:"requireTLS"`
+}
+
+func (sc smtpConfig) config() mail.SMTPConfig {
+	port := sc.Port
+	if port == 0 {
+		port = 587
+	}
+	return mail.SMTPConfig{
+		Host:        sc.Host,
+		Port:        port,
+		Username:    sc.Username,
+		Password:    sc.Password,
+		ImplicitTLS: sc.ImplicitTLS,
+		RequireTLS:  sc.RequireTLS,
+	}
+}
+
 type mailgunConfig struct {
 	Domain       string `json:"domain"`
 	APIKey       string `json:"api_key"`
 	PublicAPIKey string `json:"public_api_key"`
+	// WebhookSigningKey verifies the delivery events Mailgun posts to /api/webhooks/mailgun
+	WebhookSigningKey string `json:"webhook_signing_key"`
 }
 
 type paypalConfig struct {
@@ -71,6 +447,8 @@ type paypalConfig struct {
 
 // Database configuration
 // Not all fields will be used dependent on database dialect being used
+// Dialect is "mysql", "postgres", "sqlite3" or "memory", for sqlite3 DBName is the path to the database file
+// memory keeps everything in memory so the app can run without a database, nothing is persisted
 type dbConfig struct {
 	User    string `json:"user"`
 	Passwd  string `json:"passwd"`
@@ -79,21 +457,29 @@ type dbConfig struct {
 	Port    int    `json:"port"`
 	DBName  string `json:"dbName"`
 	Dialect string `json:"dialect"`
+	// QueryTimeoutSeconds limits how long the queries for one storage call may take, 0 for no limit
+	QueryTimeoutSeconds int `json:"queryTimeoutSeconds"`
 }
 
 // Database config to be used if one not provided by user
 func defaultDBConfig() dbConfig {
 	return dbConfig{
-		User:    "root",
-		Passwd:  "root",
-		Net:     "tcp",
-		Host:    "localhost",
-		Port:    3306,
-		DBName:  "goafweb",
-		Dialect: "mysql",
+		User:                "root",
+		Passwd:              "root",
+		Net:                 "tcp",
+		Host:                "localhost",
+		Port:                3306,
+		DBName:              "goafweb",
+		Dialect:             "mysql",
+		QueryTimeoutSeconds: 5,
 	}
 }
 
+// Returns the query timeout as a time.Duration
+func (dbcfg *dbConfig) queryTimeout() time.Duration {
+	return time.Duration(dbcfg.QueryTimeoutSeconds) * time.Second
+}
+
 // Returns a dsn string for the selected database dialect
 func (dbcfg *dbConfig) dsn() string {
 	switch dbcfg.Dialect {
@@ -103,6 +489,9 @@ func (dbcfg *dbConfig) dsn() string {
 	case "postgres":
 		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 			dbcfg.Host, dbcfg.Port, dbcfg.User, dbcfg.Passwd, dbcfg.DBName)
+	case "sqlite3":
+		// Wait for other writers rather than failing with "database is locked"
+		return fmt.Sprintf("%s?_busy_timeout=5000", dbcfg.DBName)
 	default:
 		log.Fatal("Database drivers not supported")
 		return ""
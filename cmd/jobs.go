@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"goafweb"
+	"log"
+	"time"
+)
+
+// purgePWResets deletes expired password reset tokens every interval, until ctx is done.
+// Failures are logged and tried again at the next interval.
+func purgePWResets(ctx context.Context, us goafweb.UserService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := us.PurgePWResets(ctx)
+		if err != nil {
+			log.Printf("Could not purge expired password resets: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d expired password resets", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
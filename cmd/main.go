@@ -4,6 +4,7 @@ Package main pieces together all the components of the app and runs the binary.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"goafweb/handlers"
@@ -11,7 +12,6 @@ import (
 	"log"
 	"net/http"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 )
 
@@ -23,24 +23,51 @@ func main() {
 	dbcfg := cfg.Database
 	mgcfg := cfg.Mailgun
 
+	// The memory dialect needs no database, everything is lost when the server stops.
+	var storageOpt serviceOpts
+	if dbcfg.Dialect == "memory" {
+		storageOpt = WithMemory()
+	} else {
+		storageOpt = WithGorm(dbcfg.Dialect, dbcfg.dsn(), cfg.isProd(), dbcfg.queryTimeout())
+	}
+	hmacKeys := cfg.HMACKeys.withLegacy(cfg.HMACKey)
 	services, err := NewServices(
-		WithGorm(dbcfg.Dialect, dbcfg.dsn(), cfg.isProd()),
-		WithUsers(cfg.PWPepper, cfg.HMACKey),
+		storageOpt,
+		WithMail(cfg.Mail, mgcfg),
+		WithUsers(cfg.PWPeppers.withLegacy(cfg.PWPepper), cfg.PWHash, cfg.PWPolicy, cfg.PWReset, hmacKeys, cfg.TokenKeys.orDerived(hmacKeys, "tokenKeys"), cfg.TOTP, cfg.Lockout),
 		WithArticles(),
-		WithMail(mgcfg.Domain, mgcfg.APIKey),
 	)
 	if err != nil {
 		log.Fatalf("Could not initiate app: %s", err)
 	}
-	if err := services.AutoMigrate(); err != nil {
-		log.Fatalf("Could not initiate database tables: %s", err)
+	if flag.NArg() > 0 {
+		if err := runCommand(services, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// Migrations are never run implicitly, so schema changes are a deliberate step of deploying.
+	if migrator, err := services.Migrator(); err == nil {
+		pending, err := migrator.Pending()
+		if err != nil {
+			log.Fatalf("Could not check database migrations: %s", err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("Database has %d pending migrations, run the migrate up command first", len(pending))
+		}
 	}
 
+	go services.MailQueue.Run(context.Background())
+	go purgePWResets(context.Background(), services.UserService, cfg.PWReset.purgeInterval())
+
 	router := mux.NewRouter().StrictSlash(true).PathPrefix("/api/").Subrouter()
+	router.Use(middleware.RequestInfo(!cfg.isProd()))
 	handlers.NewApp(
 		middleware.NewJsonAuthMW(services.UserService),
-		handlers.NewUsers(services.UserService, services.MailService),
+		handlers.NewUsers(services.UserService),
 		handlers.NewArticles(services.ArticleService),
+		handlers.NewMail(services.MailQueue, services.MailService),
+		handlers.NewWebhooks(services.Deliveries, mgcfg.WebhookSigningKey),
 		router,
 	)
 	server := &http.Server{Handler: router, Addr: fmt.Sprintf(":%d", cfg.Port)}
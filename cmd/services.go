@@ -2,21 +2,32 @@ package main
 
 // TODO: AUTOMIGRATE a root user into user table
 import (
+	"errors"
 	"fmt"
 	"goafweb"
+	"goafweb/encrypt"
 	"goafweb/hash"
 	"goafweb/mail"
 	"goafweb/storage"
+	"goafweb/storage/memory"
 	"goafweb/validation"
+	"log"
+	"time"
 
 	"github.com/jinzhu/gorm"
 )
 
 type Services struct {
 	gorm           *gorm.DB
+	memory         *memory.DB
+	roleDB         goafweb.RoleDB
+	peppers        hash.Keyring
+	hmacKeys       hash.Keyring
 	UserService    goafweb.UserService
 	ArticleService goafweb.ArticleService
 	MailService    goafweb.MailService
+	MailQueue      *mail.Queue
+	Deliveries     goafweb.DeliveryService
 }
 type serviceOpts func(*Services) error
 
@@ -32,28 +43,135 @@ func NewServices(opts ...serviceOpts) (*Services, error) {
 
 // Connect to database using GORM package
 // Used by other services
-func WithGorm(dialect, dsn string, prod bool) serviceOpts {
+// Each call to storage is cancelled after queryTimeout, zero for no limit
+func WithGorm(dialect, dsn string, prod bool, queryTimeout time.Duration) serviceOpts {
 	return func(services *Services) error {
-		db, err := gorm.Open(dialect, dsn)
+		// LogQueries should be off in production
+		db, err := storage.Open(dialect, dsn, storage.Options{LogQueries: !prod, QueryTimeout: queryTimeout})
 		if err != nil {
 			return fmt.Errorf("Could not establish a database connection: %w", err)
 		}
-		// LogMode should be off in production
-		db.LogMode(!prod)
 		services.gorm = db
 		return nil
 	}
 }
 
-// Loads user service, allows user functionality as defined by UserInterface//
-func WithUsers(userPwPepper, hmacSecretKey string) serviceOpts {
+// Keep everything in memory instead of a database
+// Nothing is persisted, it is for demos and trying the app out without any infrastructure
+func WithMemory() serviceOpts {
 	return func(services *Services) error {
-		hmac := hash.NewHMAC(hmacSecretKey)
-		udb := storage.NewUserDB(services.gorm)
-		uv := validation.NewUserValidator(udb, hmac, userPwPepper)
-		pwrdb := storage.NewPwResetDB(services.gorm)
-		pwrv := validation.NewPwResetValidator(pwrdb, hmac)
-		us := goafweb.NewUserService(uv, pwrv, userPwPepper)
+		services.memory = memory.NewDB()
+		return nil
+	}
+}
+
+// storageDBs are the storage implementations wrapped by the validators
+type storageDBs struct {
+	users         goafweb.UserDB
+	articles      goafweb.ArticleDB
+	pwResets      goafweb.PwResetDB
+	verifications goafweb.EmailVerificationDB
+	sessions      goafweb.SessionDB
+	roles         goafweb.RoleDB
+	recoveryCodes goafweb.RecoveryCodeDB
+	throttles     goafweb.ThrottleDB
+	outbox        goafweb.OutboxDB
+	deliveries    goafweb.DeliveryStatusDB
+	tx            goafweb.Transactor
+}
+
+// Returns the storage implementations for the memory store if WithMemory was used, otherwise for gorm
+func (s *Services) dbs() storageDBs {
+	if s.memory != nil {
+		return storageDBs{
+			users:         memory.NewUserDB(s.memory),
+			articles:      memory.NewArticleDB(s.memory),
+			pwResets:      memory.NewPwResetDB(s.memory),
+			verifications: memory.NewEmailVerificationDB(s.memory),
+			sessions:      memory.NewSessionDB(s.memory),
+			roles:         memory.NewRoleDB(s.memory),
+			recoveryCodes: memory.NewRecoveryCodeDB(s.memory),
+			throttles:     memory.NewThrottleDB(s.memory),
+			outbox:        memory.NewOutboxDB(s.memory),
+			deliveries:    memory.NewDeliveryStatusDB(s.memory),
+			tx:            s.memory,
+		}
+	}
+	return storageDBs{
+		users:         storage.NewUserDB(s.gorm),
+		articles:      storage.NewArticleDB(s.gorm),
+		pwResets:      storage.NewPwResetDB(s.gorm),
+		verifications: storage.NewEmailVerificationDB(s.gorm),
+		sessions:      storage.NewSessionDB(s.gorm),
+		roles:         storage.NewRoleDB(s.gorm),
+		recoveryCodes: storage.NewRecoveryCodeDB(s.gorm),
+		throttles:     storage.NewThrottleDB(s.gorm),
+		outbox:        storage.NewOutboxDB(s.gorm),
+		deliveries:    storage.NewDeliveryStatusDB(s.gorm),
+		tx:            storage.NewTransactor(s.gorm),
+	}
+}
+
+// Loads user service, allows user functionality as defined by UserInterface
+// Must be loaded after WithMail for it to send emails
+func WithUsers(pepperKeys keyringConfig, pwHashCfg pwHashConfig, pwPolicyCfg pwPolicyConfig, pwResetCfg pwResetConfig, hmacKeys keyringConfig, tokenKeys keyringConfig, totpCfg totpConfig, lockoutCfg lockoutConfig) serviceOpts {
+	return func(services *Services) error {
+		var err error
+		if services.peppers, err = hash.NewKeyring(pepperKeys.Current, pepperKeys.Keys); err != nil {
+			return fmt.Errorf("Could not load password peppers: %w", err)
+		}
+		if services.hmacKeys, err = hash.NewKeyring(hmacKeys.Current, hmacKeys.Keys); err != nil {
+			return fmt.Errorf("Could not load HMAC keys: %w", err)
+		}
+		keys, err := hash.NewKeyring(tokenKeys.Current, tokenKeys.Keys)
+		if err != nil {
+			return fmt.Errorf("Could not load token keys: %w", err)
+		}
+		// Without a cipher enrolling in two factor authentication returns goafweb.ErrMFANotConfigured.
+		var totpCipher goafweb.SecretCipher
+		if totpCfg.Key != "" {
+			if totpCipher, err = encrypt.NewAESGCM(totpCfg.Key); err != nil {
+				return fmt.Errorf("Could not load TOTP key: %w", err)
+			}
+		} else {
+			log.Println("No TOTP key in config file, two factor authentication is disabled.")
+		}
+		pwHasher, err := pwHashCfg.hasher()
+		if err != nil {
+			return fmt.Errorf("Could not load password hashing: %w", err)
+		}
+		pwPolicy, err := pwPolicyCfg.policy()
+		if err != nil {
+			return fmt.Errorf("Could not load password policy: %w", err)
+		}
+		hasher := hash.NewPepperedHasher(pwHasher, services.peppers)
+		hmac := hash.NewHMAC(services.hmacKeys)
+		dbs := services.dbs()
+		uv := validation.NewUserValidator(dbs.users, hasher, pwPolicy)
+		pwrv := validation.NewPwResetValidator(dbs.pwResets, hmac)
+		evv := validation.NewEmailVerificationValidator(dbs.verifications, hmac)
+		sv := validation.NewSessionValidator(dbs.sessions, hmac)
+		services.roleDB = validation.NewRoleValidator(dbs.roles)
+		stores := goafweb.UserStores{
+			Users:         uv,
+			PwResets:      pwrv,
+			Verifications: evv,
+			Sessions:      sv,
+			Roles:         services.roleDB,
+			RecoveryCodes: validation.NewRecoveryCodeValidator(dbs.recoveryCodes, hmac),
+			Throttles:     validation.NewThrottleValidator(dbs.throttles),
+			Tx:            dbs.tx,
+		}
+		opts := []goafweb.UserServiceOpt{
+			goafweb.WithTOTP(totpCfg.Issuer, totpCipher),
+			goafweb.WithLockout(lockoutCfg.policy()),
+			goafweb.WithPasswordHasher(hasher),
+			goafweb.WithPWResetTTL(pwResetCfg.ttl()),
+		}
+		if services.MailService != nil {
+			opts = append(opts, goafweb.WithMail(services.MailService))
+		}
+		us := goafweb.NewUserService(stores, hash.NewSigner(keys), opts...)
 		services.UserService = us
 		return nil
 	}
@@ -61,23 +179,45 @@ func WithUsers(userPwPepper, hmacSecretKey string) serviceOpts {
 
 // Loads Articles service, allows articles functionality as defined by ArticleInterface
 // Used for blogs/news sections
+// Must be loaded after WithUsers as it uses the roles of the user to authorize changes
 func WithArticles() serviceOpts {
 	return func(services *Services) error {
-		adb := storage.NewArticleDB(services.gorm)
-		av := validation.NewArticleValidator(adb)
-		services.ArticleService = av
+		av := validation.NewArticleValidator(services.dbs().articles)
+		services.ArticleService = goafweb.NewArticleService(av, services.roleDB)
 		return nil
 	}
 }
 
-func WithMail(domain, apiKey string) serviceOpts {
+// Loads the mail service, emails are queued in the outbox and delivered by the backend chosen in mailCfg
+// Addresses that hard bounce are suppressed, nothing more is sent to them
+// The queue only delivers them once MailQueue.Run is called
+// Must be loaded after the storage
+func WithMail(mailCfg mailConfig, mgcfg mailgunConfig) serviceOpts {
 	return func(services *Services) error {
-		services.MailService = mail.NewMailService(domain, apiKey)
+		sender, err := mailCfg.sender(mgcfg)
+		if err != nil {
+			return fmt.Errorf("Could not load mail backend: %w", err)
+		}
+		templates, err := mailCfg.templates()
+		if err != nil {
+			return fmt.Errorf("Could not load email templates: %w", err)
+		}
+		dbs := services.dbs()
+		services.Deliveries = goafweb.NewDeliveryService(validation.NewDeliveryStatusValidator(dbs.deliveries))
+		services.MailQueue = mail.NewQueue(validation.NewOutboxValidator(dbs.outbox), sender, mailCfg.Queue.config())
+		services.MailService = mail.NewMailService(services.MailQueue, templates, services.Deliveries)
 		return nil
 	}
 }
 
-// a Wrapper for gorms AutoMigrate function
-func (s *Services) AutoMigrate() error {
-	return s.gorm.AutoMigrate(&goafweb.User{}, &goafweb.Article{}).Error
+// errNoDatabase is returned by anything that needs a database when the memory store is used
+var errNoDatabase = errors.New("Not available with the memory dialect, there is no database")
+
+// Returns the Migrator for the database
+// Migrations are run with the migrate command, see migrateCmd
+func (s *Services) Migrator() (*storage.Migrator, error) {
+	if s.gorm == nil {
+		return nil, errNoDatabase
+	}
+	return storage.NewMigrator(s.gorm), nil
 }
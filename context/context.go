@@ -13,7 +13,11 @@ type ctxKey string
 
 // Define userKey as constant so "user" can't be overwritten by anything malicious.
 const (
-	userKey ctxKey = "user"
+	userKey        ctxKey = "user"
+	permissionsKey ctxKey = "permissions"
+	sessionKey     ctxKey = "session"
+	requestIDKey   ctxKey = "requestID"
+	debugKey       ctxKey = "debug"
 )
 
 // WithUser adds a User into Context.
@@ -31,3 +35,62 @@ func GetUser(ctx context.Context) *goafweb.User {
 	}
 	return nil
 }
+
+// WithPermissions adds the permissions of the current User into Context.
+func WithPermissions(ctx context.Context, perms goafweb.Permissions) context.Context {
+	return context.WithValue(ctx, permissionsKey, perms)
+}
+
+// GetPermissions checks the Context for the permissions of the current User.
+// Returns goafweb.Permissions, which is empty if none are set.
+func GetPermissions(ctx context.Context) goafweb.Permissions {
+	if permsctx := ctx.Value(permissionsKey); permsctx != nil {
+		if perms, ok := permsctx.(goafweb.Permissions); ok {
+			return perms
+		}
+	}
+	return goafweb.Permissions{}
+}
+
+// WithSession adds the Session used to authenticate the request into Context.
+func WithSession(ctx context.Context, session *goafweb.Session) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+// GetSession checks the Context to see if the sessionKey exists.
+// Returns goafweb.Session or nil.
+func GetSession(ctx context.Context) *goafweb.Session {
+	if sessionctx := ctx.Value(sessionKey); sessionctx != nil {
+		if session, ok := sessionctx.(*goafweb.Session); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+// WithRequestID adds the ID used to identify the request in logs into Context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// GetRequestID checks the Context for the ID of the request.
+// Returns the ID or an empty string.
+func GetRequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// WithDebug marks whether the details of internal errors can be shown to the client,
+// they must be hidden in production.
+func WithDebug(ctx context.Context, debug bool) context.Context {
+	return context.WithValue(ctx, debugKey, debug)
+}
+
+// GetDebug checks the Context to see if the details of internal errors can be shown.
+// Returns false unless WithDebug set it.
+func GetDebug(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey).(bool)
+	return debug
+}
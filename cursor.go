@@ -0,0 +1,75 @@
+package goafweb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// Cursor marks a position in an ordered list of Articles so the next or previous
+// page can be fetched from that point without using offsets.
+// It records the sort value and ID of the Article at the edge of a page, and the
+// sort field and order the page was read in, as the position means nothing in another.
+type Cursor struct {
+	ID   int       `json:"id"`
+	Time time.Time `json:"t,omitempty"`
+	Sort string    `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	// Before is set when the cursor points to the page preceding the Article.
+	Before bool `json:"b,omitempty"`
+}
+
+// NewCursor returns a Cursor positioned at article for the sort field and order of query.
+func NewCursor(article *Article, query *ArticleQuery, before bool) Cursor {
+	c := Cursor{ID: article.ID, Sort: query.SortBy, Desc: query.Desc, Before: before}
+	switch query.SortBy {
+	case SortByCreated:
+		c.Time = article.CreatedAt
+	case SortByUpdated:
+		c.Time = article.UpdatedAt
+	}
+	return c
+}
+
+// Encode returns the Cursor as an opaque URL safe string.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a string previously returned by Cursor.Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrCursorInvalid
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return c, ErrCursorInvalid
+	}
+	return c, nil
+}
+
+// Matches reports whether the Cursor was issued for the sort field and order of query.
+// Paging from a Cursor issued for another would silently skip or repeat Articles.
+func (c Cursor) Matches(query *ArticleQuery) bool {
+	return c.Sort == query.SortBy && c.Desc == query.Desc
+}
+
+// SetCursors sets the Next and Prev cursors on a page of Articles read from cursor.
+// more reports whether another page exists in the direction the page was read.
+func (list *ArticleList) SetCursors(query *ArticleQuery, cursor Cursor, more bool) {
+	if len(list.Articles) == 0 {
+		return
+	}
+	hasNext, hasPrev := more, cursor.ID > 0
+	if cursor.Before {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		list.NextCursor = NewCursor(list.Articles[len(list.Articles)-1], query, false).Encode()
+	}
+	if hasPrev {
+		list.PrevCursor = NewCursor(list.Articles[0], query, true).Encode()
+	}
+}
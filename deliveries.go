@@ -0,0 +1,59 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type deliveryService struct {
+	statusDB DeliveryStatusDB
+}
+
+// NewDeliveryService returns a deliveryService that implements the DeliveryService interface.
+func NewDeliveryService(statusDB DeliveryStatusDB) *deliveryService {
+	return &deliveryService{
+		statusDB: statusDB,
+	}
+}
+
+// RecordEvent updates the DeliveryStatus of the events Recipient.
+// Providers can report events out of order, so an event older than the last one recorded doesn't
+// change the status. A bounce always suppresses the address though, whenever it happened.
+func (ds *deliveryService) RecordEvent(ctx context.Context, ev *DeliveryEvent) error {
+	switch ev.Type {
+	case DeliveryDelivered, DeliveryBounced, DeliveryComplained, DeliveryUnsubscribed:
+	default:
+		return Invalid(ValidationErrors{"event": fmt.Sprintf("Unknown delivery event %q", ev.Type)})
+	}
+	status, err := ds.statusDB.GetByEmail(ctx, ev.Recipient)
+	if errors.Is(err, ErrNotFound) {
+		status, err = &DeliveryStatus{Email: ev.Recipient}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("Could not retreive delivery status: %w", err)
+	}
+	if ev.Type == DeliveryBounced {
+		status.Suppressed = true
+	}
+	if !ev.Timestamp.Before(status.LastEventAt) {
+		status.Status, status.LastEventAt = ev.Type, ev.Timestamp
+		status.Reason = ev.Reason
+	}
+	if err := ds.statusDB.Save(ctx, status); err != nil {
+		return fmt.Errorf("Could not save delivery status: %w", err)
+	}
+	return nil
+}
+
+// Suppressed reports whether email has hard bounced, so must not be sent any more email.
+func (ds *deliveryService) Suppressed(ctx context.Context, email string) (bool, error) {
+	status, err := ds.statusDB.GetByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Could not retreive delivery status: %w", err)
+	}
+	return status.Suppressed, nil
+}
@@ -0,0 +1,65 @@
+/*
+Package encrypt provides symmetric encryption for secrets the app must be able to
+read back, i.e. TOTP secrets, so they are not stored in plain text.
+*/
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"goafweb/rand"
+)
+
+// ErrDecrypt is returned when a value can not be decrypted, either because it has
+// been tampered with or it was encrypted with a different key.
+var ErrDecrypt = errors.New("could not decrypt value")
+
+// AESGCM encrypts values with AES-256 in GCM mode, which also authenticates them.
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM creates an AESGCM using key.
+// The key is run through SHA-256 so a passphrase of any length can be used from config.
+func NewAESGCM(key string) (*AESGCM, error) {
+	if key == "" {
+		return nil, errors.New("Encryption error: key is required")
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// Encrypt encrypts plaintext with a random nonce and returns it base64 encoded.
+func (a *AESGCM) Encrypt(plaintext []byte) (string, error) {
+	nonce, err := rand.Bytes(a.aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := a.aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt.
+func (a *AESGCM) Decrypt(ciphertext string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < a.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := sealed[:a.aead.NonceSize()], sealed[a.aead.NonceSize():]
+	plaintext, err := a.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -1,7 +1,156 @@
 package goafweb
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
 
-var ErrNotFound = errors.New("Database Error: Resource not found.")
-var ErrPWInvalid = errors.New("Authentication error: password invalid.")
-var ErrAuth = errors.New("Authentication error: username/password invalid")
+// Error codes identify an Error to clients.
+// They are part of the API so must not change once released.
+const (
+	CodeInternal         = "internal"
+	CodeInvalid          = "invalid"
+	CodeBadRequest       = "bad_request"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeNotFound         = "not_found"
+	CodePWInvalid        = "password_invalid"
+	CodeAuth             = "auth_failed"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeCursorInvalid    = "cursor_invalid"
+	CodeForbidden        = "forbidden"
+	CodeSessionExpired   = "session_expired"
+	CodeTokenInvalid     = "token_invalid"
+	CodeTokenExpired     = "token_expired"
+	CodeTokenReused      = "token_reused"
+	CodeEmailUnverified  = "email_unverified"
+	CodeAlreadyVerified  = "already_verified"
+	CodeRateLimited      = "rate_limited"
+	CodeMFARequired      = "mfa_required"
+	CodeMFAInvalid       = "mfa_invalid"
+	CodeLocked           = "locked"
+	CodeMFANotConfigured = "mfa_not_configured"
+	CodeMFAEnabled       = "mfa_enabled"
+	CodeMFANotEnabled    = "mfa_not_enabled"
+	CodeMFANotEnrolled   = "mfa_not_enrolled"
+	CodeMessageSent      = "message_sent"
+	CodeSignatureInvalid = "signature_invalid"
+)
+
+var ErrNotFound = newError(CodeNotFound, "Database Error: Resource not found.")
+var ErrPWInvalid = newError(CodePWInvalid, "Authentication error: password invalid.")
+var ErrAuth = newError(CodeAuth, "Authentication error: username/password invalid")
+var ErrUnauthenticated = newError(CodeUnauthenticated, "Authentication error: you must be logged in to do that.")
+var ErrCursorInvalid = newError(CodeCursorInvalid, "Pagination error: cursor invalid.")
+var ErrForbidden = newError(CodeForbidden, "Authorization error: you do not have permission to do that.")
+var ErrSessionExpired = newError(CodeSessionExpired, "Authentication error: session expired.")
+var ErrTokenInvalid = newError(CodeTokenInvalid, "Authentication error: token invalid.")
+var ErrTokenExpired = newError(CodeTokenExpired, "Authentication error: token expired.")
+var ErrTokenReused = newError(CodeTokenReused, "Authentication error: refresh token already used, session revoked.")
+var ErrEmailUnverified = newError(CodeEmailUnverified, "Authorization error: email address not verified.")
+var ErrAlreadyVerified = newError(CodeAlreadyVerified, "Verification error: email address already verified.")
+var ErrRateLimited = newError(CodeRateLimited, "Rate limit error: too many requests, please try again later.")
+var ErrMFARequired = newError(CodeMFARequired, "Authentication error: a two factor authentication code is required.")
+var ErrMFAInvalid = newError(CodeMFAInvalid, "Authentication error: two factor authentication code invalid.")
+var ErrLocked = newError(CodeLocked, "Authentication error: too many failed attempts, account temporarily locked.")
+var ErrMFANotConfigured = newError(CodeMFANotConfigured, "Two factor authentication is not configured.")
+var ErrMFAEnabled = newError(CodeMFAEnabled, "Two factor authentication is already enabled.")
+var ErrMFANotEnabled = newError(CodeMFANotEnabled, "Two factor authentication is not enabled.")
+var ErrMFANotEnrolled = newError(CodeMFANotEnrolled, "Two factor authentication enrollment has not been started.")
+var ErrMessageSent = newError(CodeMessageSent, "Mail queue error: message already sent.")
+var ErrSignatureInvalid = newError(CodeSignatureInvalid, "Webhook error: signature invalid.")
+var ErrTemplateNotFound = newError(CodeNotFound, "Email template not found.")
+
+// Error is an error a client can be told about, Code identifies what went wrong and Message describes it.
+// Any error that isn't an Error, and doesn't wrap one, is internal and its details are kept from clients.
+type Error struct {
+	Code    string
+	Message string
+	// Err is the cause, it is included in the message so must also be safe to show.
+	Err error
+}
+
+func newError(code, message string) error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error with the same Code and Message, so errors made like a
+// sentinel such as Invalid(err) match it with errors.Is, while sentinels that share a Code,
+// such as ErrNotFound and ErrTemplateNotFound, can still be told apart.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Message == e.Message
+}
+
+// ErrInvalid matches every error returned by Invalid.
+var ErrInvalid = newError(CodeInvalid, "Validation Error")
+
+// Invalid marks err as caused by input that failed validation, so its message is shown to the client.
+// An err that is already an Error, i.e. a database error found while validating, is returned unchanged.
+func Invalid(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Code: CodeInvalid, Message: "Validation Error", Err: err}
+}
+
+// ValidationErrors holds every validation failure found in a request, keyed by the name of the
+// field that failed, so a form can show them all at once. Validators return it wrapped by Invalid.
+// A field has one message, from the first of its rules that failed.
+type ValidationErrors map[string]string
+
+// Error lists the failures ordered by field name.
+func (v ValidationErrors) Error() string {
+	fields := make([]string, 0, len(v))
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, len(fields))
+	for i, field := range fields {
+		msgs[i] = v[field]
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Internal marks err as a failure of the server rather than the request, with message describing
+// what failed. Clients are only told an internal error happened, the details are logged instead.
+func Internal(message string, err error) error {
+	return &Error{Code: CodeInternal, Message: message, Err: err}
+}
+
+// ErrorCode returns the Code of the first Error in err's chain, or CodeInternal if there isn't one.
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+// RetryError reports that a request was refused for now, and how long to wait before trying again.
+type RetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,29 @@
+package goafweb_test
+
+import (
+	"errors"
+	"fmt"
+	"goafweb"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		target error
+		want   bool
+	}{
+		"Same sentinel":            {err: goafweb.ErrNotFound, target: goafweb.ErrNotFound, want: true},
+		"Wrapped sentinel":         {err: fmt.Errorf("lookup: %w", goafweb.ErrNotFound), target: goafweb.ErrNotFound, want: true},
+		"Made like a sentinel":     {err: goafweb.Invalid(errors.New("bad")), target: goafweb.ErrInvalid, want: true},
+		"Sentinels sharing a code": {err: goafweb.ErrTemplateNotFound, target: goafweb.ErrNotFound, want: false},
+		"Different codes":          {err: goafweb.ErrAuth, target: goafweb.ErrPWInvalid, want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := errors.Is(tc.err, tc.target); got != tc.want {
+				t.Errorf("errors.Is(%v, %v) = %v, wanted %v", tc.err, tc.target, got, tc.want)
+			}
+		})
+	}
+}
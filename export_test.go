@@ -0,0 +1,25 @@
+package goafweb
+
+import "time"
+
+// Exported for the tests in goafweb_test, which run the services against storage/memory.
+
+const (
+	SessionTTL           = sessionTTL
+	SessionTouchInterval = sessionTouchInterval
+	AccessTokenTTL       = accessTokenTTL
+	VerificationTTL      = verificationTTL
+	VerificationResend   = verificationResendInterval
+	MFAChallengeTTL      = mfaChallengeTTL
+	RecoveryCodeCount    = recoveryCodeCount
+	DefaultPWResetTTL    = defaultPWResetTTL
+)
+
+var LoginAccountKey = loginAccountKey
+
+// WithNow makes the userService read the time from now, so tests can move it on.
+func WithNow(now func() time.Time) UserServiceOpt {
+	return func(us *userService) {
+		us.now = now
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"goafweb"
 	"goafweb/middleware"
 	"net/http"
 
@@ -11,14 +12,18 @@ type app struct {
 	authMW   middleware.AuthMW
 	users    *userHandler
 	articles *articleHandler
+	mail     *mailHandler
+	webhooks *webhookHandler
 	router   *mux.Router
 }
 
-func NewApp(auth middleware.AuthMW, uh *userHandler, ah *articleHandler, r *mux.Router) *app {
+func NewApp(auth middleware.AuthMW, uh *userHandler, ah *articleHandler, mh *mailHandler, wh *webhookHandler, r *mux.Router) *app {
 	app := &app{
 		authMW:   auth,
 		users:    uh,
 		articles: ah,
+		mail:     mh,
+		webhooks: wh,
 		router:   r,
 	}
 	app.routes()
@@ -29,16 +34,67 @@ func (a *app) routes() {
 	r := a.router
 	r.Use(a.authMW.CheckUser)
 	// /api/user
-	r.HandleFunc("/user", a.authMW.RequireUser(a.users.Create)).Methods(http.MethodPost)
-	r.HandleFunc("/signup",a.users.Create).Methods("POST")
-	r.HandleFunc("/login", a.users.Login).Methods("POST")
-	r.HandleFunc("/logout", a.users.Logout).Methods("GET")
-	r.HandleFunc("/forgot", a.users.Forgot).Methods("POST")
-	r.HandleFunc("/reset", a.users.Reset).Methods("POST")
+	a.handle("/user", a.users.Create, http.MethodPost)
+	a.public("/signup", a.users.Create, http.MethodPost)
+	a.public("/login", a.users.Login, http.MethodPost)
+	a.public("/login/mfa", a.users.LoginMFA, http.MethodPost)
+	a.public("/token/refresh", a.users.Refresh, http.MethodPost)
+	a.handle("/logout", a.authMW.RequireUser(a.users.Logout), http.MethodGet)
+	a.public("/forgot", a.users.Forgot, http.MethodPost)
+	a.public("/reset", a.users.Reset, http.MethodPost)
+	a.handle("/password", a.users.ChangePassword, http.MethodPost)
+	a.public("/verify", a.users.Verify, http.MethodPost)
+	a.handle("/verify/resend", a.users.ResendVerification, http.MethodPost)
+	a.handle("/sessions", a.authMW.RequireUser(a.users.Sessions), http.MethodGet)
+	a.handle("/sessions", a.users.RevokeSessions, http.MethodDelete)
+	a.handle("/sessions/{id:[0-9]+}", a.users.RevokeSession, http.MethodDelete)
+	a.handle("/totp/enroll", a.users.EnrollTOTP, http.MethodPost)
+	a.handle("/totp/confirm", a.users.ConfirmTOTP, http.MethodPost)
+	a.handle("/totp/disable", a.users.DisableTOTP, http.MethodPost)
+	a.restricted("/user/{id:[0-9]+}/roles", goafweb.PermUserRoles, a.users.Roles, http.MethodGet)
+	a.restricted("/user/{id:[0-9]+}/roles", goafweb.PermUserRoles, a.users.GrantRole, http.MethodPost)
+	a.restricted("/user/{id:[0-9]+}/roles/{role}", goafweb.PermUserRoles, a.users.RevokeRole, http.MethodDelete)
 
 	// /api/article/
-	r.HandleFunc("/article/{id:[0-9]+}", a.articles.View).Methods(http.MethodGet)
-	r.HandleFunc("/article", a.articles.Create).Methods(http.MethodPost)
-	r.HandleFunc("/article", a.authMW.RequireUser(a.articles.Update)).Methods(http.MethodPut)
-	r.HandleFunc("/article", a.articles.Delete).Methods(http.MethodDelete)
+	a.handle("/article", a.articles.List, http.MethodGet)
+	a.handle("/article/{id:[0-9]+}", a.articles.View, http.MethodGet)
+	a.restricted("/article", goafweb.PermArticlePublish, a.articles.Create, http.MethodPost, middleware.VerifiedEmail)
+	a.handle("/article", a.articles.Update, http.MethodPut)
+	a.handle("/article", a.articles.Delete, http.MethodDelete)
+
+	// /api/admin/
+	a.restricted("/admin/mail", goafweb.PermMailQueue, a.mail.List, http.MethodGet)
+	a.restricted("/admin/mail/{id:[0-9]+}/retry", goafweb.PermMailQueue, a.mail.Retry, http.MethodPost)
+	a.restricted("/admin/mail/templates", goafweb.PermMailPreview, a.mail.Templates, http.MethodGet)
+	a.restricted("/admin/mail/templates/{name}", goafweb.PermMailPreview, a.mail.Preview, http.MethodGet)
+	a.restricted("/admin/mail/templates/{name}/send", goafweb.PermMailPreview, a.mail.SendPreview, http.MethodPost)
+
+	// /api/webhooks/, authenticated by their signatures
+	a.public("/webhooks/mailgun", a.webhooks.Mailgun, http.MethodPost)
+}
+
+// handle registers a route on the router.
+// Any method that can change state requires a logged in user, so a mutating
+// route can't be left open by mistake. Routes that must be reachable without
+// logging in are registered with public instead.
+func (a *app) handle(path string, h http.HandlerFunc, method string) *mux.Route {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		h = a.authMW.RequireUser(h)
+	}
+	return a.router.HandleFunc(path, h).Methods(method)
+}
+
+// restricted registers a route that requires a logged in user holding perm whatever the method.
+// opts are further conditions the user must meet, i.e. middleware.VerifiedEmail.
+// The permission check already requires a user, so the handler is not wrapped again as handle would.
+func (a *app) restricted(path, perm string, h http.HandlerFunc, method string, opts ...middleware.UserOpt) *mux.Route {
+	return a.router.HandleFunc(path, a.authMW.RequirePermission(perm, opts...)(h)).Methods(method)
+}
+
+// public registers a route that does not require a logged in user whatever the method,
+// i.e. the endpoints used to sign up or log in.
+func (a *app) public(path string, h http.HandlerFunc, method string) *mux.Route {
+	return a.router.HandleFunc(path, h).Methods(method)
 }
@@ -1,11 +1,13 @@
 package handlers
 
 import (
-	"errors"
+	"fmt"
 	"goafweb"
 	"goafweb/context"
+	"goafweb/problem"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -26,68 +28,142 @@ func (ah *articleHandler) View(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	article, err := ah.ArticlesService.GetByID(id)
+	article, err := ah.ArticlesService.GetByID(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, goafweb.ErrNotFound) {
-			writeJson(w, err, http.StatusNotFound)
-			return
-		}
-		writeJson(w, err, http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	writeJson(w, article, http.StatusOK)
+	writeJson(w, r, article, http.StatusOK)
+}
+
+// List returns a page of articles from the database.
+// Results can be filtered with the author, created_after, created_before, updated_after and
+// updated_before query parameters, dates in RFC3339 format.
+// They are sorted by sort (id, created_at or updated_at) in the order given by order (asc or desc).
+// limit sets the page size and cursor the page, using a cursor from a previous response.
+// GET /article.
+func (ah *articleHandler) List(w http.ResponseWriter, r *http.Request) {
+	query, err := parseArticleQuery(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := ah.ArticlesService.List(r.Context(), query)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, list, http.StatusOK)
+}
+
+// parseArticleQuery reads an ArticleQuery from the request URL query parameters.
+// Every parameter that can't be parsed is reported, keyed by its name.
+func parseArticleQuery(r *http.Request) (*goafweb.ArticleQuery, error) {
+	params := r.URL.Query()
+	query := goafweb.ArticleQuery{
+		SortBy: params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+	errs := goafweb.ValidationErrors{}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		errs["order"] = "order must be asc or desc"
+	}
+	ints := map[string]*int{
+		"author": &query.Author,
+		"limit":  &query.Limit,
+	}
+	for name, dest := range ints {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs[name] = fmt.Sprintf("%s must be a number", name)
+				continue
+			}
+			*dest = n
+		}
+	}
+	times := map[string]*time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+		"updated_after":  &query.UpdatedAfter,
+		"updated_before": &query.UpdatedBefore,
+	}
+	for name, dest := range times {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				errs[name] = fmt.Sprintf("%s must be an RFC3339 date", name)
+				continue
+			}
+			*dest = t
+		}
+	}
+	if len(errs) > 0 {
+		return nil, goafweb.Invalid(errs)
+	}
+	return &query, nil
 }
 
 // Create reads request body for a new article and inserts to database.
+// The logged in user is set as the author.
 // POST /article.
 func (ah articleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r.Context())
+	if user == nil {
+		problem.Write(w, r, goafweb.ErrUnauthenticated)
+		return
+	}
 	var article goafweb.Article
 	if err := readJson(r, &article); err != nil {
-		writeJson(w, err, http.StatusUnprocessableEntity)
+		problem.Write(w, r, err)
 		return
 	}
-	user := context.GetUser(r.Context())
-	article.Author = user.ID
-	if err := ah.ArticlesService.Create(&article); err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+	if err := ah.ArticlesService.Create(r.Context(), user, &article); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	writeJson(w, article, http.StatusCreated)
+	writeJson(w, r, article, http.StatusCreated)
 
 }
 
 // Update reads request body for an article and updates the database.
+// Only the author, an editor or an admin can update an article.
 // PUT /article.
 func (ah *articleHandler) Update(w http.ResponseWriter, r *http.Request) {
 	var article goafweb.Article
 
 	if err := readJson(r, &article); err != nil {
-		writeJson(w, err, http.StatusUnprocessableEntity)
+		problem.Write(w, r, err)
 		return
 	}
 
-	if err := ah.ArticlesService.Update(&article); err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+	if err := ah.ArticlesService.Update(r.Context(), context.GetUser(r.Context()), &article); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	writeJson(w, article, http.StatusCreated)
+	writeJson(w, r, article, http.StatusCreated)
 }
 
 // Delete reads request body for an articles and removes it from the database.
+// Only the author, an editor or an admin can delete an article.
 // DELETE /article.
 func (ah *articleHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	var article *goafweb.Article
+	var article goafweb.Article
 
 	if err := readJson(r, &article); err != nil {
-		writeJson(w, err, http.StatusUnprocessableEntity)
+		problem.Write(w, r, err)
 		return
 	}
 
-	if err := ah.ArticlesService.Delete(article.ID); err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+	if err := ah.ArticlesService.Delete(r.Context(), context.GetUser(r.Context()), article.ID); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	writeJson(w, nil, http.StatusOK)
+	writeJson(w, r, nil, http.StatusOK)
 
 }
@@ -2,42 +2,46 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
+	"goafweb"
+	"goafweb/problem"
 	"io/ioutil"
 	"net/http"
 )
 
+// errUnsupportedMedia is returned by readJson if the request body is not JSON.
+var errUnsupportedMedia = &goafweb.Error{
+	Code:    goafweb.CodeUnsupportedMedia,
+	Message: "Media Type Not Supported: Content-Type header is not application/json",
+}
+
 // writeJSON is a helper function for writing a JSON response to http.ResponseWriter.
-func writeJson(w http.ResponseWriter, data interface{}, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	switch data := data.(type) {
-	case error:
-		w.Write([]byte(data.Error()))
+// Errors are written with problem.Write instead, including failing to encode data,
+// which is checked before anything is written so the status can still change.
+func writeJson(w http.ResponseWriter, r *http.Request, data interface{}, code int) {
+	stream, err := json.Marshal(data)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("Could not encode response: %w", err))
 		return
-	default:
-		stream, err := json.Marshal(data)
-		if err != nil {
-			w.Write([]byte(err.Error()))
-			return
-		}
-		w.Write(stream)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(stream)
 }
 
 // readJson is a helper method to read a JSON request.
 func readJson(r *http.Request, dest interface{}) error {
 	if header := r.Header.Get("Content-Type"); header != "" {
 		if header != "application/json" {
-			return errors.New("Media Type Not Supported: Content-Type header is not application/json")
+			return errUnsupportedMedia
 		}
 	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return err
+		return &goafweb.Error{Code: goafweb.CodeBadRequest, Message: "Could not read request body", Err: err}
 	}
 	if err := json.Unmarshal(body, dest); err != nil {
-		return err
+		return &goafweb.Error{Code: goafweb.CodeBadRequest, Message: "Request body is not valid JSON", Err: err}
 	}
 	return nil
 
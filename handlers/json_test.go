@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"goafweb/problem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJsonEncodeError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	w := httptest.NewRecorder()
+	writeJson(w, r, map[string]interface{}{"ch": make(chan int)}, http.StatusCreated)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Got status %d, wanted %d", w.Code, http.StatusInternalServerError)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Got Content-Type %q, wanted %q", ct, problem.ContentType)
+	}
+	var details problem.Details
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil || details.Status != http.StatusInternalServerError {
+		t.Errorf("Got body %q, %v, wanted problem details", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"goafweb"
+	"goafweb/problem"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultQueueLimit is how many queued messages are listed unless a limit is given.
+	defaultQueueLimit = 50
+	// maxQueueLimit is the most queued messages listed at once.
+	maxQueueLimit = 200
+)
+
+type mailHandler struct {
+	Queue       goafweb.MailQueue
+	MailService goafweb.MailService
+}
+
+// NewMail returns the admin handlers for the mail queue and for previewing email templates.
+func NewMail(q goafweb.MailQueue, ms goafweb.MailService) *mailHandler {
+	return &mailHandler{
+		Queue:       q,
+		MailService: ms,
+	}
+}
+
+// List lists the messages in the mail queue, newest first.
+// Filter by status with ?status=pending, sent or dead, and set how many with ?limit=, at most 200.
+// GET /admin/mail.
+func (mh *mailHandler) List(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit := defaultQueueLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxQueueLimit {
+			problem.Write(w, r, goafweb.Invalid(goafweb.ValidationErrors{"limit": "limit must be a number from 1 to 200"}))
+			return
+		}
+		limit = n
+	}
+	msgs, err := mh.Queue.List(r.Context(), params.Get("status"), limit)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, msgs, http.StatusOK)
+}
+
+// Retry queues a pending or dead message to be delivered again straight away.
+// Responds with http.StatusConflict if it was already sent.
+// POST /admin/mail/{id}/retry.
+func (mh *mailHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	msg, err := mh.Queue.Retry(r.Context(), id)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, msg, http.StatusOK)
+}
+
+// Templates lists the names of the email templates that can be previewed.
+// GET /admin/mail/templates.
+func (mh *mailHandler) Templates(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, r, mh.MailService.Templates(), http.StatusOK)
+}
+
+// Preview renders an email template with sample data.
+// The subject, text and HTML are returned as JSON, or just the HTML or text to view it
+// as it would be seen with ?format=html or ?format=text.
+// Responds with http.StatusNotFound if there is no template with that name.
+// GET /admin/mail/templates/{name}.
+func (mh *mailHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	email, err := mh.MailService.Preview(mux.Vars(r)["name"])
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "":
+		writeJson(w, r, email, http.StatusOK)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(email.HTML))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(email.Text))
+	default:
+		problem.Write(w, r, goafweb.Invalid(goafweb.ValidationErrors{"format": "format must be html or text"}))
+	}
+}
+
+// SendPreview sends an email template rendered with sample data to the email address in the request body.
+// It is queued like any other email, so responds with http.StatusAccepted.
+// POST /admin/mail/templates/{name}/send.
+func (mh *mailHandler) SendPreview(w http.ResponseWriter, r *http.Request) {
+	var email string
+	if err := readJson(r, &email); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := mh.MailService.SendPreview(r.Context(), mux.Vars(r)["name"], email); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"goafweb/mail"
+	"goafweb/problem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMailPreview(t *testing.T) {
+	tmpls, err := mail.NewTemplates("../mail/templates", mail.Brand{SiteName: "Example", BaseURL: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mh := NewMail(nil, mail.NewMailService(mail.NewRecorder(), tmpls, nil))
+	tests := []struct {
+		name        string
+		template    string
+		query       string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"json", "verify_email", "", http.StatusOK, "application/json", `"subject":"Please verify your email address."`},
+		{"html", "verify_email", "?format=html", http.StatusOK, "text/html; charset=utf-8", "<html"},
+		{"text", "verify_email", "?format=text", http.StatusOK, "text/plain; charset=utf-8", "https://example.com/verify?token=preview-token"},
+		{"unknown format", "verify_email", "?format=pdf", http.StatusUnprocessableEntity, problem.ContentType, "format"},
+		{"unknown template", "missing", "", http.StatusNotFound, problem.ContentType, "not_found"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/admin/mail/templates/"+tt.template+tt.query, nil)
+		r = mux.SetURLVars(r, map[string]string{"name": tt.template})
+		w := httptest.NewRecorder()
+		mh.Preview(w, r)
+		if w.Code != tt.code || w.Header().Get("Content-Type") != tt.contentType || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s: got %d %q:\n%s", tt.name, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
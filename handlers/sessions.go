@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"goafweb/context"
+	"goafweb/problem"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Sessions lists every device the logged in user is logged in on.
+// The session making the request is marked as current.
+// GET /sessions.
+func (uh *userHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r.Context())
+	sessions, err := uh.UserService.Sessions(r.Context(), user.ID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if current := context.GetSession(r.Context()); current != nil {
+		for _, session := range sessions {
+			session.Current = session.ID == current.ID
+		}
+	}
+	writeJson(w, r, sessions, http.StatusOK)
+}
+
+// RevokeSession logs the user out of a single device.
+// DELETE /sessions/{id}.
+func (uh *userHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r.Context())
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := uh.UserService.RevokeSession(r.Context(), user.ID, id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RevokeSessions logs the user out of every device, including the one making the request.
+// DELETE /sessions.
+func (uh *userHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r.Context())
+	if err := uh.UserService.RevokeSessions(r.Context(), user.ID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// clientIP returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
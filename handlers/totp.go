@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"goafweb/context"
+	"goafweb/problem"
+	"net/http"
+)
+
+type totpForm struct {
+	Code string `json:"code"`
+}
+
+// EnrollTOTP starts enabling two factor authentication for the logged in user.
+// It returns the secret and an otpauth URI to add to an authenticator app.
+// POST /totp/enroll
+func (uh *userHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUser(r.Context())
+	enrollment, err := uh.UserService.EnrollTOTP(r.Context(), user.ID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, enrollment, http.StatusOK)
+}
+
+// ConfirmTOTP enables two factor authentication once the user provides a code from their app.
+// It returns the users recovery codes, which are not shown again.
+// POST /totp/confirm
+func (uh *userHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var form totpForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	user := context.GetUser(r.Context())
+	codes, err := uh.UserService.ConfirmTOTP(r.Context(), user.ID, form.Code)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, codes, http.StatusOK)
+}
+
+// DisableTOTP turns off two factor authentication, it requires a current code or recovery code.
+// POST /totp/disable
+func (uh *userHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var form totpForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	user := context.GetUser(r.Context())
+	if err := uh.UserService.DisableTOTP(r.Context(), user.ID, form.Code); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -5,19 +5,21 @@ import (
 	"fmt"
 	"goafweb"
 	"goafweb/context"
-	"goafweb/rand"
+	"goafweb/problem"
 	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 type userHandler struct {
-	UserService  goafweb.UserService
-	EmailService goafweb.MailService
+	UserService goafweb.UserService
 }
 
-func NewUsers(us goafweb.UserService, emailer goafweb.MailService) *userHandler {
+// NewUsers returns the handlers for users. Emails are sent by the UserService.
+func NewUsers(us goafweb.UserService) *userHandler {
 	return &userHandler{
-		UserService:  us,
-		EmailService: emailer,
+		UserService: us,
 	}
 }
 
@@ -26,6 +28,27 @@ type resetPWForm struct {
 	Password string `schema:"password"`
 	Token    string `schema:"token"`
 }
+type passwordForm struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+type roleForm struct {
+	Role string `json:"role"`
+}
+type verifyForm struct {
+	Token string `json:"token"`
+}
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+type mfaLoginForm struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+type refreshForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
 type loginForm struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -34,18 +57,21 @@ type loginForm struct {
 // POST /signup
 // Create processes a new user and adds to database if okay
 // Reloads signup page and returns errors if now
+// New users are unverified until they follow the link emailed to them.
 func (uh *userHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var user goafweb.User
 
 	if err := readJson(r, &user); err != nil {
-		writeJson(w, err, http.StatusUnprocessableEntity)
+		problem.Write(w, r, err)
 		return
 	}
-	if err := uh.UserService.Create(&user); err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+	// Only accept the fields a user can choose for themselves, so a role can't be self assigned.
+	user = goafweb.User{Name: user.Name, Email: user.Email, Password: user.Password}
+	if _, err := uh.UserService.SignUp(r.Context(), &user); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	writeJson(w, user, http.StatusCreated)
+	writeJson(w, r, user, http.StatusCreated)
 
 }
 
@@ -53,86 +79,128 @@ func (uh *userHandler) Create(w http.ResponseWriter, r *http.Request) {
 // It expects the authentication request to come via an Basic Authorization header.
 // It processes the header and authenticates the user.
 // It returns http.StatusUnauthorized if header is not set or authentication details are incorrect,
-// otherwise returns http.StatusOK and a RememberToken.
+// http.StatusTooManyRequests if there have been too many failed attempts,
+// otherwise returns http.StatusOK and a short lived access token with a refresh token.
 // POST /login
 func (uh *userHandler) Login(w http.ResponseWriter, r *http.Request) {
 	email, password, ok := r.BasicAuth()
 	if !ok {
 		w.Header().Set("WWW-Authenticate", "Basic realm=\"Access to goafweb\"")
-		writeJson(w, "Please provide authentication details", http.StatusUnauthorized)
+		problem.Write(w, r, goafweb.ErrUnauthenticated)
 		return
 	}
-	user, err := uh.UserService.Authenticate(email, password)
+	user, err := uh.UserService.Authenticate(r.Context(), email, password, clientIP(r))
 	if err != nil {
+		if writeRetry(w, r, err) {
+			return
+		}
 		// If user not found or password is invalid return a general authentication error so
 		// validity of email is not exposed. Otherwise return error.
 		w.Header().Set("WWW-Authenticate", "Basic realm=\"Access to goafweb\"")
 		if errors.Is(err, goafweb.ErrNotFound) || errors.Is(err, goafweb.ErrPWInvalid) {
-			writeJson(w, goafweb.ErrAuth, http.StatusUnauthorized)
+			problem.Write(w, r, goafweb.ErrAuth)
 			return
 		}
-		writeJson(w, err, http.StatusUnauthorized)
+		problem.Write(w, r, err)
 		return
 	}
-	// Authentication okay - issue new rememberToken
-	if err := uh.login(w, user); err != nil {
-		writeJson(w, err, http.StatusInternalServerError)
-		return
-	}
-	// TODO: Implement this as an oauth2 token?
-	writeJson(w, user.RememberToken, http.StatusOK)
+	// Authentication okay - start a new session for this device
+	uh.login(w, r, user)
 }
 
-// login is a helper function to set tokens once the user has been authenticated.
-// It issues the user with a RememberToken and stores the hashed token in the database.
-// The token can then be issued to the user by the function that calls login().
-func (uh *userHandler) login(w http.ResponseWriter, user *goafweb.User) error {
-	if user.RememberToken == "" {
-		token, err := rand.RememberToken()
+// login is a helper function to start a session once the user has been authenticated.
+// It creates a Session for the device making the request and writes an access and refresh token for it.
+// If the user has two factor authentication enabled it writes an mfaChallenge instead, and
+// the user must finish logging in at /login/mfa.
+func (uh *userHandler) login(w http.ResponseWriter, r *http.Request, user *goafweb.User) {
+	tokens, err := uh.UserService.Login(r.Context(), user, r.UserAgent(), clientIP(r))
+	if errors.Is(err, goafweb.ErrMFARequired) {
+		challenge, err := uh.UserService.MFAChallenge(user)
 		if err != nil {
-			return err
+			problem.Write(w, r, fmt.Errorf("Could not login: %w", err))
+			return
 		}
-		user.RememberToken = token
-		err = uh.UserService.Update(user)
-		if err != nil {
-			return fmt.Errorf("Could not login: %w", err)
+		writeJson(w, r, mfaChallenge{MFARequired: true, MFAToken: challenge}, http.StatusOK)
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("Could not login: %w", err))
+		return
+	}
+	writeJson(w, r, tokens, http.StatusOK)
+}
+
+// LoginMFA completes logging in a user with two factor authentication enabled.
+// It expects the mfa_token from /login and a code from their authenticator app or a recovery code.
+// POST /login/mfa
+func (uh *userHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var form mfaLoginForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	tokens, err := uh.UserService.LoginMFA(r.Context(), form.MFAToken, form.Code, r.UserAgent(), clientIP(r))
+	if err != nil {
+		if writeRetry(w, r, err) {
+			return
 		}
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, tokens, http.StatusOK)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token.
+// Each refresh token can only be used once, reusing one logs out the session it belongs to.
+// POST /token/refresh
+func (uh *userHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var form refreshForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	tokens, err := uh.UserService.Refresh(r.Context(), form.RefreshToken)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
 	}
-	return nil
+	writeJson(w, r, tokens, http.StatusOK)
 }
 
-// Logout logs a user out, removing any existing sessions/tokens
+// Logout logs a user out of the device making the request by revoking its session.
+// Sessions on other devices are unaffected.
 // GET /logout
 func (uh *userHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	// Set a new rememberToken and updates db.
-	// This prevents user from being able to use any exisiting tokens as it will not match database RememberToken.
-	token, _ := rand.RememberToken()
 	user := context.GetUser(r.Context())
-
-	user.RememberToken = token
-	if err := uh.UserService.Update(user); err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+	session := context.GetSession(r.Context())
+	if session == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err := uh.UserService.RevokeSession(r.Context(), user.ID, session.ID); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 // Forgot will initiate the process for resetting a users password.
-// It will create a reset token which is stored in the database and emailed to the user.
+// It will create a reset token which is stored in the database and queued to be emailed to the user.
+// Responds with http.StatusOK whether or not the address has an account, so it can't be used to find
+// out which do, and http.StatusTooManyRequests if too many resets have been requested.
 // POST /forgot.
 func (uh *userHandler) Forgot(w http.ResponseWriter, r *http.Request) {
 	var email string
 	if err := readJson(r, &email); err != nil {
-		writeJson(w, err, http.StatusUnprocessableEntity)
-		return
-	}
-	token, err := uh.UserService.InitiatePWReset(email)
-	if err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
-	if err := uh.EmailService.ResetPw(email, token); err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+	// No token is made if there is no account, but the response is the same.
+	if _, err := uh.UserService.InitiatePWReset(r.Context(), email, clientIP(r)); err != nil {
+		if writeRetry(w, r, err) {
+			return
+		}
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -141,19 +209,125 @@ func (uh *userHandler) Forgot(w http.ResponseWriter, r *http.Request) {
 
 // Reset will process a users password reset, processing the provided token and
 // return any errors if they exist.
+// Every device the user was logged in on is logged out, the one making the request is logged in again.
 // POST /reset.
 func (uh *userHandler) Reset(w http.ResponseWriter, r *http.Request) {
 
 	var form resetPWForm
 	if err := readJson(r, &form); err != nil {
-		writeJson(w, err, http.StatusUnprocessableEntity)
+		problem.Write(w, r, err)
 		return
 	}
-	user, err := uh.UserService.CompletePWReset(form.Token, form.Password)
+	user, err := uh.UserService.CompletePWReset(r.Context(), form.Token, form.Password)
 	if err != nil {
-		writeJson(w, err, http.StatusBadRequest)
+		problem.Write(w, r, err)
+		return
+	}
+	uh.login(w, r, user)
+}
+
+// ChangePassword sets a new password for the logged in user once they confirm their current one.
+// The new password must meet the password policy, a http.StatusUnprocessableEntity response explains why not.
+// The user is logged out of every other device.
+// POST /password.
+func (uh *userHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var form passwordForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	user := context.GetUser(r.Context())
+	var sessionID int
+	if session := context.GetSession(r.Context()); session != nil {
+		sessionID = session.ID
+	}
+	if err := uh.UserService.ChangePassword(r.Context(), user.ID, sessionID, form.CurrentPassword, form.Password); err != nil {
+		if writeRetry(w, r, err) {
+			return
+		}
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Roles lists the roles granted to a user.
+// GET /user/{id}/roles.
+func (uh *userHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	roles, err := uh.UserService.Roles(r.Context(), id)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	writeJson(w, r, roles, http.StatusOK)
+}
+
+// GrantRole reads a role from the request body and grants it to a user.
+// POST /user/{id}/roles.
+func (uh *userHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var form roleForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := uh.UserService.GrantRole(r.Context(), id, form.Role); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RevokeRole removes a role from a user.
+// DELETE /user/{id}/roles/{role}.
+func (uh *userHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	if err := uh.UserService.RevokeRole(r.Context(), id, vars["role"]); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Verify processes the token emailed to a user and marks their email address as verified.
+// POST /verify.
+func (uh *userHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var form verifyForm
+	if err := readJson(r, &form); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if _, err := uh.UserService.CompleteVerification(r.Context(), form.Token); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	uh.login(w, user)
 	w.WriteHeader(http.StatusOK)
 }
+
+// ResendVerification emails the logged in user a new verification link.
+// Responds with http.StatusTooManyRequests if one was sent too recently.
+// POST /verify/resend.
+func (uh *userHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if _, err := uh.UserService.InitiateVerification(r.Context(), context.GetUser(r.Context()).ID); err != nil {
+		if writeRetry(w, r, err) {
+			return
+		}
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeRetry responds with a Retry-After header if err is a RetryError.
+// It reports whether it wrote a response.
+func writeRetry(w http.ResponseWriter, r *http.Request, err error) bool {
+	var retry *goafweb.RetryError
+	if !errors.As(err, &retry) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.RetryAfter.Seconds())+1))
+	problem.Write(w, r, err)
+	return true
+}
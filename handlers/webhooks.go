@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"goafweb"
+	"goafweb/context"
+	"goafweb/problem"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// mailgunTolerance is how far a webhook's timestamp may be from now.
+// Tokens are remembered for this long, so a captured webhook can't be replayed to this process.
+const mailgunTolerance = 5 * time.Minute
+
+type webhookHandler struct {
+	Deliveries goafweb.DeliveryService
+	mailgunKey []byte
+	now        func() time.Time
+
+	// seen is only kept in memory, so it is lost on restart and isn't shared between instances.
+	// A webhook replayed within mailgunTolerance to another instance, or after a restart, is
+	// recorded again, which is harmless as recording the same event twice doesn't change anything.
+	mu   sync.Mutex
+	seen map[string]time.Time // Tokens of accepted webhooks, by when they were accepted
+}
+
+// NewWebhooks returns the handlers for webhooks from the mail provider.
+// mailgunSigningKey is the HTTP webhook signing key from Mailgun's dashboard, if it is empty
+// every Mailgun webhook is refused.
+func NewWebhooks(ds goafweb.DeliveryService, mailgunSigningKey string) *webhookHandler {
+	return &webhookHandler{
+		Deliveries: ds,
+		mailgunKey: []byte(mailgunSigningKey),
+		now:        time.Now,
+		seen:       make(map[string]time.Time),
+	}
+}
+
+// mailgunWebhook is the body of a webhook from Mailgun, only the fields used are included.
+type mailgunWebhook struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event          string  `json:"event"`
+		Severity       string  `json:"severity"`
+		Recipient      string  `json:"recipient"`
+		Timestamp      float64 `json:"timestamp"`
+		DeliveryStatus struct {
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+// Mailgun records the delivery events Mailgun reports: delivered, failed permanently, complained and unsubscribed.
+// Responds with http.StatusUnauthorized if the signature is invalid, too old or has been used before.
+// Other events are accepted and ignored, so Mailgun doesn't retry them. So are events that fail
+// validation, such as one without a recipient, as they would fail every retry too, they are logged instead.
+// POST /webhooks/mailgun.
+func (wh *webhookHandler) Mailgun(w http.ResponseWriter, r *http.Request) {
+	var hook mailgunWebhook
+	if err := readJson(r, &hook); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	sig := hook.Signature
+	if err := wh.verifyMailgun(sig.Timestamp, sig.Token, sig.Signature); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if ev := hook.event(); ev != nil {
+		switch err := wh.Deliveries.RecordEvent(r.Context(), ev); {
+		case errors.Is(err, goafweb.ErrInvalid):
+			// Every retry would fail the same way, so the event is accepted to stop Mailgun sending it again.
+			log.Printf("Request %s ignored a Mailgun %s event that can't be recorded: %v",
+				context.GetRequestID(r.Context()), hook.EventData.Event, err)
+		case err != nil:
+			// Mailgun retries webhooks that fail, the retry must not be refused as a replay.
+			wh.forget(sig.Token)
+			problem.Write(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyMailgun checks signature is the HMAC-SHA256 of timestamp and token with the signing key,
+// that timestamp is recent and that token hasn't been seen before.
+// token is then seen, so the same webhook sent again while it is being handled is refused too.
+func (wh *webhookHandler) verifyMailgun(timestamp, token, signature string) error {
+	if len(wh.mailgunKey) == 0 || token == "" {
+		return goafweb.ErrSignatureInvalid
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return goafweb.ErrSignatureInvalid
+	}
+	now := wh.now()
+	if age := now.Sub(time.Unix(sent, 0)); age > mailgunTolerance || age < -mailgunTolerance {
+		return goafweb.ErrSignatureInvalid
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return goafweb.ErrSignatureInvalid
+	}
+	mac := hmac.New(sha256.New, wh.mailgunKey)
+	mac.Write([]byte(timestamp + token))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return goafweb.ErrSignatureInvalid
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	for t, at := range wh.seen {
+		if now.Sub(at) > 2*mailgunTolerance {
+			delete(wh.seen, t)
+		}
+	}
+	if _, ok := wh.seen[token]; ok {
+		return goafweb.ErrSignatureInvalid
+	}
+	wh.seen[token] = now
+	return nil
+}
+
+// forget removes token from the tokens seen, so a webhook that couldn't be recorded can be sent again.
+func (wh *webhookHandler) forget(token string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	delete(wh.seen, token)
+}
+
+// event returns the DeliveryEvent for the webhook, or nil if it isn't one that is recorded.
+// Temporary failures are not recorded, Mailgun keeps trying to deliver those.
+func (hook *mailgunWebhook) event() *goafweb.DeliveryEvent {
+	data := hook.EventData
+	sec, frac := math.Modf(data.Timestamp)
+	ev := &goafweb.DeliveryEvent{
+		Recipient: data.Recipient,
+		Timestamp: time.Unix(int64(sec), int64(frac*1e9)),
+	}
+	switch data.Event {
+	case "delivered":
+		ev.Type = goafweb.DeliveryDelivered
+	case "failed":
+		if data.Severity != "permanent" {
+			return nil
+		}
+		ev.Type = goafweb.DeliveryBounced
+		ev.Reason = data.DeliveryStatus.Description
+		if ev.Reason == "" {
+			ev.Reason = data.DeliveryStatus.Message
+		}
+	case "complained":
+		ev.Type = goafweb.DeliveryComplained
+	case "unsubscribed":
+		ev.Type = goafweb.DeliveryUnsubscribed
+	default:
+		return nil
+	}
+	return ev
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/storage/memory"
+	"goafweb/validation"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata/mailgun are webhooks as Mailgun sends them, signed with
+// testSigningKey at testWebhookTime.
+const testSigningKey = "test-webhook-signing-key"
+
+var testWebhookTime = time.Unix(1760000000, 0)
+
+func newTestWebhooks() (*webhookHandler, goafweb.DeliveryStatusDB) {
+	statusDB := validation.NewDeliveryStatusValidator(memory.NewDeliveryStatusDB(memory.NewDB()))
+	wh := NewWebhooks(goafweb.NewDeliveryService(statusDB), testSigningKey)
+	wh.now = func() time.Time { return testWebhookTime.Add(time.Minute) }
+	return wh, statusDB
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "mailgun", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// postWebhook replays body to the Mailgun webhook and returns the response status.
+func postWebhook(wh *webhookHandler, body []byte) int {
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/mailgun", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	wh.Mailgun(w, r)
+	return w.Code
+}
+
+func TestMailgunWebhookEvents(t *testing.T) {
+	wh, statusDB := newTestWebhooks()
+	// complained is newer than delivered, so the status must not go back to delivered.
+	for _, name := range []string{"complained", "delivered", "bounced", "temporary_failure", "unsubscribed"} {
+		if code := postWebhook(wh, readFixture(t, name)); code != http.StatusOK {
+			t.Fatalf("%s: got status %d, wanted %d", name, code, http.StatusOK)
+		}
+	}
+	tests := []struct {
+		email      string
+		status     string
+		suppressed bool
+		reason     string
+	}{
+		{"user@example.com", goafweb.DeliveryComplained, false, ""},
+		{"gone@example.com", goafweb.DeliveryBounced, true, "5.1.1 The email account that you tried to reach does not exist."},
+		{"other@example.com", goafweb.DeliveryUnsubscribed, false, ""},
+	}
+	for _, tt := range tests {
+		got, err := statusDB.GetByEmail(context.Background(), tt.email)
+		if err != nil {
+			t.Errorf("%s: %v", tt.email, err)
+			continue
+		}
+		if got.Status != tt.status || got.Suppressed != tt.suppressed || !strings.Contains(got.Reason, tt.reason) {
+			t.Errorf("%s: got %q suppressed %v reason %q, wanted %q suppressed %v reason %q",
+				tt.email, got.Status, got.Suppressed, got.Reason, tt.status, tt.suppressed, tt.reason)
+		}
+	}
+	// Temporary failures are retried by Mailgun, so nothing is recorded.
+	if _, err := statusDB.GetByEmail(context.Background(), "full@example.com"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("temporary failure: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+}
+
+func TestMailgunWebhookSignature(t *testing.T) {
+	delivered := readFixture(t, "delivered")
+	tests := []struct {
+		name string
+		body []byte
+		now  time.Time
+		key  string
+	}{
+		{"wrong key", delivered, testWebhookTime, "other-key"},
+		{"no key configured", delivered, testWebhookTime, ""},
+		{"too old", delivered, testWebhookTime.Add(10 * time.Minute), testSigningKey},
+		{"from the future", delivered, testWebhookTime.Add(-10 * time.Minute), testSigningKey},
+		{"tampered token", bytes.Replace(delivered, []byte(`"token": "c2`), []byte(`"token": "d2`), 1), testWebhookTime, testSigningKey},
+		{"tampered timestamp", bytes.Replace(delivered, []byte(`"1760000000"`), []byte(`"1760000001"`), 1), testWebhookTime, testSigningKey},
+		{"unsigned", []byte(`{"event-data": {"event": "failed", "severity": "permanent", "recipient": "user@example.com"}}`), testWebhookTime, testSigningKey},
+	}
+	for _, tt := range tests {
+		wh, statusDB := newTestWebhooks()
+		wh.mailgunKey = []byte(tt.key)
+		wh.now = func() time.Time { return tt.now }
+		if code := postWebhook(wh, tt.body); code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, code, http.StatusUnauthorized)
+		}
+		if _, err := statusDB.GetByEmail(context.Background(), "user@example.com"); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("%s: a refused webhook changed the delivery status", tt.name)
+		}
+	}
+}
+
+func TestMailgunWebhookReplay(t *testing.T) {
+	wh, _ := newTestWebhooks()
+	bounced := readFixture(t, "bounced")
+	if code := postWebhook(wh, bounced); code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", code, http.StatusOK)
+	}
+	if code := postWebhook(wh, bounced); code != http.StatusUnauthorized {
+		t.Errorf("replayed webhook: got status %d, wanted %d", code, http.StatusUnauthorized)
+	}
+}
+
+// failingDeliveries is a DeliveryService that can't record events while fail is set.
+type failingDeliveries struct {
+	goafweb.DeliveryService
+	fail bool
+}
+
+func (fd *failingDeliveries) RecordEvent(ctx context.Context, ev *goafweb.DeliveryEvent) error {
+	if fd.fail {
+		return errors.New("database unavailable")
+	}
+	return fd.DeliveryService.RecordEvent(ctx, ev)
+}
+
+func TestMailgunWebhookRetry(t *testing.T) {
+	wh, statusDB := newTestWebhooks()
+	deliveries := &failingDeliveries{DeliveryService: wh.Deliveries, fail: true}
+	wh.Deliveries = deliveries
+	bounced := readFixture(t, "bounced")
+	if code := postWebhook(wh, bounced); code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, wanted %d", code, http.StatusInternalServerError)
+	}
+
+	// Mailgun sends the same webhook again once it has failed.
+	deliveries.fail = false
+	if code := postWebhook(wh, bounced); code != http.StatusOK {
+		t.Fatalf("retried webhook: got status %d, wanted %d", code, http.StatusOK)
+	}
+	if status, err := statusDB.GetByEmail(context.Background(), "gone@example.com"); err != nil || !status.Suppressed {
+		t.Errorf("got %+v, %v, wanted the bounce recorded", status, err)
+	}
+	if code := postWebhook(wh, bounced); code != http.StatusUnauthorized {
+		t.Errorf("replayed webhook: got status %d, wanted %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestMailgunWebhookUnrecordable(t *testing.T) {
+	wh, statusDB := newTestWebhooks()
+	// The signature only covers the timestamp and token, so the fixture is still signed.
+	noRecipient := bytes.Replace(readFixture(t, "delivered"), []byte(`"recipient": "user@example.com"`), []byte(`"recipient": ""`), 1)
+	// Mailgun would retry a failure forever, so the event is accepted even though it isn't recorded.
+	if code := postWebhook(wh, noRecipient); code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", code, http.StatusOK)
+	}
+	if _, err := statusDB.GetByEmail(context.Background(), "user@example.com"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("got %v, wanted nothing recorded", err)
+	}
+	if code := postWebhook(wh, noRecipient); code != http.StatusUnauthorized {
+		t.Errorf("replayed webhook: got status %d, wanted %d", code, http.StatusUnauthorized)
+	}
+}
@@ -8,27 +8,64 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"hash"
+	"sync"
 )
 
 // NewHMAC creates and returns a new HMAC object.
-func NewHMAC(key string) HMAC {
-	h := hmac.New(sha256.New, []byte(key))
+// Hashes are made with the current key in keys, the others are kept so existing hashes can still be looked up.
+func NewHMAC(keys Keyring) HMAC {
+	pools := make(map[string]*sync.Pool, len(keys.Keys))
+	for id, key := range keys.Keys {
+		key := []byte(key)
+		pools[id] = &sync.Pool{
+			New: func() interface{} { return hmac.New(sha256.New, key) },
+		}
+	}
 	return HMAC{
-		hmac: h,
+		current: keys.Current,
+		ids:     keys.IDs(),
+		pools:   pools,
 	}
 }
 
 // HMAC is a wrapper around the crypto/hmac package making
 // it a little easier to use in our code.
+// It is safe for concurrent use, each hash borrows its own hash.Hash from a pool
+// so concurrent calls never share state.
 type HMAC struct {
-	hmac hash.Hash
+	current string
+	ids     []string
+	pools   map[string]*sync.Pool
 }
 
 // Hash will hash the provided input string using HMAC with
-// the secret key provided when the HMAC object was created.
+// the current secret key, prefixed with the key's ID.
 func (h HMAC) Hash(input string) string {
-	h.hmac.Reset()
-	h.hmac.Write([]byte(input))
-	b := h.hmac.Sum(nil)
-	return base64.URLEncoding.EncodeToString(b)
+	return h.hash(h.current, input)
+}
+
+// Hashes returns the hash of input made with every key, starting with the current key.
+// A value stored before a key was rotated will match one of them.
+func (h HMAC) Hashes(input string) []string {
+	hashes := make([]string, len(h.ids))
+	for i, id := range h.ids {
+		hashes[i] = h.hash(id, input)
+	}
+	return hashes
+}
+
+// IsCurrent reports whether hashed was made with the current key.
+func (h HMAC) IsCurrent(hashed string) bool {
+	id, _ := SplitKeyID(hashed)
+	return id == h.current
+}
+
+func (h HMAC) hash(id, input string) string {
+	pool := h.pools[id]
+	mac := pool.Get().(hash.Hash)
+	mac.Reset()
+	mac.Write([]byte(input))
+	b := mac.Sum(nil)
+	pool.Put(mac)
+	return TagKeyID(id, base64.URLEncoding.EncodeToString(b))
 }
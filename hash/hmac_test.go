@@ -0,0 +1,70 @@
+package hash
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHMACRotation(t *testing.T) {
+	legacy, _ := NewKeyring(LegacyKeyID, map[string]string{LegacyKeyID: "old-key"})
+	rotated, _ := NewKeyring("2", map[string]string{LegacyKeyID: "old-key", "2": "new-key"})
+
+	oldHash := NewHMAC(legacy).Hash("token")
+	if strings.Contains(oldHash, ":") {
+		t.Fatalf("Legacy hash should have no key ID, got %s", oldHash)
+	}
+	h := NewHMAC(rotated)
+	newHash := h.Hash("token")
+	if !strings.HasPrefix(newHash, "2:") {
+		t.Fatalf("Hash should be tagged with the current key ID, got %s", newHash)
+	}
+	hashes := h.Hashes("token")
+	if len(hashes) != 2 || hashes[0] != newHash || hashes[1] != oldHash {
+		t.Errorf("Got %v, wanted [%s %s]", hashes, newHash, oldHash)
+	}
+	if h.IsCurrent(oldHash) || !h.IsCurrent(newHash) {
+		t.Errorf("IsCurrent(%s) = %v, IsCurrent(%s) = %v", oldHash, h.IsCurrent(oldHash), newHash, h.IsCurrent(newHash))
+	}
+}
+
+// TestHMACConcurrent hammers a single HMAC from many goroutines, run with -race.
+// Every hash must match the one made for the same input without any concurrency.
+func TestHMACConcurrent(t *testing.T) {
+	keys, _ := NewKeyring("2", map[string]string{LegacyKeyID: "old-key", "2": "new-key"})
+	h := NewHMAC(keys)
+
+	const goroutines, iterations = 64, 200
+	want := make([]string, iterations)
+	for i := range want {
+		want[i] = NewHMAC(keys).Hash(strconv.Itoa(i))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				// Start each goroutine at a different input so they overlap on different values.
+				n := (i + g) % iterations
+				if got := h.Hash(strconv.Itoa(n)); got != want[n] {
+					errs <- fmt.Sprintf("Hash(%d) = %s, wanted %s", n, got, want[n])
+					return
+				}
+				if got := h.Hashes(strconv.Itoa(n)); got[0] != want[n] {
+					errs <- fmt.Sprintf("Hashes(%d)[0] = %s, wanted %s", n, got[0], want[n])
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
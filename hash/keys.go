@@ -0,0 +1,71 @@
+package hash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LegacyKeyID identifies the key used for values stored before key IDs were recorded.
+// Values produced with it have no key ID prefix.
+const LegacyKeyID = "legacy"
+
+// Keyring holds the secret keys used for a single purpose, each identified by a key ID.
+// New values are always produced with the Current key. Retired keys are kept in Keys
+// so values produced before a key was rotated can still be verified.
+type Keyring struct {
+	Current string
+	Keys    map[string]string
+}
+
+// NewKeyring creates a Keyring, checking the current key is one of keys.
+func NewKeyring(current string, keys map[string]string) (Keyring, error) {
+	if current == "" {
+		return Keyring{}, errors.New("Keyring error: current key ID is required")
+	}
+	if keys[current] == "" {
+		return Keyring{}, fmt.Errorf("Keyring error: no key for current key ID %q", current)
+	}
+	for id := range keys {
+		if strings.Contains(id, ":") {
+			return Keyring{}, fmt.Errorf("Keyring error: key ID %q must not contain \":\"", id)
+		}
+	}
+	return Keyring{Current: current, Keys: keys}, nil
+}
+
+// Key returns the key with the given ID, and whether it was found.
+func (k Keyring) Key(id string) ([]byte, bool) {
+	key, ok := k.Keys[id]
+	if !ok || key == "" {
+		return nil, false
+	}
+	return []byte(key), true
+}
+
+// IDs returns the ID of every key, starting with the current key.
+func (k Keyring) IDs() []string {
+	ids := []string{k.Current}
+	for id := range k.Keys {
+		if id != k.Current {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// TagKeyID prefixes value with the ID of the key that produced it, so it can be verified after the key is rotated.
+func TagKeyID(id, value string) string {
+	if id == LegacyKeyID {
+		return value
+	}
+	return id + ":" + value
+}
+
+// SplitKeyID separates a value produced by TagKeyID into the key ID and the original value.
+func SplitKeyID(tagged string) (id, value string) {
+	if i := strings.Index(tagged, ":"); i > 0 {
+		return tagged[:i], tagged[i+1:]
+	}
+	return LegacyKeyID, tagged
+}
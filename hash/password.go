@@ -0,0 +1,179 @@
+package hash
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"goafweb/rand"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms supported by PasswordHasher.
+const (
+	AlgBcrypt   = "bcrypt"
+	AlgArgon2id = "argon2id"
+)
+
+// ErrHashFormat is returned when a stored hash is not in a format PasswordHasher understands.
+var ErrHashFormat = errors.New("Unrecognised password hash format")
+
+// Argon2idParams are the cost settings for Argon2id, they are encoded in every hash made with them.
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams returns the settings recommended by RFC 9106 for memory constrained environments.
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// PasswordHasher hashes passwords with one algorithm but can compare passwords against
+// hashes made by any supported algorithm, so the algorithm or its cost can be changed
+// without invalidating existing passwords.
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2id   Argon2idParams
+}
+
+// NewBcryptHasher returns a PasswordHasher that hashes new passwords with bcrypt at cost.
+func NewBcryptHasher(cost int) PasswordHasher {
+	return PasswordHasher{algorithm: AlgBcrypt, bcryptCost: cost}
+}
+
+// NewArgon2idHasher returns a PasswordHasher that hashes new passwords with Argon2id using params.
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return PasswordHasher{algorithm: AlgArgon2id, argon2id: params}
+}
+
+// Hash returns the encoded hash of password, including the algorithm and parameters used.
+func (ph PasswordHasher) Hash(password string) (string, error) {
+	if ph.algorithm == AlgArgon2id {
+		salt, err := rand.Bytes(int(ph.argon2id.SaltLength))
+		if err != nil {
+			return "", err
+		}
+		return encodeArgon2id(ph.argon2id, salt, []byte(password)), nil
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), ph.bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Compare reports whether password matches hash, whichever algorithm hash was made with.
+func (ph PasswordHasher) Compare(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or parameters to
+// the ones the PasswordHasher uses for new passwords.
+func (ph PasswordHasher) NeedsRehash(hash string) bool {
+	if ph.algorithm == AlgArgon2id {
+		params, _, _, err := decodeArgon2id(hash)
+		return err != nil || params != ph.argon2id
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != ph.bcryptCost
+}
+
+// encodeArgon2id hashes password and encodes it in the PHC string format
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func encodeArgon2id(params Argon2idParams, salt, password []byte) string {
+	key := argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// decodeArgon2id parses a hash made by encodeArgon2id.
+func decodeArgon2id(hash string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return params, nil, nil, ErrHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrHashFormat
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrHashFormat
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrHashFormat
+	}
+	params.SaltLength, params.KeyLength = uint32(len(salt)), uint32(len(key))
+	return params, salt, key, nil
+}
+
+// PepperedHasher adds a secret pepper to passwords before hashing them with a PasswordHasher.
+// The ID of the pepper used is stored with each hash, so peppers can be rotated: hashes made with a
+// retired pepper still verify, and NeedsRehash reports them so they are upgraded at the next login.
+type PepperedHasher struct {
+	hasher  PasswordHasher
+	peppers Keyring
+}
+
+// NewPepperedHasher returns a PepperedHasher using the current key in peppers for new hashes.
+func NewPepperedHasher(hasher PasswordHasher, peppers Keyring) PepperedHasher {
+	return PepperedHasher{hasher: hasher, peppers: peppers}
+}
+
+// Hash returns the hash of password with the current pepper, prefixed with the pepper's ID.
+func (ph PepperedHasher) Hash(password string) (string, error) {
+	pepper, _ := ph.peppers.Key(ph.peppers.Current)
+	hash, err := ph.hasher.Hash(password + string(pepper))
+	if err != nil {
+		return "", err
+	}
+	return TagKeyID(ph.peppers.Current, hash), nil
+}
+
+// Compare reports whether password matches hash using the pepper it was made with.
+func (ph PepperedHasher) Compare(hash, password string) (bool, error) {
+	id, hash := SplitKeyID(hash)
+	pepper, ok := ph.peppers.Key(id)
+	if !ok {
+		return false, fmt.Errorf("Unknown pepper key ID %q", id)
+	}
+	return ph.hasher.Compare(hash, password+string(pepper))
+}
+
+// NeedsRehash reports whether hash was made with a retired pepper or outdated hasher settings.
+func (ph PepperedHasher) NeedsRehash(hash string) bool {
+	id, hash := SplitKeyID(hash)
+	return id != ph.peppers.Current || ph.hasher.NeedsRehash(hash)
+}
@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	cheap := Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	stronger := cheap
+	stronger.Iterations = 2
+
+	bcryptHash, _ := NewBcryptHasher(bcrypt.MinCost).Hash("password")
+	argonHash, _ := NewArgon2idHasher(cheap).Hash("password")
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Argon2id hash not encoded with its parameters: %s", argonHash)
+	}
+
+	tests := map[string]struct {
+		hasher     PasswordHasher
+		hash       string
+		password   string
+		wantMatch  bool
+		wantRehash bool
+	}{
+		"Bcrypt match":           {hasher: NewBcryptHasher(bcrypt.MinCost), hash: bcryptHash, password: "password", wantMatch: true},
+		"Bcrypt mismatch":        {hasher: NewBcryptHasher(bcrypt.MinCost), hash: bcryptHash, password: "passw0rd"},
+		"Bcrypt cost raised":     {hasher: NewBcryptHasher(bcrypt.MinCost + 1), hash: bcryptHash, password: "password", wantMatch: true, wantRehash: true},
+		"Argon2id match":         {hasher: NewArgon2idHasher(cheap), hash: argonHash, password: "password", wantMatch: true},
+		"Argon2id mismatch":      {hasher: NewArgon2idHasher(cheap), hash: argonHash, password: "passw0rd"},
+		"Argon2id params raised": {hasher: NewArgon2idHasher(stronger), hash: argonHash, password: "password", wantMatch: true, wantRehash: true},
+		"Bcrypt to Argon2id":     {hasher: NewArgon2idHasher(cheap), hash: bcryptHash, password: "password", wantMatch: true, wantRehash: true},
+		"Argon2id to Bcrypt":     {hasher: NewBcryptHasher(bcrypt.MinCost), hash: argonHash, password: "password", wantMatch: true, wantRehash: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			match, err := tc.hasher.Compare(tc.hash, tc.password)
+			if err != nil {
+				t.Fatalf("Compare: %v", err)
+			}
+			if match != tc.wantMatch {
+				t.Errorf("Got match %v, wanted %v", match, tc.wantMatch)
+			}
+			if rehash := tc.hasher.NeedsRehash(tc.hash); rehash != tc.wantRehash {
+				t.Errorf("Got rehash %v, wanted %v", rehash, tc.wantRehash)
+			}
+		})
+	}
+
+	if _, err := NewArgon2idHasher(cheap).Compare("$argon2id$v=19$m=1024$salt$key", "password"); err != ErrHashFormat {
+		t.Errorf("Got %v for a malformed hash, wanted %v", err, ErrHashFormat)
+	}
+}
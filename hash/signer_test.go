@@ -0,0 +1,48 @@
+package hash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testClaims struct {
+	UserID int `json:"uid"`
+}
+
+func TestSigner(t *testing.T) {
+	oldKeys, _ := NewKeyring("1", map[string]string{"1": "old-key"})
+	newKeys, _ := NewKeyring("2", map[string]string{"1": "old-key", "2": "new-key"})
+	retiredKeys, _ := NewKeyring("2", map[string]string{"2": "new-key"})
+
+	token, err := NewSigner(oldKeys).Sign(testClaims{UserID: 1})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + encodeSegment([]byte(`{"uid":2}`)) + "." + parts[2]
+
+	tests := map[string]struct {
+		want   error
+		signer Signer
+		token  string
+	}{
+		"Valid":            {want: nil, signer: NewSigner(oldKeys), token: token},
+		"Rotated key":      {want: nil, signer: NewSigner(newKeys), token: token},
+		"Retired key":      {want: ErrTokenInvalid, signer: NewSigner(retiredKeys), token: token},
+		"Tampered payload": {want: ErrTokenInvalid, signer: NewSigner(oldKeys), token: tampered},
+		"Malformed":        {want: ErrTokenInvalid, signer: NewSigner(oldKeys), token: "not.a-token"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var claims testClaims
+			err := tc.signer.Verify(tc.token, &claims)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Got %v, wanted %v", err, tc.want)
+			}
+			if err == nil && claims.UserID != 1 {
+				t.Errorf("Got user %d, wanted 1", claims.UserID)
+			}
+		})
+	}
+}
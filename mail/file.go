@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"goafweb/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileSender struct {
+	dir  string
+	host string
+}
+
+// NewFileSender returns a Sender that writes messages to dir as a Maildir instead of sending them.
+// Each message is a .eml file in dir/new, which mail clients can open.
+func NewFileSender(dir string) (Sender, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("Could not create maildir: %w", err)
+		}
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return &fileSender{dir: dir, host: host}, nil
+}
+
+// Send writes msg to dir/tmp then moves it to dir/new, so readers never see a partial message.
+func (fs *fileSender) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return permanent(fmt.Errorf("Could not format message: %w", err))
+	}
+	b, err := rand.Bytes(8)
+	if err != nil {
+		return fmt.Errorf("Could not name message: %w", err)
+	}
+	name := fmt.Sprintf("%d.%s.%s.eml", time.Now().UnixNano(), hex.EncodeToString(b), fs.host)
+	tmp := filepath.Join(fs.dir, "tmp", name)
+	if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+		return fmt.Errorf("Could not write message: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(fs.dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Could not write message: %w", err)
+	}
+	return nil
+}
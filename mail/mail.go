@@ -0,0 +1,156 @@
+/*
+Package mail renders the emails the app sends from templates and delivers them with a Sender.
+Senders are provided for Mailgun and SMTP, and for development a Maildir writer
+and an in-memory Recorder.
+*/
+package mail
+
+import (
+	"context"
+	"goafweb"
+	"log"
+	netmail "net/mail"
+	"net/url"
+)
+
+// Message is an email ready to be delivered.
+// HTML is optional, when set the email is sent with both a text and a HTML body.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers a Message, each mail backend implements it.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type mailService struct {
+	sender     Sender
+	templates  *Templates
+	deliveries goafweb.DeliveryService
+}
+
+// NewMailService returns a goafweb.MailService that renders the apps emails from templates
+// and delivers them with sender.
+// Nothing is sent to addresses deliveries reports as suppressed, it can be nil to send to every address.
+func NewMailService(sender Sender, templates *Templates, deliveries goafweb.DeliveryService) goafweb.MailService {
+	return &mailService{
+		sender:     sender,
+		templates:  templates,
+		deliveries: deliveries,
+	}
+}
+
+// Names of the templates for the emails the app sends.
+const (
+	resetPWTemplate     = "reset_password"
+	verifyEmailTemplate = "verify_email"
+)
+
+// linkData is the data for emails containing a link with a token,
+// the token is also shown in case the link can't be followed.
+type linkData struct {
+	URL   string
+	Token string
+}
+
+// ResetPW sends a reset token to the user provided email address.
+func (ms *mailService) ResetPw(ctx context.Context, toEmail, token string) error {
+	return ms.send(ctx, toEmail, resetPWTemplate, ms.linkData("/reset", token))
+}
+
+// VerifyEmail sends an email verification token to the user provided email address.
+func (ms *mailService) VerifyEmail(ctx context.Context, toEmail, token string) error {
+	return ms.send(ctx, toEmail, verifyEmailTemplate, ms.linkData("/verify", token))
+}
+
+// Render renders the named email template with data.
+func (ms *mailService) Render(name string, data interface{}) (*goafweb.Email, error) {
+	return ms.templates.Render(name, data)
+}
+
+// previewToken is the token shown in previews of emails containing a link with a token.
+const previewToken = "preview-token"
+
+// Templates lists the names of the email templates.
+func (ms *mailService) Templates() []string {
+	return ms.templates.Names()
+}
+
+// Preview renders the named email template with sample data.
+// Templates the app doesn't know about yet are given a link with a token, like most of its emails.
+func (ms *mailService) Preview(name string) (*goafweb.Email, error) {
+	return ms.templates.Render(name, ms.previewData(name))
+}
+
+// SendPreview sends the named email template, rendered with sample data, to toEmail
+// through the same sender as every other email.
+// Unlike other emails, sending to a suppressed address is an error so the admin knows it won't arrive.
+func (ms *mailService) SendPreview(ctx context.Context, name, toEmail string) error {
+	if _, err := netmail.ParseAddress(toEmail); err != nil {
+		return goafweb.Invalid(goafweb.ValidationErrors{"email": "Email address is not valid"})
+	}
+	if ms.deliveries != nil {
+		suppressed, err := ms.deliveries.Suppressed(ctx, toEmail)
+		if err != nil {
+			return err
+		}
+		if suppressed {
+			return goafweb.Invalid(goafweb.ValidationErrors{"email": "Email to this address has bounced, nothing more is sent to it"})
+		}
+	}
+	return ms.send(ctx, toEmail, name, ms.previewData(name))
+}
+
+// previewData returns the sample data the named template is previewed with.
+func (ms *mailService) previewData(name string) interface{} {
+	switch name {
+	case resetPWTemplate:
+		return ms.linkData("/reset", previewToken)
+	case verifyEmailTemplate:
+		return ms.linkData("/verify", previewToken)
+	default:
+		return ms.linkData("/", previewToken)
+	}
+}
+
+// linkData returns the link to path on the site, with token as a query parameter.
+func (ms *mailService) linkData(path, token string) linkData {
+	v := url.Values{}
+	v.Set("token", token)
+	return linkData{
+		URL:   ms.templates.brand.BaseURL + path + "?" + v.Encode(),
+		Token: token,
+	}
+}
+
+// send renders the named template with data and sends it to toEmail.
+// If toEmail is suppressed the email is dropped without an error, so callers respond the
+// same whether or not it was sent.
+func (ms *mailService) send(ctx context.Context, toEmail, name string, data interface{}) error {
+	if ms.deliveries != nil {
+		suppressed, err := ms.deliveries.Suppressed(ctx, toEmail)
+		if err != nil {
+			return err
+		}
+		if suppressed {
+			log.Printf("Not sending %s email to %s, the address is suppressed", name, toEmail)
+			return nil
+		}
+	}
+	email, err := ms.templates.Render(name, data)
+	if err != nil {
+		return err
+	}
+	return ms.sender.Send(ctx, &Message{
+		From:    ms.templates.brand.from(),
+		To:      toEmail,
+		Subject: email.Subject,
+		Text:    email.Text,
+		HTML:    email.HTML,
+	})
+}
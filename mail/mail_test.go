@@ -0,0 +1,304 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/storage/memory"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testBrand = Brand{
+	SenderName:    "Sam",
+	SenderAddress: "hello@example.com",
+	SiteName:      "Example & Co",
+	BaseURL:       "https://example.com",
+}
+
+func testTemplates(t *testing.T) *Templates {
+	t.Helper()
+	tmpls, err := NewTemplates("templates", testBrand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpls
+}
+
+func TestMailServiceRecorder(t *testing.T) {
+	rec := NewRecorder()
+	ms := NewMailService(rec, testTemplates(t), nil)
+	if err := ms.ResetPw(context.Background(), "user@example.com", "tok+en"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := rec.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("recorded %d messages, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.From != `"Sam" <hello@example.com>` || msg.To != "user@example.com" {
+		t.Errorf("unexpected addresses From %q To %q", msg.From, msg.To)
+	}
+	if msg.Subject != "Instructions for resetting your password." {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "https://example.com/reset?token=tok%2Ben") {
+		t.Errorf("reset link missing from text:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.Text, "Sam @ Example & Co") {
+		t.Errorf("signature missing from text:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, "Sam @ Example &amp; Co") {
+		t.Errorf("escaped signature missing from HTML:\n%s", msg.HTML)
+	}
+	rec.Reset()
+	if len(rec.Messages()) != 0 {
+		t.Error("Reset did not discard messages")
+	}
+}
+
+func TestMailServiceSuppressed(t *testing.T) {
+	ctx := context.Background()
+	ds := goafweb.NewDeliveryService(memory.NewDeliveryStatusDB(memory.NewDB()))
+	err := ds.RecordEvent(ctx, &goafweb.DeliveryEvent{
+		Type:      goafweb.DeliveryBounced,
+		Recipient: "gone@example.com",
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder()
+	ms := NewMailService(rec, testTemplates(t), ds)
+	for _, to := range []string{"gone@example.com", "user@example.com"} {
+		if err := ms.VerifyEmail(ctx, to, "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := rec.Messages()
+	if len(msgs) != 1 || msgs[0].To != "user@example.com" {
+		t.Errorf("got %d messages, wanted only the one to user@example.com", len(msgs))
+	}
+}
+
+func TestMailServicePreview(t *testing.T) {
+	ctx := context.Background()
+	ds := goafweb.NewDeliveryService(memory.NewDeliveryStatusDB(memory.NewDB()))
+	rec := NewRecorder()
+	ms := NewMailService(rec, testTemplates(t), ds)
+	if got := strings.Join(ms.Templates(), ","); got != "reset_password,verify_email" {
+		t.Errorf("Templates() = %s", got)
+	}
+	email, err := ms.Preview("verify_email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(email.Text, "https://example.com/verify?token=preview-token") || email.HTML == "" {
+		t.Errorf("preview is missing the sample link or HTML:\n%s", email.Text)
+	}
+	if _, err := ms.Preview("missing"); !errors.Is(err, goafweb.ErrTemplateNotFound) {
+		t.Errorf("Preview(missing): got %v, wanted %v", err, goafweb.ErrTemplateNotFound)
+	}
+
+	if err := ms.SendPreview(ctx, "reset_password", "designer@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := rec.Messages()
+	if len(msgs) != 1 || msgs[0].To != "designer@example.com" || msgs[0].Subject != "Instructions for resetting your password." {
+		t.Fatalf("unexpected messages sent: %+v", msgs)
+	}
+	if err := ms.SendPreview(ctx, "missing", "designer@example.com"); !errors.Is(err, goafweb.ErrTemplateNotFound) {
+		t.Errorf("SendPreview(missing): got %v, wanted %v", err, goafweb.ErrTemplateNotFound)
+	}
+	if err := ms.SendPreview(ctx, "reset_password", "not an address"); !errors.Is(err, goafweb.ErrInvalid) {
+		t.Errorf("SendPreview to an invalid address: got %v, wanted %v", err, goafweb.ErrInvalid)
+	}
+	ev := &goafweb.DeliveryEvent{Type: goafweb.DeliveryBounced, Recipient: "gone@example.com", Timestamp: time.Now()}
+	if err := ds.RecordEvent(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SendPreview(ctx, "reset_password", "gone@example.com"); !errors.Is(err, goafweb.ErrInvalid) {
+		t.Errorf("SendPreview to a suppressed address: got %v, wanted %v", err, goafweb.ErrInvalid)
+	}
+	if len(rec.Messages()) != 1 {
+		t.Errorf("sent %d messages, wanted 1", len(rec.Messages()))
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpls := testTemplates(t)
+	email, err := tmpls.Render("verify_email", linkData{URL: "https://example.com/verify?token=a", Token: "<b>a</b>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Please verify your email address." {
+		t.Errorf("Subject = %q", email.Subject)
+	}
+	if !strings.Contains(email.Text, "<b>a</b>") {
+		t.Errorf("text should not be escaped:\n%s", email.Text)
+	}
+	if strings.Contains(email.HTML, "<b>a</b>") || !strings.Contains(email.HTML, "&lt;b&gt;a&lt;/b&gt;") {
+		t.Errorf("HTML should be escaped:\n%s", email.HTML)
+	}
+	if !strings.Contains(email.HTML, "<title>Please verify your email address.</title>") {
+		t.Errorf("subject missing from HTML title:\n%s", email.HTML)
+	}
+	if _, err := tmpls.Render("missing", nil); !errors.Is(err, goafweb.ErrTemplateNotFound) {
+		t.Errorf("Render of unknown template returned %v, want ErrTemplateNotFound", err)
+	}
+}
+
+// checkMessage parses raw as an email and checks both bodies of msg survived the encoding.
+func checkMessage(t *testing.T, raw []byte, msg *Message) {
+	t.Helper()
+	m, err := netmail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("could not parse message: %v", err)
+	}
+	var dec mime.WordDecoder
+	if subject, _ := dec.DecodeHeader(m.Header.Get("Subject")); subject != msg.Subject {
+		t.Errorf("Subject = %q, want %q", subject, msg.Subject)
+	}
+	if m.Header.Get("Message-ID") == "" || m.Header.Get("Date") == "" {
+		t.Error("Message-ID and Date must be set")
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", m.Header.Get("Content-Type"))
+	}
+	// The multipart reader decodes quoted-printable parts.
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for _, want := range []string{msg.Text, msg.HTML} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(part)
+		if got := strings.Replace(string(b), "\r\n", "\n", -1); got != want {
+			t.Errorf("part = %q, want %q", got, want)
+		}
+	}
+}
+
+var testMessage = &Message{
+	From:    "Leanne <support@example.com>",
+	To:      "user@example.com",
+	Subject: "Héllo – a subject",
+	Text:    "Line one\nA long line " + strings.Repeat("that needs wrapping ", 10) + "\nCafé = 1",
+	HTML:    `<a href="https://example.com/?a=1&b=2">link</a>`,
+}
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fs, err := NewFileSender(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("found %d messages in new, want 1", len(files))
+	}
+	if tmp, _ := ioutil.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Errorf("tmp should be empty, found %d files", len(tmp))
+	}
+	raw, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessage(t, raw, testMessage)
+}
+
+// fakeSMTP accepts one connection and answers each command with a success reply,
+// it sends the envelope and data it received on the returned channel.
+func fakeSMTP(t *testing.T) (string, int, <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan []string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var lines []string
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				break
+			}
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 8BITMIME")
+			case line == "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := tp.ReadDotLines()
+				lines = append(lines, strings.Join(data, "\r\n"))
+				tp.PrintfLine("250 ok")
+			case line == "QUIT":
+				tp.PrintfLine("221 bye")
+				got <- lines
+				return
+			default:
+				lines = append(lines, line)
+				tp.PrintfLine("250 ok")
+			}
+		}
+		got <- lines
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, got
+}
+
+func TestSMTPSender(t *testing.T) {
+	host, port, got := fakeSMTP(t)
+	ss := NewSMTPSender(SMTPConfig{Host: host, Port: port})
+	if err := ss.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	lines := <-got
+	if len(lines) != 3 {
+		t.Fatalf("server received %q, want MAIL, RCPT and DATA", lines)
+	}
+	if lines[0] != "MAIL FROM:<support@example.com> BODY=8BITMIME" {
+		t.Errorf("MAIL = %q", lines[0])
+	}
+	if lines[1] != "RCPT TO:<user@example.com>" {
+		t.Errorf("RCPT = %q", lines[1])
+	}
+	checkMessage(t, []byte(lines[2]), testMessage)
+}
+
+func TestSMTPSenderRequireTLS(t *testing.T) {
+	host, port, got := fakeSMTP(t)
+	ss := NewSMTPSender(SMTPConfig{Host: host, Port: port, RequireTLS: true})
+	if err := ss.Send(context.Background(), testMessage); err == nil {
+		t.Fatal("expected an error when the server does not offer STARTTLS")
+	}
+	if lines := <-got; len(lines) != 0 {
+		t.Errorf("nothing should be sent without TLS, server received %q", lines)
+	}
+}
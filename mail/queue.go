@@ -0,0 +1,233 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goafweb"
+	"log"
+	"sync"
+	"time"
+)
+
+// QueueConfig configures how a Queue delivers messages.
+type QueueConfig struct {
+	// Workers is how many messages are delivered at once.
+	Workers int
+	// PollInterval is how long an idle worker waits before checking for due messages again.
+	PollInterval time.Duration
+	// MaxAttempts is how many times a message is tried before it is dead.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, each retry after waits twice as long up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// SendTimeout limits a single delivery, messages are leased to a worker for this long.
+	SendTimeout time.Duration
+}
+
+// DefaultQueueConfig returns the QueueConfig used for anything not set.
+// A message is tried 8 times over roughly an hour before it is dead.
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Workers:      4,
+		PollInterval: 2 * time.Second,
+		MaxAttempts:  8,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     time.Hour,
+		SendTimeout:  time.Minute,
+	}
+}
+
+// Queue is an outbox for email, it fulfils goafweb.MailQueue.
+// Sending a message to the Queue saves it in the OutboxDB, with the transaction in ctx if there
+// is one, and the workers started by Run deliver it with the Sender afterwards.
+// Failed deliveries are retried with exponential backoff, a message that fails permanently or
+// too many times is dead and only tried again if an admin retries it.
+type Queue struct {
+	outbox goafweb.OutboxDB
+	sender Sender
+	cfg    QueueConfig
+}
+
+// NewQueue returns a Queue that delivers the messages in outbox with sender.
+// Any setting in cfg that isn't positive takes its value from DefaultQueueConfig.
+func NewQueue(outbox goafweb.OutboxDB, sender Sender, cfg QueueConfig) *Queue {
+	def := DefaultQueueConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = def.BaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = def.MaxDelay
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = def.SendTimeout
+	}
+	return &Queue{
+		outbox: outbox,
+		sender: sender,
+		cfg:    cfg,
+	}
+}
+
+// Send queues msg to be delivered.
+func (q *Queue) Send(ctx context.Context, msg *Message) error {
+	om := goafweb.OutboxMessage{
+		From:          msg.From,
+		To:            msg.To,
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		Status:        goafweb.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := q.outbox.Create(ctx, &om); err != nil {
+		return fmt.Errorf("Could not queue email: %w", err)
+	}
+	return nil
+}
+
+// Run delivers queued messages until ctx is done, then waits for deliveries in progress to finish.
+// Several processes can Run against the same OutboxDB, each message is only claimed by one of them.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work delivers messages one at a time, waiting for the PollInterval whenever none are due.
+func (q *Queue) work(ctx context.Context) {
+	for {
+		delivered, err := q.deliverNext(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Mail queue error: %v", err)
+		}
+		if delivered {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+// deliverNext claims the next due message and tries to deliver it.
+// It reports whether there was a message to deliver.
+func (q *Queue) deliverNext(ctx context.Context) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+	msgs, err := q.outbox.Claim(ctx, time.Now(), q.cfg.SendTimeout, 1)
+	if err != nil {
+		return false, fmt.Errorf("Could not claim message: %w", err)
+	}
+	if len(msgs) == 0 {
+		return false, nil
+	}
+	return true, q.deliver(msgs[0])
+}
+
+// deliver sends msg and records the result.
+// It isn't stopped by Run's ctx, so a message being sent at shutdown is not left half delivered.
+func (q *Queue) deliver(msg *goafweb.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.SendTimeout)
+	defer cancel()
+	err := q.sender.Send(ctx, &Message{
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+	})
+	now := time.Now()
+	switch {
+	case err == nil:
+		msg.Status, msg.SentAt, msg.LastError = goafweb.OutboxSent, &now, ""
+		// The bodies can contain tokens, so aren't kept once they are no longer needed.
+		msg.Text, msg.HTML = "", ""
+	case isPermanent(err) || msg.Attempts >= q.cfg.MaxAttempts:
+		msg.Status, msg.LastError = goafweb.OutboxDead, err.Error()
+		log.Printf("Mail queue: message %d to %s is dead after %d attempts: %v", msg.ID, msg.To, msg.Attempts, err)
+	default:
+		msg.NextAttemptAt, msg.LastError = now.Add(q.backoff(msg.Attempts)), err.Error()
+	}
+	// If this fails the lease runs out and the message is tried again.
+	if err := q.outbox.Update(ctx, msg); err != nil {
+		return fmt.Errorf("Could not record delivery of message %d: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// backoff returns how long to wait before the next attempt after the given number of attempts.
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.cfg.BaseDelay
+	for i := 1; i < attempts && delay < q.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxDelay {
+		delay = q.cfg.MaxDelay
+	}
+	return delay
+}
+
+// List returns up to limit messages with status, newest first, or with any status if it is empty.
+func (q *Queue) List(ctx context.Context, status string, limit int) ([]*goafweb.OutboxMessage, error) {
+	return q.outbox.List(ctx, status, limit)
+}
+
+// Retry queues a pending or dead message to be delivered again straight away, with its attempts reset.
+func (q *Queue) Retry(ctx context.Context, id int) (*goafweb.OutboxMessage, error) {
+	msg, err := q.outbox.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retreive message: %w", err)
+	}
+	if msg.Status == goafweb.OutboxSent {
+		return nil, goafweb.ErrMessageSent
+	}
+	msg.Status, msg.Attempts, msg.NextAttemptAt = goafweb.OutboxPending, 0, time.Now()
+	if err := q.outbox.Update(ctx, msg); err != nil {
+		return nil, fmt.Errorf("Could not retry message: %w", err)
+	}
+	return msg, nil
+}
+
+// PermanentError is a delivery failure that trying again won't fix, i.e. an address the mail server
+// rejected. The Queue doesn't retry messages that fail with one.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// permanent marks err as a PermanentError.
+func permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// isPermanent reports whether err is or wraps a PermanentError.
+func isPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
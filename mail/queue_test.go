@@ -0,0 +1,151 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/storage/memory"
+	"testing"
+	"time"
+)
+
+// senderFunc adapts a func to a Sender.
+type senderFunc func(ctx context.Context, msg *Message) error
+
+func (f senderFunc) Send(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+var queuedMessage = &Message{
+	From:    "Sam <hello@example.com>",
+	To:      "user@example.com",
+	Subject: "Subject",
+	Text:    "token",
+	HTML:    "<p>token</p>",
+}
+
+// newTestQueue returns a Queue over an empty memory outbox, and the outbox.
+func newTestQueue(sender Sender) (*Queue, goafweb.OutboxDB) {
+	outbox := memory.NewOutboxDB(memory.NewDB())
+	return NewQueue(outbox, sender, QueueConfig{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: 3 * time.Minute}), outbox
+}
+
+func TestQueueTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	q := NewQueue(memory.NewOutboxDB(db), NewRecorder(), QueueConfig{})
+	failed := errors.New("the change failed")
+	err := db.InTx(ctx, func(ctx context.Context) error {
+		if err := q.Send(ctx, queuedMessage); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("InTx: got %v, wanted %v", err, failed)
+	}
+	if msgs, _ := q.List(ctx, "", 10); len(msgs) != 0 {
+		t.Errorf("message was queued by a transaction that rolled back: %+v", msgs)
+	}
+}
+
+func TestQueueDeliver(t *testing.T) {
+	ctx := context.Background()
+	rec := NewRecorder()
+	q, outbox := newTestQueue(rec)
+	if err := q.Send(ctx, queuedMessage); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Messages()) != 0 {
+		t.Fatal("Send should only queue the message")
+	}
+	if delivered, err := q.deliverNext(ctx); !delivered || err != nil {
+		t.Fatalf("deliverNext: got %v, %v", delivered, err)
+	}
+	if msgs := rec.Messages(); len(msgs) != 1 || msgs[0] != *queuedMessage {
+		t.Errorf("sender got %+v, wanted the queued message", msgs)
+	}
+	msg, _ := outbox.GetByID(ctx, 1)
+	if msg.Status != goafweb.OutboxSent || msg.SentAt == nil || msg.Text != "" || msg.HTML != "" {
+		t.Errorf("sent message should be marked sent with its bodies cleared: %+v", msg)
+	}
+	if delivered, _ := q.deliverNext(ctx); delivered {
+		t.Error("a sent message was delivered again")
+	}
+	if _, err := q.Retry(ctx, 1); !errors.Is(err, goafweb.ErrMessageSent) {
+		t.Errorf("Retry of a sent message: got %v, wanted %v", err, goafweb.ErrMessageSent)
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	ctx := context.Background()
+	failures := 0
+	q, outbox := newTestQueue(senderFunc(func(ctx context.Context, msg *Message) error {
+		failures++
+		return errors.New("connection refused")
+	}))
+	if err := q.Send(ctx, queuedMessage); err != nil {
+		t.Fatal(err)
+	}
+	q.deliverNext(ctx)
+	msg, _ := outbox.GetByID(ctx, 1)
+	if msg.Status != goafweb.OutboxPending || msg.Attempts != 1 || msg.LastError != "connection refused" {
+		t.Fatalf("message should be pending after a failure: %+v", msg)
+	}
+	if wait := time.Until(msg.NextAttemptAt); wait < 59*time.Second || wait > time.Minute {
+		t.Errorf("first retry in %v, wanted BaseDelay", wait)
+	}
+	if delivered, _ := q.deliverNext(ctx); delivered {
+		t.Error("message was retried before its backoff")
+	}
+
+	// Make it due again until it runs out of attempts.
+	for attempt := 2; attempt <= 3; attempt++ {
+		msg.NextAttemptAt = time.Now()
+		outbox.Update(ctx, msg)
+		q.deliverNext(ctx)
+		msg, _ = outbox.GetByID(ctx, 1)
+	}
+	if msg.Status != goafweb.OutboxDead || msg.Attempts != 3 || failures != 3 {
+		t.Fatalf("message should be dead after 3 attempts: %+v, %d failures", msg, failures)
+	}
+	if dead, _ := q.List(ctx, goafweb.OutboxDead, 10); len(dead) != 1 {
+		t.Errorf("List dead: got %d messages, wanted 1", len(dead))
+	}
+
+	msg, err := q.Retry(ctx, 1)
+	if err != nil || msg.Status != goafweb.OutboxPending || msg.Attempts != 0 {
+		t.Fatalf("Retry: got %+v, %v", msg, err)
+	}
+	if delivered, _ := q.deliverNext(ctx); !delivered || failures != 4 {
+		t.Error("a retried message should be delivered straight away")
+	}
+}
+
+func TestQueuePermanentFailure(t *testing.T) {
+	ctx := context.Background()
+	q, outbox := newTestQueue(senderFunc(func(ctx context.Context, msg *Message) error {
+		return permanent(errors.New("no such user"))
+	}))
+	if err := q.Send(ctx, queuedMessage); err != nil {
+		t.Fatal(err)
+	}
+	q.deliverNext(ctx)
+	if msg, _ := outbox.GetByID(ctx, 1); msg.Status != goafweb.OutboxDead || msg.Attempts != 1 {
+		t.Errorf("message should be dead after a permanent failure: %+v", msg)
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q, _ := newTestQueue(NewRecorder())
+	for attempts, want := range map[int]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 3 * time.Minute,
+		9: 3 * time.Minute,
+	} {
+		if got := q.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, wanted %v", attempts, got, want)
+		}
+	}
+}
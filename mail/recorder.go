@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder is a Sender that keeps messages in memory instead of sending them,
+// so tests can check what would have been sent.
+type Recorder struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Send records a copy of msg.
+func (r *Recorder) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, *msg)
+	return nil
+}
+
+// Messages returns every message recorded so far, oldest first.
+func (r *Recorder) Messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.messages...)
+}
+
+// Reset discards the recorded messages.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = nil
+}
@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout limits how long delivering a message may take when ctx has no deadline.
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig describes how to reach an SMTP server.
+// With ImplicitTLS the connection is TLS from the start, as on port 465, otherwise it is upgraded
+// with STARTTLS whenever the server offers it. RequireTLS refuses to send if it doesn't.
+// Username and Password are sent with AUTH PLAIN, which is only done over TLS.
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	ImplicitTLS bool
+	RequireTLS  bool
+	// TLSConfig is used for TLS connections, when nil one for Host is used.
+	TLSConfig *tls.Config
+}
+
+type smtpSender struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPSender returns a Sender that delivers messages to the SMTP server in cfg.
+func NewSMTPSender(cfg SMTPConfig) Sender {
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{ServerName: cfg.Host}
+	}
+	return &smtpSender{cfg: cfg}
+}
+
+var errNoTLS = errors.New("SMTP Error: server does not support STARTTLS")
+
+// Send delivers msg over a new connection to the server.
+// Invalid addresses and messages the server rejects with a 5xx reply are PermanentErrors.
+func (ss *smtpSender) Send(ctx context.Context, msg *Message) error {
+	from, err := netmail.ParseAddress(msg.From)
+	if err != nil {
+		return permanent(fmt.Errorf("Invalid from address: %w", err))
+	}
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return permanent(fmt.Errorf("Invalid to address: %w", err))
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return permanent(fmt.Errorf("Could not format message: %w", err))
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+	c, err := ss.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("SMTP Error, could not connect: %w", err)
+	}
+	defer c.Close()
+	if err := ss.send(c, from.Address, to.Address, body); err != nil {
+		err = fmt.Errorf("SMTP Error, could not send: %w", err)
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// dial connects to the server, the connection is closed if ctx is done before it is.
+func (ss *smtpSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(ss.cfg.Host, strconv.Itoa(ss.cfg.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	if ss.cfg.ImplicitTLS {
+		conn = tls.Client(conn, ss.cfg.TLSConfig)
+	}
+	c, err := smtp.NewClient(conn, ss.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// send runs the SMTP conversation for one message.
+func (ss *smtpSender) send(c *smtp.Client, from, to string, body []byte) error {
+	if !ss.cfg.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(ss.cfg.TLSConfig); err != nil {
+				return err
+			}
+		} else if ss.cfg.RequireTLS {
+			return errNoTLS
+		}
+	}
+	if ss.cfg.Username != "" {
+		// PlainAuth refuses to send the password unless the connection is TLS or to localhost.
+		auth := smtp.PlainAuth("", ss.cfg.Username, ss.cfg.Password, ss.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,132 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"goafweb"
+	htmltemplate "html/template"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Brand is what the emails say about the site sending them.
+type Brand struct {
+	SenderName    string
+	SenderAddress string
+	SiteName      string
+	// BaseURL is where links in emails point, without a trailing slash.
+	BaseURL string
+}
+
+// from is the From header for emails sent as the Brand.
+func (b Brand) from() string {
+	return (&netmail.Address{Name: b.SenderName, Address: b.SenderAddress}).String()
+}
+
+// Templates renders emails from a directory of templates.
+// Every email has a text/template file, name.txt, and can have a html/template file, name.html.
+// Each defines a "content" template which is rendered inside layout.txt and layout.html,
+// name.txt also defines a "subject" template. Templates are executed with the Brand,
+// the Subject and the data for the email as Data.
+type Templates struct {
+	brand Brand
+	text  map[string]*texttemplate.Template
+	html  map[string]*htmltemplate.Template
+}
+
+// templateData is what templates are executed with.
+type templateData struct {
+	Brand   Brand
+	Subject string
+	Data    interface{}
+}
+
+// NewTemplates parses every template in dir.
+func NewTemplates(dir string, brand Brand) (*Templates, error) {
+	textLayout, err := texttemplate.ParseFiles(filepath.Join(dir, "layout.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse text layout: %w", err)
+	}
+	htmlLayout, err := htmltemplate.ParseFiles(filepath.Join(dir, "layout.html"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse HTML layout: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{
+		brand: brand,
+		text:  make(map[string]*texttemplate.Template),
+		html:  make(map[string]*htmltemplate.Template),
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		if name == "layout" {
+			continue
+		}
+		tt, err := texttemplate.Must(textLayout.Clone()).ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse %s: %w", file, err)
+		}
+		if tt.Lookup("subject") == nil {
+			return nil, fmt.Errorf("Could not parse %s: no subject template", file)
+		}
+		t.text[name] = tt
+
+		htmlFile := filepath.Join(dir, name+".html")
+		if _, err := os.Stat(htmlFile); os.IsNotExist(err) {
+			continue
+		}
+		ht, err := htmltemplate.Must(htmlLayout.Clone()).ParseFiles(htmlFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse %s: %w", htmlFile, err)
+		}
+		t.html[name] = ht
+	}
+	return t, nil
+}
+
+// Names returns the names of the emails there are templates for, sorted.
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.text))
+	for name := range t.text {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render renders the named email with data.
+// It returns goafweb.ErrTemplateNotFound if there is no template with that name.
+func (t *Templates) Render(name string, data interface{}) (*goafweb.Email, error) {
+	tt, ok := t.text[name]
+	if !ok {
+		return nil, fmt.Errorf("Could not render %q: %w", name, goafweb.ErrTemplateNotFound)
+	}
+	td := templateData{Brand: t.brand, Data: data}
+	var buf bytes.Buffer
+	if err := tt.ExecuteTemplate(&buf, "subject", td); err != nil {
+		return nil, fmt.Errorf("Could not render %q subject: %w", name, err)
+	}
+	td.Subject = strings.TrimSpace(buf.String())
+	email := goafweb.Email{Subject: td.Subject}
+
+	buf.Reset()
+	if err := tt.ExecuteTemplate(&buf, "layout.txt", td); err != nil {
+		return nil, fmt.Errorf("Could not render %q text: %w", name, err)
+	}
+	email.Text = buf.String()
+	if ht, ok := t.html[name]; ok {
+		buf.Reset()
+		if err := ht.ExecuteTemplate(&buf, "layout.html", td); err != nil {
+			return nil, fmt.Errorf("Could not render %q HTML: %w", name, err)
+		}
+		email.HTML = buf.String()
+	}
+	return &email, nil
+}
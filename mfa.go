@@ -0,0 +1,255 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goafweb/rand"
+	"goafweb/totp"
+	"strings"
+	"time"
+)
+
+const (
+	// mfaChallengeTTL is how long a User has to enter their code after their password is accepted.
+	mfaChallengeTTL = 5 * time.Minute
+	// totpSkew is how many time steps either side of now a code is accepted, to allow for clock drift.
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes are issued when two factor authentication is enabled.
+	recoveryCodeCount = 10
+)
+
+// TOTPEnrollment holds the details a User needs to add their account to an authenticator app.
+// The Secret is only shown once, when enrolling, it is stored encrypted.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// SecretCipher defines how secrets the app needs to read back are encrypted at rest.
+type SecretCipher interface {
+	Encrypt(plaintext []byte) (string, error)
+	Decrypt(ciphertext string) ([]byte, error)
+}
+
+// UserServiceOpt configures optional features of the UserService.
+type UserServiceOpt func(us *userService)
+
+// WithTOTP enables two factor authentication.
+// The issuer is shown next to the account in authenticator apps and the cipher encrypts TOTP secrets.
+func WithTOTP(issuer string, cipher SecretCipher) UserServiceOpt {
+	return func(us *userService) {
+		us.totpIssuer = issuer
+		us.totpCipher = cipher
+	}
+}
+
+// EnrollTOTP starts enabling two factor authentication for the User by generating a new secret.
+// Two factor authentication is not enabled until a code from the secret is confirmed with ConfirmTOTP.
+func (us *userService) EnrollTOTP(ctx context.Context, userID int) (*TOTPEnrollment, error) {
+	if us.totpCipher == nil {
+		return nil, ErrMFANotConfigured
+	}
+	user, err := us.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retreive user: %w", err)
+	}
+	if user.TOTPEnabled() {
+		return nil, ErrMFAEnabled
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, fmt.Errorf("Could not generate secret: %w", err)
+	}
+	if user.TOTPSecret, err = us.totpCipher.Encrypt(secret); err != nil {
+		return nil, fmt.Errorf("Could not encrypt secret: %w", err)
+	}
+	if err := us.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("Could not save secret: %w", err)
+	}
+	return &TOTPEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(us.totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two factor authentication once the User proves their app is set up by providing a code.
+// Returns the Users recovery codes, these are only available now as only their hashes are stored.
+// Two factor authentication is only enabled if all of the recovery codes are saved.
+func (us *userService) ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error) {
+	user, err := us.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retreive user: %w", err)
+	}
+	if user.TOTPEnabled() {
+		return nil, ErrMFAEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	var codes []string
+	err = us.inTx(ctx, func(ctx context.Context) error {
+		if err := us.checkTOTP(ctx, user, code); err != nil {
+			return err
+		}
+		now := us.now()
+		user.TOTPEnabledAt = &now
+		if err := us.Update(ctx, user); err != nil {
+			return fmt.Errorf("Could not enable two factor authentication: %w", err)
+		}
+		codes, err = us.newRecoveryCodes(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns off two factor authentication, it needs a current code or recovery code.
+func (us *userService) DisableTOTP(ctx context.Context, userID int, code string) error {
+	user, err := us.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("Could not retreive user: %w", err)
+	}
+	if !user.TOTPEnabled() {
+		return ErrMFANotEnabled
+	}
+	return us.inTx(ctx, func(ctx context.Context) error {
+		if err := us.verifySecondFactor(ctx, user, code); err != nil {
+			return err
+		}
+		user.TOTPSecret = ""
+		user.TOTPEnabledAt = nil
+		user.TOTPLastStep = 0
+		if err := us.Update(ctx, user); err != nil {
+			return fmt.Errorf("Could not disable two factor authentication: %w", err)
+		}
+		return us.recoveryDB.DeleteByUser(ctx, user.ID)
+	})
+}
+
+// MFAChallenge issues a short lived token proving the User has passed the password step of logging in.
+// It must be presented to LoginMFA along with their code.
+func (us *userService) MFAChallenge(user *User) (string, error) {
+	now := us.now()
+	challenge, err := us.signer.Sign(AccessClaims{
+		Type:      tokenTypeMFA,
+		UserID:    user.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(mfaChallengeTTL).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Could not sign challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// LoginMFA completes logging in a User with two factor authentication enabled.
+// The code can be from their authenticator app or one of their recovery codes.
+// Failed codes are throttled in the same way as failed passwords in Authenticate.
+func (us *userService) LoginMFA(ctx context.Context, challenge, code, userAgent, ip string) (*TokenPair, error) {
+	claims, err := us.verifyClaims(challenge, tokenTypeMFA)
+	if err != nil {
+		return nil, err
+	}
+	user, err := us.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retreive user: %w", err)
+	}
+	// Codes are short, so guesses count towards the same lockout as passwords.
+	accountKey := loginAccountKey(user.Email)
+	if err := us.checkThrottle(ctx, accountKey, loginIPKey(ip)); err != nil {
+		return nil, err
+	}
+	if err := us.verifySecondFactor(ctx, user, code); err != nil {
+		if errors.Is(err, ErrMFAInvalid) {
+			if err := us.recordFailure(ctx, accountKey, us.lockout.MaxFailures); err != nil {
+				return nil, err
+			}
+			if err := us.recordFailure(ctx, loginIPKey(ip), us.lockout.IPMaxFailures); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	if err := us.clearThrottle(ctx, accountKey); err != nil {
+		return nil, err
+	}
+	return us.login(ctx, user, userAgent, ip)
+}
+
+// verifySecondFactor checks code is either a valid TOTP code or an unused recovery code.
+func (us *userService) verifySecondFactor(ctx context.Context, user *User, code string) error {
+	err := us.checkTOTP(ctx, user, code)
+	if err == nil || !errors.Is(err, ErrMFAInvalid) {
+		return err
+	}
+	rc, err := us.recoveryDB.GetByCode(ctx, user.ID, normalizeRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrMFAInvalid
+		}
+		return fmt.Errorf("Could not retreive recovery code: %w", err)
+	}
+	if err := us.recoveryDB.Use(ctx, rc); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrMFAInvalid
+		}
+		return fmt.Errorf("Could not use recovery code: %w", err)
+	}
+	return nil
+}
+
+// checkTOTP validates code against the Users secret, refusing a code that has already been used.
+func (us *userService) checkTOTP(ctx context.Context, user *User, code string) error {
+	if us.totpCipher == nil {
+		return ErrMFANotConfigured
+	}
+	secret, err := us.totpCipher.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return fmt.Errorf("Could not decrypt secret: %w", err)
+	}
+	step, ok := totp.Validate(secret, code, us.now(), totpSkew)
+	if !ok || step <= user.TOTPLastStep {
+		return ErrMFAInvalid
+	}
+	// The step is only recorded if it is still later than the last one used, so a code
+	// sent by two requests at once only works for one of them.
+	if err := us.UseTOTPStep(ctx, user, step); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrMFAInvalid
+		}
+		return fmt.Errorf("Could not save code use: %w", err)
+	}
+	return nil
+}
+
+// newRecoveryCodes replaces any existing recovery codes for the User with a new set.
+func (us *userService) newRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	if err := us.recoveryDB.DeleteByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("Could not remove recovery codes: %w", err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b, err := rand.Bytes(5)
+		if err != nil {
+			return nil, fmt.Errorf("Could not generate recovery code: %w", err)
+		}
+		// 5 bytes is exactly 8 base32 characters, shown as two groups of 4.
+		code := strings.ToLower(totp.EncodeSecret(b))
+		rc := RecoveryCode{UserID: userID, Code: code}
+		if err := us.recoveryDB.Create(ctx, &rc); err != nil {
+			return nil, fmt.Errorf("Could not store recovery code: %w", err)
+		}
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the formatting a User might include when typing a recovery code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.Replace(code, "-", "", -1)
+	return strings.Replace(code, " ", "", -1)
+}
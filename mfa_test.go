@@ -0,0 +1,258 @@
+package goafweb_test
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"goafweb"
+	"goafweb/encrypt"
+	"goafweb/totp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestMFAService returns a testUserService with two factor authentication enabled.
+func newTestMFAService(t *testing.T, opts ...goafweb.UserServiceOpt) *testUserService {
+	t.Helper()
+	cipher, err := encrypt.NewAESGCM("test-totp-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestUserService(t, append([]goafweb.UserServiceOpt{goafweb.WithTOTP("goafweb", cipher)}, opts...)...)
+}
+
+// enableTOTP enrolls user and confirms a code, returning their secret and recovery codes.
+// The code used to confirm is for the current time step, so the next code accepted is for the step after.
+func (us *testUserService) enableTOTP(t *testing.T, user *goafweb.User) ([]byte, []string) {
+	t.Helper()
+	ctx := context.Background()
+	enrollment, err := us.EnrollTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Decode secret: %v", err)
+	}
+	codes, err := us.ConfirmTOTP(ctx, user.ID, us.code(secret))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return secret, codes
+}
+
+// code returns the TOTP code for the current time step.
+func (us *testUserService) code(secret []byte) string {
+	return totp.Code(secret, totp.Step(us.clock.Now()))
+}
+
+// wrongCode returns a code that isn't valid at any step accepted now.
+func (us *testUserService) wrongCode(secret []byte) string {
+	step := totp.Step(us.clock.Now())
+	valid := strings.Join([]string{totp.Code(secret, step-1), totp.Code(secret, step), totp.Code(secret, step+1)}, " ")
+	for n := 0; ; n++ {
+		if code := fmt.Sprintf("%06d", n); !strings.Contains(valid, code) {
+			return code
+		}
+	}
+}
+
+func TestLoginMFA(t *testing.T) {
+	ctx := context.Background()
+	us := newTestMFAService(t)
+	user := us.createUser(t, "test@test.com")
+	secret, _ := us.enableTOTP(t, user)
+	if user, _ = us.GetByID(ctx, user.ID); !user.TOTPEnabled() {
+		t.Fatal("ConfirmTOTP did not enable two factor authentication")
+	}
+
+	if _, err := us.Login(ctx, user, "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrMFARequired) {
+		t.Fatalf("Login: got %v, wanted %v", err, goafweb.ErrMFARequired)
+	}
+	challenge, err := us.MFAChallenge(user)
+	if err != nil {
+		t.Fatalf("MFAChallenge: %v", err)
+	}
+	// The code used to confirm can't be used again.
+	if _, err := us.LoginMFA(ctx, challenge, us.code(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrMFAInvalid) {
+		t.Errorf("Replaying the confirmation code: got %v, wanted %v", err, goafweb.ErrMFAInvalid)
+	}
+	us.clock.Add(totp.Period)
+	code := us.code(secret)
+	tokens, err := us.LoginMFA(ctx, challenge, code, "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("LoginMFA: %v", err)
+	}
+	if claims, err := us.VerifyAccessToken(tokens.AccessToken); err != nil || claims.UserID != user.ID {
+		t.Errorf("VerifyAccessToken: got %+v, %v", claims, err)
+	}
+	if _, err := us.LoginMFA(ctx, challenge, code, "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrMFAInvalid) {
+		t.Errorf("Replaying a code: got %v, wanted %v", err, goafweb.ErrMFAInvalid)
+	}
+
+	// A challenge can't be used as an access token, nor the other way round.
+	if _, err := us.VerifyAccessToken(challenge); !errors.Is(err, goafweb.ErrTokenInvalid) {
+		t.Errorf("Challenge as an access token: got %v, wanted %v", err, goafweb.ErrTokenInvalid)
+	}
+	us.clock.Add(totp.Period)
+	if _, err := us.LoginMFA(ctx, tokens.AccessToken, us.code(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrTokenInvalid) {
+		t.Errorf("Access token as a challenge: got %v, wanted %v", err, goafweb.ErrTokenInvalid)
+	}
+	us.clock.Add(goafweb.MFAChallengeTTL)
+	if _, err := us.LoginMFA(ctx, challenge, us.code(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrTokenExpired) {
+		t.Errorf("Expired challenge: got %v, wanted %v", err, goafweb.ErrTokenExpired)
+	}
+}
+
+// Logins sending the same code at once must not all succeed.
+func TestLoginMFARace(t *testing.T) {
+	ctx := context.Background()
+	us := newTestMFAService(t)
+	user := us.createUser(t, "test@test.com")
+	secret, _ := us.enableTOTP(t, user)
+	for i := 0; i < 20; i++ {
+		us.clock.Add(totp.Period)
+		code := us.code(secret)
+		challenge, err := us.MFAChallenge(user)
+		if err != nil {
+			t.Fatalf("MFAChallenge: %v", err)
+		}
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		errs := make([]error, 8)
+		for j := range errs {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				<-start
+				_, errs[j] = us.LoginMFA(ctx, challenge, code, "agent", "127.0.0.1")
+			}(j)
+		}
+		close(start)
+		wg.Wait()
+		winners := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				winners++
+			case errors.Is(err, goafweb.ErrMFAInvalid):
+			default:
+				t.Fatalf("LoginMFA: %v", err)
+			}
+		}
+		if winners != 1 {
+			t.Fatalf("Got %d logins with the same code, wanted 1", winners)
+		}
+	}
+}
+
+func TestLoginMFAThrottled(t *testing.T) {
+	ctx := context.Background()
+	us := newTestMFAService(t, goafweb.WithLockout(goafweb.LockoutPolicy{
+		MaxFailures:   3,
+		IPMaxFailures: 100,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Minute,
+		LockDuration:  time.Hour,
+		Window:        time.Hour,
+	}))
+	user := us.createUser(t, "test@test.com")
+	secret, _ := us.enableTOTP(t, user)
+	us.clock.Add(totp.Period)
+	challenge, err := us.MFAChallenge(user)
+	if err != nil {
+		t.Fatalf("MFAChallenge: %v", err)
+	}
+
+	if _, err := us.LoginMFA(ctx, challenge, us.wrongCode(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrMFAInvalid) {
+		t.Fatalf("Wrong code: got %v, wanted %v", err, goafweb.ErrMFAInvalid)
+	}
+	// Even the right code has to wait after a wrong one.
+	if _, err := us.LoginMFA(ctx, challenge, us.code(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrRateLimited) {
+		t.Fatalf("Straight after a wrong code: got %v, wanted %v", err, goafweb.ErrRateLimited)
+	}
+	for i := 0; i < 2; i++ {
+		us.clock.Add(time.Minute)
+		if _, err := us.LoginMFA(ctx, challenge, us.wrongCode(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrMFAInvalid) {
+			t.Fatalf("Wrong code: got %v, wanted %v", err, goafweb.ErrMFAInvalid)
+		}
+	}
+	us.clock.Add(time.Minute)
+	challenge, _ = us.MFAChallenge(user)
+	if _, err := us.LoginMFA(ctx, challenge, us.code(secret), "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrLocked) {
+		t.Errorf("After %d wrong codes: got %v, wanted %v", 3, err, goafweb.ErrLocked)
+	}
+	// The lock is shared with password logins.
+	if _, err := us.Authenticate(ctx, user.Email, "password", "127.0.0.1"); !errors.Is(err, goafweb.ErrLocked) {
+		t.Errorf("Password login while locked: got %v, wanted %v", err, goafweb.ErrLocked)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	us := newTestMFAService(t)
+	user := us.createUser(t, "test@test.com")
+	_, codes := us.enableTOTP(t, user)
+	if len(codes) != goafweb.RecoveryCodeCount {
+		t.Fatalf("Got %d recovery codes, wanted %d", len(codes), goafweb.RecoveryCodeCount)
+	}
+	challenge, err := us.MFAChallenge(user)
+	if err != nil {
+		t.Fatalf("MFAChallenge: %v", err)
+	}
+
+	// Codes can be typed without their formatting.
+	typed := " " + strings.ToUpper(strings.Replace(codes[0], "-", " ", 1)) + " "
+	if _, err := us.LoginMFA(ctx, challenge, typed, "agent", "127.0.0.1"); err != nil {
+		t.Fatalf("LoginMFA with a recovery code: %v", err)
+	}
+	if _, err := us.LoginMFA(ctx, challenge, codes[0], "agent", "127.0.0.1"); !errors.Is(err, goafweb.ErrMFAInvalid) {
+		t.Errorf("Reusing a recovery code: got %v, wanted %v", err, goafweb.ErrMFAInvalid)
+	}
+	if _, err := us.LoginMFA(ctx, challenge, codes[1], "agent", "127.0.0.1"); err != nil {
+		t.Errorf("LoginMFA with another recovery code: %v", err)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	ctx := context.Background()
+	us := newTestMFAService(t)
+	user := us.createUser(t, "test@test.com")
+	secret, codes := us.enableTOTP(t, user)
+	us.clock.Add(totp.Period)
+
+	for _, code := range []string{us.wrongCode(secret), "aaaa-aaaa"} {
+		if err := us.DisableTOTP(ctx, user.ID, code); !errors.Is(err, goafweb.ErrMFAInvalid) {
+			t.Errorf("DisableTOTP with %q: got %v, wanted %v", code, err, goafweb.ErrMFAInvalid)
+		}
+	}
+	if got, _ := us.GetByID(ctx, user.ID); !got.TOTPEnabled() {
+		t.Fatal("DisableTOTP without a valid code disabled two factor authentication")
+	}
+	if err := us.DisableTOTP(ctx, user.ID, codes[0]); err != nil {
+		t.Fatalf("DisableTOTP with a recovery code: %v", err)
+	}
+	user, _ = us.GetByID(ctx, user.ID)
+	if user.TOTPEnabled() || user.TOTPSecret != "" {
+		t.Errorf("DisableTOTP left two factor authentication enabled: %+v", user)
+	}
+	if _, err := us.Login(ctx, user, "agent", "127.0.0.1"); err != nil {
+		t.Errorf("Login after DisableTOTP: %v", err)
+	}
+	if err := us.DisableTOTP(ctx, user.ID, us.code(secret)); !errors.Is(err, goafweb.ErrMFANotEnabled) {
+		t.Errorf("DisableTOTP again: got %v, wanted %v", err, goafweb.ErrMFANotEnabled)
+	}
+
+	// Enabling it again issues new recovery codes, the old ones are gone.
+	_, newCodes := us.enableTOTP(t, user)
+	us.clock.Add(totp.Period)
+	if err := us.DisableTOTP(ctx, user.ID, codes[1]); !errors.Is(err, goafweb.ErrMFAInvalid) {
+		t.Errorf("DisableTOTP with an old recovery code: got %v, wanted %v", err, goafweb.ErrMFAInvalid)
+	}
+	if err := us.DisableTOTP(ctx, user.ID, newCodes[0]); err != nil {
+		t.Errorf("DisableTOTP with a new recovery code: %v", err)
+	}
+}
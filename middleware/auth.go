@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"fmt"
 	"goafweb"
 	"goafweb/context"
+	"goafweb/problem"
 	"net/http"
 )
 
@@ -16,8 +18,8 @@ func NewAuthMW(us goafweb.UserService) *authMW {
 	}
 }
 
-// CheckUser will check the users http Cookies and then check to see if a user exists
-// in the database.  If it does, the User is added to the request Context.
+// CheckUser will check the users http Cookies and then check to see if a session exists
+// in the database.  If it does, the User, their Session and permissions are added to the request Context.
 func (mw *authMW) CheckUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rememberCookie, err := r.Cookie("rememberToken")
@@ -25,27 +27,59 @@ func (mw *authMW) CheckUser(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		user, err := mw.UserService.GetByRemember(rememberCookie.Value)
+		user, session, err := mw.UserService.UserBySession(r.Context(), rememberCookie.Value)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
-		r = r.WithContext(context.WithUser(r.Context(), user))
+		perms, err := mw.UserService.Permissions(r.Context(), user.ID)
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("Could not load permissions: %w", err))
+			return
+		}
+		ctx := context.WithUser(r.Context(), user)
+		ctx = context.WithSession(ctx, session)
+		r = r.WithContext(context.WithPermissions(ctx, perms))
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-// RequireUser will check that a user is set in the request context.
+// RequireUser will check that a user is set in the request context, and that they meet any opts.
 // It if is, the requested handler will be called.
 // If not,  the server responsds with a redirect to the login page and further execution is stopped.
-func (mw *authMW) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+// If the user fails one of the opts the server responds with http.StatusForbidden.
+func (mw *authMW) RequireUser(next http.HandlerFunc, opts ...UserOpt) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := context.GetUser(r.Context())
 
 		if user == nil {
 			http.Redirect(w, r, "/login", http.StatusUnauthorized)
+			return
+		}
+		for _, opt := range opts {
+			if err := opt(user); err != nil {
+				problem.Write(w, r, err)
+				return
+			}
 		}
 		next(w, r)
 	}
 }
+
+// RequirePermission returns middleware that checks the user in the request context holds perm.
+// If they do, the requested handler will be called.
+// If there is no user they are redirected to the login page, if they lack the permission
+// the server responds with http.StatusForbidden, and further execution is stopped.
+// opts are checked as they are by RequireUser, so the handler needn't be wrapped in it as well.
+func (mw *authMW) RequirePermission(perm string, opts ...UserOpt) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return mw.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+			if !context.GetPermissions(r.Context()).Has(perm) {
+				problem.Write(w, r, goafweb.ErrForbidden)
+				return
+			}
+			next(w, r)
+		}, opts...)
+	}
+}
@@ -2,6 +2,7 @@
 Package middleware defines fuctions to be run on entry to the app, before the requested
 endpoint is called.
 It will generally either:
+
 	a) move the end user onto the requested endpoint
 	b) stop execution, usually with an error http.Statuscode.
 */
@@ -10,14 +11,29 @@ package middleware
 import (
 	"goafweb"
 	"goafweb/context"
+	"goafweb/problem"
 	"net/http"
 	"strings"
 )
 
 type AuthMW interface {
 	CheckUser(next http.Handler) http.Handler
-	RequireUser(next http.HandlerFunc) http.HandlerFunc
+	RequireUser(next http.HandlerFunc, opts ...UserOpt) http.HandlerFunc
+	RequirePermission(perm string, opts ...UserOpt) func(next http.HandlerFunc) http.HandlerFunc
+}
+
+// UserOpt adds a further condition the user must meet to pass RequireUser.
+// It returns an error describing why the user was refused, or nil if they meet the condition.
+type UserOpt func(user *goafweb.User) error
+
+// VerifiedEmail is a UserOpt requiring the user to have verified their email address.
+func VerifiedEmail(user *goafweb.User) error {
+	if !user.Verified() {
+		return goafweb.ErrEmailUnverified
+	}
+	return nil
 }
+
 type jsonAuthMW struct {
 	UserService goafweb.UserService
 }
@@ -28,8 +44,10 @@ func NewJsonAuthMW(us goafweb.UserService) *jsonAuthMW {
 	}
 }
 
-// CheckUser will check the users Authorization header and then check to see if a user exists
-// in the database.  If it does, the User is added to the request Context.
+// CheckUser will check the users Authorization header for a signed access token.
+// If the token is valid, the User, their Session and permissions held in the token are added
+// to the request Context. No database lookup is needed, so a revoked session is only
+// locked out once its access token expires.
 func (mw *jsonAuthMW) CheckUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		bearer := r.Header.Get("Authorization")
@@ -38,27 +56,53 @@ func (mw *jsonAuthMW) CheckUser(next http.Handler) http.Handler {
 			return
 		}
 		token := strings.TrimSpace(bearer[len("Bearer"):])
-		user, err := mw.UserService.GetByRemember(token)
+		claims, err := mw.UserService.VerifyAccessToken(token)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
-		r = r.WithContext(context.WithUser(r.Context(), user))
+		ctx := context.WithUser(r.Context(), claims.User())
+		ctx = context.WithSession(ctx, claims.Session())
+		r = r.WithContext(context.WithPermissions(ctx, claims.Permissions))
 		next.ServeHTTP(w, r)
 	})
 }
 
-// RequireUser will check that a user is set in the request context.
+// RequireUser will check that a user is set in the request context, and that they meet any opts.
 // It if is, the requested handler will be called.
-// If not,  the server responds with a http.StatusUnauthorized header and further execution is stopped.
-func (mw *jsonAuthMW) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+// If not,  the server responds with http.StatusUnauthorized and further execution is stopped.
+// If the user fails one of the opts the server responds with http.StatusForbidden.
+func (mw *jsonAuthMW) RequireUser(next http.HandlerFunc, opts ...UserOpt) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := context.GetUser(r.Context())
 		if user == nil {
-			w.WriteHeader(http.StatusUnauthorized)
 			w.Header().Set("WWW-Authenticate", "Bearer realm=\"Access to goafweb\"")
+			problem.Write(w, r, goafweb.ErrUnauthenticated)
 			return
 		}
+		for _, opt := range opts {
+			if err := opt(user); err != nil {
+				problem.Write(w, r, err)
+				return
+			}
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequirePermission returns middleware that checks the user in the request context holds perm.
+// If they do, the requested handler will be called.
+// If there is no user the server responds with http.StatusUnauthorized, if they lack the permission
+// it responds with http.StatusForbidden, and further execution is stopped.
+// opts are checked as they are by RequireUser, so the handler needn't be wrapped in it as well.
+func (mw *jsonAuthMW) RequirePermission(perm string, opts ...UserOpt) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return mw.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+			if !context.GetPermissions(r.Context()).Has(perm) {
+				problem.Write(w, r, goafweb.ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}, opts...)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"goafweb/context"
+	"goafweb/rand"
+	"net/http"
+	"regexp"
+)
+
+// RequestIDHeader carries the ID of a request, it is set on every response.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from a proxy, so they are safe to log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9_\-=.]{1,64}$`)
+
+// RequestInfo returns middleware that adds a request ID to the request Context and the response,
+// so an error a client reports can be matched up with the server logs. An ID set by a proxy in
+// the X-Request-ID header is kept, otherwise a new one is generated.
+// If debug is set, error responses include the details of internal errors, it must be off in production.
+func RequestInfo(debug bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				// A missing ID is only a problem for correlating logs, so don't fail the request.
+				id, _ = rand.String(12)
+			}
+			w.Header().Set(RequestIDHeader, id)
+			ctx := context.WithRequestID(r.Context(), id)
+			r = r.WithContext(context.WithDebug(ctx, debug))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Breached is a set of passwords known from data breaches.
+// Only the SHA-1 hash of each password is held, in a bloom filter, so a list of millions of
+// passwords fits in memory. A bloom filter never misses a password that was added, but may
+// report one that wasn't at about the false positive rate it was made with, which only means
+// an unlucky user has to pick a different password.
+type Breached struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewBreached returns an empty Breached sized to hold n passwords with a false positive rate of fpRate.
+func NewBreached(n int, fpRate float64) *Breached {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Breached{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// Add adds a password by its SHA-1 hash.
+func (b *Breached) Add(sum [sha1.Size]byte) {
+	h1, h2 := b.hashes(sum)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// AddPassword adds a password.
+func (b *Breached) AddPassword(pw string) {
+	b.Add(sha1.Sum([]byte(pw)))
+}
+
+// Contains reports whether pw is in the set.
+func (b *Breached) Contains(pw string) bool {
+	h1, h2 := b.hashes(sha1.Sum([]byte(pw)))
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes splits sum into the two hashes used to pick the k bits for a password.
+// A SHA-1 hash is already evenly distributed, so it doesn't need hashing again.
+func (b *Breached) hashes(sum [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
+
+// LoadBreached reads a list of breached password hashes from the file at path.
+// Each line holds the SHA-1 hash of a password in hex, optionally followed by a colon and a count,
+// which is the format of the Pwned Passwords downloads. Blank lines are skipped.
+func LoadBreached(path string, fpRate float64) (*Breached, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open breached password list: %w", err)
+	}
+	defer file.Close()
+	// The filter has to be sized before anything is added, so count the lines first.
+	n := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read breached password list: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Could not read breached password list: %w", err)
+	}
+	b := NewBreached(n, fpRate)
+	scanner = bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if colon := strings.IndexByte(text, ':'); colon >= 0 {
+			text = text[:colon]
+		}
+		decoded, err := hex.DecodeString(text)
+		if err != nil || len(decoded) != sha1.Size {
+			return nil, fmt.Errorf("Breached password list line %d is not a SHA-1 hash", line)
+		}
+		var sum [sha1.Size]byte
+		copy(sum[:], decoded)
+		b.Add(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read breached password list: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,81 @@
+package password
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	breached := NewBreached(10, 0.001)
+	breached.AddPassword("Tr0ub4dor&3")
+	policy := &Policy{MinLength: 8, MinEntropy: 40, Breached: breached}
+
+	tests := map[string]struct {
+		pw       string
+		personal []string
+		want     []string
+	}{
+		"Strong":      {pw: "correct-Horse-battery"},
+		"Short":       {pw: "aB3$", want: []string{"Password must be at least 8 characters"}},
+		"Low entropy": {pw: "password", want: []string{"Password is too easy to guess, make it longer or mix in upper case letters, numbers and symbols"}},
+		"Sequence":    {pw: "abcdefghijklmnop", want: []string{"Password is too easy to guess, make it longer or mix in upper case letters, numbers and symbols"}},
+		"Email":       {pw: "Jane.Doe-Rocks-2020", personal: []string{"", "jane.doe@example.com"}, want: []string{"Password must not contain your name or email address"}},
+		"Name":        {pw: "x9!Smithereens", personal: []string{"John Smith"}, want: []string{"Password must not contain your name or email address"}},
+		"Domain":      {pw: "example-Horse-battery", personal: []string{"jo@example.com"}},
+		"Breached":    {pw: "Tr0ub4dor&3", want: []string{"Password has appeared in a data breach and must not be used"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := policy.Check(tc.pw, tc.personal...)
+			var perr *Error
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, wanted no error", err)
+				}
+				return
+			}
+			if !errors.As(err, &perr) || !reflect.DeepEqual(perr.Feedback, tc.want) {
+				t.Errorf("got %v, wanted %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadBreached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "breached.txt")
+	// The Pwned Passwords format, upper case hex with a count.
+	list := fmt.Sprintf("%X:3861493\n\n%X\n", sha1.Sum([]byte("password")), sha1.Sum([]byte("letmein")))
+	if err := ioutil.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+	breached, err := LoadBreached(path, 0.001)
+	if err != nil {
+		t.Fatalf("LoadBreached: %v", err)
+	}
+	for _, pw := range []string{"password", "letmein"} {
+		if !breached.Contains(pw) {
+			t.Errorf("Contains(%q) = false, wanted true", pw)
+		}
+	}
+	if breached.Contains("correct-Horse-battery") {
+		t.Errorf("Contains reported a password that wasn't added")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not a hash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBreached(path, 0.001); err == nil {
+		t.Errorf("LoadBreached accepted a line that isn't a hash")
+	}
+}
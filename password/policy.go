@@ -0,0 +1,148 @@
+/*
+Package password decides whether a password is strong enough to use.
+A Policy scores passwords by their estimated entropy, rejects any that contain
+the user's own details and checks them against a list of breached passwords.
+*/
+package password
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy is the set of rules a new password must meet.
+type Policy struct {
+	// MinLength is the fewest characters a password may have.
+	MinLength int
+	// MinEntropy is the lowest estimated strength a password may have, in bits.
+	MinEntropy float64
+	// Breached holds passwords known from data breaches, nil skips the check.
+	Breached *Breached
+}
+
+// DefaultPolicy requires 8 characters and 40 bits of entropy, without a breached password list.
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 8, MinEntropy: 40}
+}
+
+// Error lists every rule of a Policy a password broke, as feedback for the user.
+type Error struct {
+	Feedback []string
+}
+
+func (e *Error) Error() string {
+	return strings.Join(e.Feedback, ", ")
+}
+
+// Check returns an Error if pw breaks any rule of the Policy.
+// personal are details of the user, such as their name and email address, which pw must not contain.
+func (p *Policy) Check(pw string, personal ...string) error {
+	var feedback []string
+	if utf8.RuneCountInString(pw) < p.MinLength {
+		feedback = append(feedback, fmt.Sprintf("Password must be at least %d characters", p.MinLength))
+	} else if Entropy(pw) < p.MinEntropy {
+		feedback = append(feedback, "Password is too easy to guess, make it longer or mix in upper case letters, numbers and symbols")
+	}
+	if containsPersonal(pw, personal) {
+		feedback = append(feedback, "Password must not contain your name or email address")
+	}
+	if p.Breached != nil && p.Breached.Contains(pw) {
+		feedback = append(feedback, "Password has appeared in a data breach and must not be used")
+	}
+	if len(feedback) > 0 {
+		return &Error{Feedback: feedback}
+	}
+	return nil
+}
+
+// Entropy estimates the strength of pw in bits.
+// Each character adds the bits needed to pick it from the classes of character pw uses,
+// except one that repeats or continues a sequence from the one before (aaa, abc, 321),
+// which is easy to guess so only adds a single bit.
+func Entropy(pw string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range pw {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+	var bits float64
+	var prev rune
+	for i, r := range []rune(pw) {
+		if i > 0 && (r == prev || r == prev+1 || r == prev-1) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
+
+// Score rates pw from 0, very weak, to 4, very strong, by its Entropy.
+// It is meant for showing a strength meter, a Policy only looks at the Entropy.
+func Score(pw string) int {
+	bits := Entropy(pw)
+	switch {
+	case bits < 28:
+		return 0
+	case bits < 36:
+		return 1
+	case bits < 60:
+		return 2
+	case bits < 128:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// minPersonalLength is the shortest part of a name or email address checked for, so initials
+// and short words that appear in many passwords by chance are ignored.
+const minPersonalLength = 3
+
+// containsPersonal reports whether pw contains any word from personal, ignoring case.
+// Only the part of an email address before the @ is used, the domain is shared with other users.
+func containsPersonal(pw string, personal []string) bool {
+	pw = strings.ToLower(pw)
+	for _, detail := range personal {
+		detail = strings.ToLower(detail)
+		if at := strings.LastIndex(detail, "@"); at >= 0 {
+			detail = detail[:at]
+		}
+		words := strings.FieldsFunc(detail, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range append(words, strings.Join(words, "")) {
+			if utf8.RuneCountInString(word) >= minPersonalLength && strings.Contains(pw, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
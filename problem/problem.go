@@ -0,0 +1,117 @@
+/*
+Package problem writes errors as RFC 7807 problem details, so every error
+response has the same JSON shape and a stable code clients can act on.
+
+The code and status are decided by the goafweb.Error in the error chain.
+Any other error is internal, its details are only shown when the request
+Context is marked with context.WithDebug, otherwise they are logged with the
+request ID so the client can quote it.
+*/
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"goafweb"
+	"goafweb/context"
+	"log"
+	"net/http"
+)
+
+// ContentType is the media type of a problem details response.
+const ContentType = "application/problem+json"
+
+// internalDetail replaces the details of internal errors outside debug mode.
+const internalDetail = "The server could not complete the request, please quote the request ID if the problem persists."
+
+// Details is an RFC 7807 problem details object.
+// Code, RequestID and Errors are extension members, Code is one of the goafweb error codes.
+// Errors holds the message for each field that failed validation, keyed by field name.
+type Details struct {
+	Type      string                   `json:"type"`
+	Title     string                   `json:"title"`
+	Status    int                      `json:"status"`
+	Detail    string                   `json:"detail,omitempty"`
+	Instance  string                   `json:"instance,omitempty"`
+	Code      string                   `json:"code"`
+	RequestID string                   `json:"request_id,omitempty"`
+	Errors    goafweb.ValidationErrors `json:"errors,omitempty"`
+}
+
+// statuses maps each error code to the HTTP status it is reported with.
+// Codes missing from the map are reported as http.StatusInternalServerError.
+var statuses = map[string]int{
+	goafweb.CodeInvalid:          http.StatusUnprocessableEntity,
+	goafweb.CodeBadRequest:       http.StatusBadRequest,
+	goafweb.CodeCursorInvalid:    http.StatusBadRequest,
+	goafweb.CodeUnsupportedMedia: http.StatusUnsupportedMediaType,
+	goafweb.CodeNotFound:         http.StatusNotFound,
+	goafweb.CodePWInvalid:        http.StatusUnauthorized,
+	goafweb.CodeAuth:             http.StatusUnauthorized,
+	goafweb.CodeUnauthenticated:  http.StatusUnauthorized,
+	goafweb.CodeSessionExpired:   http.StatusUnauthorized,
+	goafweb.CodeTokenInvalid:     http.StatusUnauthorized,
+	goafweb.CodeTokenExpired:     http.StatusUnauthorized,
+	goafweb.CodeTokenReused:      http.StatusUnauthorized,
+	goafweb.CodeMFARequired:      http.StatusUnauthorized,
+	goafweb.CodeMFAInvalid:       http.StatusUnauthorized,
+	goafweb.CodeSignatureInvalid: http.StatusUnauthorized,
+	goafweb.CodeForbidden:        http.StatusForbidden,
+	goafweb.CodeEmailUnverified:  http.StatusForbidden,
+	goafweb.CodeAlreadyVerified:  http.StatusConflict,
+	goafweb.CodeMFAEnabled:       http.StatusConflict,
+	goafweb.CodeMFANotEnabled:    http.StatusConflict,
+	goafweb.CodeMFANotEnrolled:   http.StatusConflict,
+	goafweb.CodeMessageSent:      http.StatusConflict,
+	goafweb.CodeRateLimited:      http.StatusTooManyRequests,
+	goafweb.CodeLocked:           http.StatusTooManyRequests,
+	goafweb.CodeMFANotConfigured: http.StatusNotImplemented,
+}
+
+// Status returns the HTTP status err is reported with.
+func Status(err error) int {
+	if status, ok := statuses[goafweb.ErrorCode(err)]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// New builds the problem Details for err in response to r.
+// The Detail of an Error is its own message, so anything it was wrapped with doesn't leak.
+func New(r *http.Request, err error) *Details {
+	status := Status(err)
+	details := &Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  r.URL.Path,
+		Code:      goafweb.ErrorCode(err),
+		RequestID: context.GetRequestID(r.Context()),
+	}
+	var e *goafweb.Error
+	switch {
+	case context.GetDebug(r.Context()):
+		details.Detail = err.Error()
+	case status == http.StatusInternalServerError:
+		details.Detail = internalDetail
+	case errors.As(err, &e):
+		details.Detail = e.Error()
+	}
+	var fields goafweb.ValidationErrors
+	if status != http.StatusInternalServerError && errors.As(err, &fields) {
+		details.Errors = fields
+	}
+	return details
+}
+
+// Write responds to r with err as problem details.
+// Internal errors are logged along with the request ID.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	details := New(r, err)
+	if details.Status == http.StatusInternalServerError {
+		log.Printf("Request %s %s %s failed: %v", details.RequestID, r.Method, r.URL.Path, err)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(details.Status)
+	json.NewEncoder(w).Encode(details)
+}
@@ -0,0 +1,100 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goafweb"
+	"goafweb/context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		debug  bool
+		status int
+		code   string
+		detail string
+		fields goafweb.ValidationErrors
+	}{
+		"Not found": {
+			err:    fmt.Errorf("Could not retreive user: %w", goafweb.ErrNotFound),
+			status: http.StatusNotFound, code: goafweb.CodeNotFound,
+			detail: goafweb.ErrNotFound.Error(),
+		},
+		"Invalid": {
+			err:    goafweb.Invalid(errors.New("Email address is required")),
+			status: http.StatusUnprocessableEntity, code: goafweb.CodeInvalid,
+			detail: "Validation Error: Email address is required",
+		},
+		"Invalid fields": {
+			err: goafweb.Invalid(goafweb.ValidationErrors{
+				"password": "Password is too short",
+				"email":    "Email is not a valid format",
+			}),
+			status: http.StatusUnprocessableEntity, code: goafweb.CodeInvalid,
+			detail: "Validation Error: Email is not a valid format; Password is too short",
+			fields: goafweb.ValidationErrors{
+				"password": "Password is too short",
+				"email":    "Email is not a valid format",
+			},
+		},
+		"Invalid wrapping database error": {
+			err:    goafweb.Invalid(goafweb.Internal("Database error", errors.New("connection refused"))),
+			status: http.StatusInternalServerError, code: goafweb.CodeInternal,
+			detail: internalDetail,
+		},
+		"Retry": {
+			err:    &goafweb.RetryError{Err: goafweb.ErrRateLimited},
+			status: http.StatusTooManyRequests, code: goafweb.CodeRateLimited,
+			detail: goafweb.ErrRateLimited.Error(),
+		},
+		"Untyped": {
+			err:    errors.New("secret internals"),
+			status: http.StatusInternalServerError, code: goafweb.CodeInternal,
+			detail: internalDetail,
+		},
+		"Untyped debug": {
+			err: errors.New("secret internals"), debug: true,
+			status: http.StatusInternalServerError, code: goafweb.CodeInternal,
+			detail: "secret internals",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user", nil)
+			ctx := context.WithRequestID(r.Context(), "req-1")
+			r = r.WithContext(context.WithDebug(ctx, tc.debug))
+			w := httptest.NewRecorder()
+			Write(w, r, tc.err)
+
+			if w.Code != tc.status {
+				t.Errorf("Status: got %d, wanted %d", w.Code, tc.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentType {
+				t.Errorf("Content-Type: got %q, wanted %q", ct, ContentType)
+			}
+			var got Details
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("Could not decode body: %v", err)
+			}
+			if got.Code != tc.code || got.Status != tc.status || got.RequestID != "req-1" || got.Instance != "/api/user" {
+				t.Errorf("Details: got %+v", got)
+			}
+			if got.Detail != tc.detail {
+				t.Errorf("Detail: got %q, wanted %q", got.Detail, tc.detail)
+			}
+			if !reflect.DeepEqual(got.Errors, tc.fields) {
+				t.Errorf("Errors: got %v, wanted %v", got.Errors, tc.fields)
+			}
+			if !tc.debug && strings.Contains(got.Detail, "secret") {
+				t.Errorf("Detail leaked internal error: %q", got.Detail)
+			}
+		})
+	}
+}
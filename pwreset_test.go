@@ -0,0 +1,160 @@
+package goafweb_test
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitiatePWReset(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+
+	// Unknown addresses get the same response, so requests can't be used to find accounts.
+	if token, err := us.InitiatePWReset(ctx, "unknown@test.com", "127.0.0.1"); err != nil || token != "" {
+		t.Errorf("Unknown email: got %q, %v, wanted no token and no error", token, err)
+	}
+	first, err := us.InitiatePWReset(ctx, user.Email, "127.0.0.1")
+	if err != nil || first == "" {
+		t.Fatalf("InitiatePWReset: got %q, %v", first, err)
+	}
+	second, err := us.InitiatePWReset(ctx, user.Email, "127.0.0.1")
+	if err != nil || second == "" || second == first {
+		t.Fatalf("InitiatePWReset again: got %q, %v, wanted a new token", second, err)
+	}
+	// Only the latest email works.
+	if _, err := us.CompletePWReset(ctx, first, "new-password"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("CompletePWReset with an older token: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, err := us.CompletePWReset(ctx, second, "new-password"); err != nil {
+		t.Fatalf("CompletePWReset: %v", err)
+	}
+	if _, err := us.CompletePWReset(ctx, second, "other-password"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("Reusing a reset token: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, err := us.Authenticate(ctx, user.Email, "new-password", "127.0.0.1"); err != nil {
+		t.Errorf("Authenticate with the new password: %v", err)
+	}
+}
+
+func TestPWResetTTL(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name string
+		opts []goafweb.UserServiceOpt
+		ttl  time.Duration
+	}{
+		{"default", nil, goafweb.DefaultPWResetTTL},
+		{"configured", []goafweb.UserServiceOpt{goafweb.WithPWResetTTL(time.Hour)}, time.Hour},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			us := newTestUserService(t, test.opts...)
+			var tokens []string
+			for _, email := range []string{"test@test.com", "other@test.com"} {
+				user := us.createUser(t, email)
+				token, err := us.InitiatePWReset(ctx, user.Email, "127.0.0.1")
+				if err != nil {
+					t.Fatalf("InitiatePWReset: %v", err)
+				}
+				tokens = append(tokens, token)
+			}
+
+			us.clock.Add(test.ttl - time.Minute)
+			if _, err := us.CompletePWReset(ctx, tokens[0], "new-password"); err != nil {
+				t.Errorf("Before the TTL: %v", err)
+			}
+			us.clock.Add(time.Minute + time.Second)
+			if _, err := us.CompletePWReset(ctx, tokens[1], "new-password"); !errors.Is(err, goafweb.ErrTokenExpired) {
+				t.Errorf("After the TTL: got %v, wanted %v", err, goafweb.ErrTokenExpired)
+			}
+			// Used tokens are kept until they would have expired too.
+			if n, err := us.PurgePWResets(ctx); err != nil || n != 2 {
+				t.Errorf("PurgePWResets: got %d, %v, wanted 2", n, err)
+			}
+		})
+	}
+}
+
+func TestCompletePWResetRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	other := us.createUser(t, "other@test.com")
+	var refresh []string
+	for _, u := range []*goafweb.User{user, user, other} {
+		tokens, err := us.Login(ctx, u, "agent", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		refresh = append(refresh, tokens.RefreshToken)
+	}
+	token, err := us.InitiatePWReset(ctx, user.Email, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("InitiatePWReset: %v", err)
+	}
+	if _, err := us.CompletePWReset(ctx, token, "new-password"); err != nil {
+		t.Fatalf("CompletePWReset: %v", err)
+	}
+
+	if sessions, err := us.Sessions(ctx, user.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("Sessions after a reset: got %d, %v, wanted none", len(sessions), err)
+	}
+	for _, token := range refresh[:2] {
+		if _, err := us.Refresh(ctx, token); err == nil {
+			t.Errorf("Refresh after a reset: got nil, wanted the session to be revoked")
+		}
+	}
+	if _, err := us.Refresh(ctx, refresh[2]); err != nil {
+		t.Errorf("Reset revoked another users session: %v", err)
+	}
+}
+
+func TestCompletePWResetRace(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		us := newTestUserService(t)
+		user := us.createUser(t, "test@test.com")
+		token, err := us.InitiatePWReset(ctx, user.Email, "127.0.0.1")
+		if err != nil {
+			t.Fatalf("InitiatePWReset: %v", err)
+		}
+		var wg sync.WaitGroup
+		passwords := []string{"first-password", "second-password"}
+		errs := make([]error, len(passwords))
+		for j := range passwords {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				_, errs[j] = us.CompletePWReset(ctx, token, passwords[j])
+			}(j)
+		}
+		wg.Wait()
+		winner := -1
+		for j, err := range errs {
+			switch {
+			case err == nil:
+				if winner >= 0 {
+					t.Fatalf("Both resets with the same token succeeded")
+				}
+				winner = j
+			// The loser either finds the token already gone, or loses deleting it.
+			case errors.Is(err, goafweb.ErrNotFound), errors.Is(err, goafweb.ErrTokenInvalid):
+			default:
+				t.Fatalf("CompletePWReset: %v", err)
+			}
+		}
+		if winner < 0 {
+			t.Fatalf("Neither reset succeeded: %v", errs)
+		}
+		if _, err := us.Authenticate(ctx, user.Email, passwords[winner], "127.0.0.1"); err != nil {
+			t.Errorf("Authenticate with the winning password: %v", err)
+		}
+		if _, err := us.Authenticate(ctx, user.Email, passwords[1-winner], "127.0.0.1"); err == nil {
+			t.Errorf("Authenticate with the losing password: got nil, wanted an error")
+		}
+	}
+}
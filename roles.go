@@ -0,0 +1,66 @@
+package goafweb
+
+// Roles a User can be granted.
+// Users have no roles when they sign up, which gives them the same access as RoleCustomer.
+const (
+	RoleCustomer = "customer"
+	RoleEditor   = "editor"
+	RoleAdmin    = "admin"
+)
+
+// Permissions that can be granted to a User through their roles.
+const (
+	PermArticlePublish   = "article:publish"
+	PermArticleEditAny   = "article:edit_any"
+	PermArticleDeleteAny = "article:delete_any"
+	PermUserRoles        = "user:roles"
+	PermMailQueue        = "mail:queue"
+	PermMailPreview      = "mail:preview"
+)
+
+// RolePermissions maps each role to the permissions it grants.
+// A role not in this map can not be granted to a User.
+var RolePermissions = map[string][]string{
+	RoleCustomer: {},
+	RoleEditor: {
+		PermArticlePublish,
+		PermArticleEditAny,
+		PermArticleDeleteAny,
+	},
+	RoleAdmin: {
+		PermArticlePublish,
+		PermArticleEditAny,
+		PermArticleDeleteAny,
+		PermUserRoles,
+		PermMailQueue,
+		PermMailPreview,
+	},
+}
+
+// Permissions is the set of permissions held by a User.
+type Permissions []string
+
+// PermissionsFor returns the combined permissions granted by roles.
+func PermissionsFor(roles []string) Permissions {
+	seen := make(map[string]bool)
+	perms := Permissions{}
+	for _, role := range roles {
+		for _, perm := range RolePermissions[role] {
+			if !seen[perm] {
+				seen[perm] = true
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return perms
+}
+
+// Has reports whether perm is in the set.
+func (p Permissions) Has(perm string) bool {
+	for _, held := range p {
+		if held == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package goafweb_test
+
+import (
+	"context"
+	"goafweb"
+	"goafweb/hash"
+	"goafweb/storage/memory"
+	"goafweb/validation"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testClock is the time read by the services under test, tests move it on to expire things.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time      { return c.now }
+func (c *testClock) Add(d time.Duration) { c.now = c.now.Add(d) }
+
+// allowAll is a PasswordPolicy that accepts any password.
+type allowAll struct{}
+
+func (allowAll) Check(password string, personal ...string) error { return nil }
+
+// testUserService is a UserService backed by storage/memory, wired the same way as cmd.
+type testUserService struct {
+	goafweb.UserService
+	clock    *testClock
+	db       *memory.DB
+	sessions goafweb.SessionDB
+}
+
+// newTestUserService returns a testUserService with an empty database, opts are added to its own.
+func newTestUserService(t *testing.T, opts ...goafweb.UserServiceOpt) *testUserService {
+	t.Helper()
+	keys, err := hash.NewKeyring("1", map[string]string{"1": "test-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmac := hash.NewHMAC(keys)
+	hasher := hash.NewBcryptHasher(bcrypt.MinCost)
+	db := memory.NewDB()
+	clock := &testClock{now: time.Now()}
+	sessions := validation.NewSessionValidator(memory.NewSessionDB(db), hmac)
+	stores := goafweb.UserStores{
+		Users:         validation.NewUserValidator(memory.NewUserDB(db), hasher, allowAll{}),
+		PwResets:      validation.NewPwResetValidator(memory.NewPwResetDB(db), hmac),
+		Verifications: validation.NewEmailVerificationValidator(memory.NewEmailVerificationDB(db), hmac),
+		Sessions:      sessions,
+		Roles:         validation.NewRoleValidator(memory.NewRoleDB(db)),
+		RecoveryCodes: validation.NewRecoveryCodeValidator(memory.NewRecoveryCodeDB(db), hmac),
+		Throttles:     validation.NewThrottleValidator(memory.NewThrottleDB(db)),
+		Tx:            db,
+	}
+	opts = append([]goafweb.UserServiceOpt{goafweb.WithNow(clock.Now), goafweb.WithPasswordHasher(hasher)}, opts...)
+	return &testUserService{
+		UserService: goafweb.NewUserService(stores, hash.NewSigner(keys), opts...),
+		clock:       clock,
+		db:          db,
+		sessions:    sessions,
+	}
+}
+
+// createUser adds a User with password "password".
+func (us *testUserService) createUser(t *testing.T, email string) *goafweb.User {
+	t.Helper()
+	ctx := context.Background()
+	user := &goafweb.User{Name: "test", Email: email, Password: "password"}
+	if err := us.Create(ctx, user); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+	return user
+}
+
+// signUp creates a User the way the signup endpoint does, returning their first verification token.
+func (us *testUserService) signUp(t *testing.T, email string) (*goafweb.User, string) {
+	t.Helper()
+	user := &goafweb.User{Name: "test", Email: email, Password: "password"}
+	token, err := us.SignUp(context.Background(), user)
+	if err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+	return user, token
+}
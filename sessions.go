@@ -0,0 +1,86 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// sessionTTL is how long a Session lasts before the User must log in again.
+	sessionTTL = 30 * 24 * time.Hour
+	// sessionTouchInterval limits how often LastSeenAt is written, so every
+	// request doesn't cause a database write.
+	sessionTouchInterval = time.Minute
+)
+
+// CreateSession logs the User in on a new device.
+// The returned Session holds the raw Token to give to the User, only its hash is stored.
+func (us *userService) CreateSession(ctx context.Context, user *User, userAgent, ip string) (*Session, error) {
+	now := us.now()
+	session := Session{
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+	}
+	if err := us.sessionDB.Create(ctx, &session); err != nil {
+		return nil, fmt.Errorf("Could not create session: %w", err)
+	}
+	return &session, nil
+}
+
+// UserBySession looks up the Session for token and the User it belongs to.
+// Expired sessions are removed and return ErrSessionExpired.
+func (us *userService) UserBySession(ctx context.Context, token string) (*User, *Session, error) {
+	session, err := us.sessionDB.GetByToken(ctx, token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not retreive session: %w", err)
+	}
+	now := us.now()
+	if now.After(session.ExpiresAt) {
+		us.sessionDB.Delete(ctx, session.ID)
+		return nil, nil, ErrSessionExpired
+	}
+	user, err := us.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not retreive user: %w", err)
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		session.LastSeenAt = now
+		if err := us.sessionDB.Touch(ctx, session); err != nil {
+			return nil, nil, fmt.Errorf("Could not update session: %w", err)
+		}
+	}
+	return user, session, nil
+}
+
+// Sessions lists every device the User is logged in on.
+func (us *userService) Sessions(ctx context.Context, userID int) ([]*Session, error) {
+	return us.sessionDB.ByUser(ctx, userID)
+}
+
+// RevokeSession logs the User out of a single device.
+// Returns ErrNotFound if the Session does not belong to the User.
+func (us *userService) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	sessions, err := us.sessionDB.ByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("Could not retreive sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			return us.sessionDB.Delete(ctx, sessionID)
+		}
+	}
+	return ErrNotFound
+}
+
+// RevokeSessions logs the User out of every device.
+func (us *userService) RevokeSessions(ctx context.Context, userID int) error {
+	if err := us.sessionDB.DeleteByUser(ctx, userID); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("Could not revoke sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package goafweb_test
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"testing"
+	"time"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	session, err := us.CreateSession(ctx, user, "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	us.clock.Add(goafweb.SessionTTL - time.Second)
+	if _, _, err := us.UserBySession(ctx, session.Token); err != nil {
+		t.Fatalf("Got %v just before the session expires, wanted nil", err)
+	}
+	us.clock.Add(2 * time.Second)
+	if _, _, err := us.UserBySession(ctx, session.Token); !errors.Is(err, goafweb.ErrSessionExpired) {
+		t.Errorf("Got %v once the session expired, wanted %v", err, goafweb.ErrSessionExpired)
+	}
+	// Expired sessions are removed.
+	sessions, err := us.Sessions(ctx, user.ID)
+	if err != nil || len(sessions) != 0 {
+		t.Errorf("Got %d sessions, %v after expiry, wanted none", len(sessions), err)
+	}
+}
+
+func TestSessionTouch(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	created := us.clock.Now()
+	session, err := us.CreateSession(ctx, user, "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	lastSeen := func() time.Time {
+		t.Helper()
+		stored, err := us.sessions.GetByToken(ctx, session.Token)
+		if err != nil {
+			t.Fatalf("GetByToken: %v", err)
+		}
+		return stored.LastSeenAt
+	}
+
+	// Within the interval the session isn't written to.
+	us.clock.Add(goafweb.SessionTouchInterval / 2)
+	if _, _, err := us.UserBySession(ctx, session.Token); err != nil {
+		t.Fatalf("UserBySession: %v", err)
+	}
+	if got := lastSeen(); !got.Equal(created) {
+		t.Errorf("LastSeenAt = %v within the touch interval, wanted %v", got, created)
+	}
+
+	us.clock.Add(goafweb.SessionTouchInterval)
+	if _, _, err := us.UserBySession(ctx, session.Token); err != nil {
+		t.Fatalf("UserBySession: %v", err)
+	}
+	if got := lastSeen(); !got.Equal(us.clock.Now()) {
+		t.Errorf("LastSeenAt = %v after the touch interval, wanted %v", got, us.clock.Now())
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	alice := us.createUser(t, "alice@test.com")
+	bob := us.createUser(t, "bob@test.com")
+	newSession := func(user *goafweb.User) *goafweb.Session {
+		t.Helper()
+		session, err := us.CreateSession(ctx, user, "agent", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		return session
+	}
+	alicePhone, aliceLaptop, bobs := newSession(alice), newSession(alice), newSession(bob)
+
+	if err := us.RevokeSession(ctx, alice.ID, bobs.ID); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("Revoking another users session: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, _, err := us.UserBySession(ctx, bobs.Token); err != nil {
+		t.Errorf("Session was revoked by another user: %v", err)
+	}
+
+	if err := us.RevokeSession(ctx, alice.ID, alicePhone.ID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if _, _, err := us.UserBySession(ctx, alicePhone.Token); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("Revoked session: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, _, err := us.UserBySession(ctx, aliceLaptop.Token); err != nil {
+		t.Errorf("RevokeSession revoked another session: %v", err)
+	}
+
+	newSession(alice)
+	if err := us.RevokeSessions(ctx, alice.ID); err != nil {
+		t.Fatalf("RevokeSessions: %v", err)
+	}
+	if sessions, err := us.Sessions(ctx, alice.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("Got %d sessions, %v after RevokeSessions, wanted none", len(sessions), err)
+	}
+	if _, _, err := us.UserBySession(ctx, bobs.Token); err != nil {
+		t.Errorf("RevokeSessions revoked another users session: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"goafweb"
 
 	"github.com/jinzhu/gorm"
@@ -19,26 +21,121 @@ func NewArticleDB(db *gorm.DB) *articleDB {
 }
 
 // GetByID will retreive an article from the database.
-func (adb *articleDB) GetByID(id int) (*goafweb.Article, error) {
+func (adb *articleDB) GetByID(ctx context.Context, id int) (*goafweb.Article, error) {
+	db, cancel := withContext(ctx, adb.gorm)
+	defer cancel()
 	var article goafweb.Article
-	err := checkErr(adb.gorm.First(&article, id).Error)
+	err := checkErr(db.First(&article, id).Error)
 	return &article, err
 }
 
+// sortColumns are the columns Articles can be sorted by, keyed by the ArticleQuery sort field.
+// They are the only values put into the query as SQL rather than as arguments.
+// Without a sort field Articles are listed in the order they were added.
+var sortColumns = map[string]string{
+	"":                    "id",
+	goafweb.SortByID:      "id",
+	goafweb.SortByCreated: "created_at",
+	goafweb.SortByUpdated: "updated_at",
+}
+
+// List will retreive a page of articles matching the query along with cursors
+// for the neighbouring pages.
+// Paging is keyset based: the cursor holds the sort value and ID of the article
+// at the edge of the previous page, and ID breaks ties between equal sort values.
+func (adb *articleDB) List(ctx context.Context, query *goafweb.ArticleQuery) (*goafweb.ArticleList, error) {
+	column, ok := sortColumns[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("Cannot sort articles by %q", query.SortBy)
+	}
+	db, cancel := withContext(ctx, adb.gorm)
+	defer cancel()
+	db = db.Model(&goafweb.Article{})
+	if query.Author > 0 {
+		db = db.Where("author = ?", query.Author)
+	}
+	if !query.CreatedAfter.IsZero() {
+		db = db.Where("created_at >= ?", utc(query.CreatedAfter))
+	}
+	if !query.CreatedBefore.IsZero() {
+		db = db.Where("created_at < ?", utc(query.CreatedBefore))
+	}
+	if !query.UpdatedAfter.IsZero() {
+		db = db.Where("updated_at >= ?", utc(query.UpdatedAfter))
+	}
+	if !query.UpdatedBefore.IsZero() {
+		db = db.Where("updated_at < ?", utc(query.UpdatedBefore))
+	}
+	list := goafweb.ArticleList{Articles: []*goafweb.Article{}}
+	if err := checkErr(db.Count(&list.Total).Error); err != nil {
+		return nil, err
+	}
+
+	var cursor goafweb.Cursor
+	if query.Cursor != "" {
+		var err error
+		if cursor, err = goafweb.DecodeCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+		if !cursor.Matches(query) {
+			return nil, goafweb.ErrCursorInvalid
+		}
+	}
+	// Paging backwards walks the index in reverse order, the results are flipped back afterwards.
+	desc := query.Desc != cursor.Before
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+	if cursor.ID > 0 {
+		if column == "id" {
+			db = db.Where("id "+cmp+" ?", cursor.ID)
+		} else {
+			db = db.Where("("+column+" "+cmp+" ?) OR ("+column+" = ? AND id "+cmp+" ?)", utc(cursor.Time), utc(cursor.Time), cursor.ID)
+		}
+	}
+	if column != "id" {
+		db = db.Order(column + " " + dir)
+	}
+	db = db.Order("id " + dir)
+
+	// Fetch one extra article to find out if there is another page.
+	if err := checkErr(db.Limit(query.Limit + 1).Find(&list.Articles).Error); err != nil {
+		return nil, err
+	}
+	more := len(list.Articles) > query.Limit
+	if more {
+		list.Articles = list.Articles[:query.Limit]
+	}
+	if cursor.Before {
+		for i, j := 0, len(list.Articles)-1; i < j; i, j = i+1, j-1 {
+			list.Articles[i], list.Articles[j] = list.Articles[j], list.Articles[i]
+		}
+	}
+	list.SetCursors(query, cursor, more)
+	return &list, nil
+}
+
 // Create will add a new article to the database.
-func (adb *articleDB) Create(article *goafweb.Article) error {
-	return checkErr(adb.gorm.Create(article).Error)
+func (adb *articleDB) Create(ctx context.Context, article *goafweb.Article) error {
+	db, cancel := withContext(ctx, adb.gorm)
+	defer cancel()
+	return checkErr(db.Create(article).Error)
 }
 
 // Update will update an existing article in the database.
-func (adb *articleDB) Update(article *goafweb.Article) error {
-	return checkErr(adb.gorm.Save(article).Error)
+func (adb *articleDB) Update(ctx context.Context, article *goafweb.Article) error {
+	db, cancel := withContext(ctx, adb.gorm)
+	defer cancel()
+	return checkErr(db.Save(article).Error)
 }
 
 // Delete will remove article from database.
 // Note: This is a soft delete, article will have DeletedAt field updated to time.Now()
 // making it invisible to normal queries, but will still retreival when needed.
-func (adb *articleDB) Delete(id int) error {
+func (adb *articleDB) Delete(ctx context.Context, id int) error {
+	db, cancel := withContext(ctx, adb.gorm)
+	defer cancel()
 	article := goafweb.Article{ID: id}
-	return checkErr(adb.gorm.Delete(&article).Error)
+	return checkErr(db.Delete(&article).Error)
 }
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"time"
+	"unsafe"
+
+	"github.com/jinzhu/gorm"
+)
+
+// optionsKey is the gorm setting Options are stored under by Open.
+const optionsKey = "goafweb:options"
+
+// Options configures how queries are run against a database opened with Open.
+type Options struct {
+	// LogQueries logs every query, it should be off in production.
+	LogQueries bool
+	// QueryTimeout limits how long a single call to a storage method may spend on queries,
+	// zero means no limit beyond the context passed in.
+	QueryTimeout time.Duration
+}
+
+// withContext returns a gorm.DB that runs its queries with ctx, limited by the QueryTimeout
+// given to Open. It is called once per storage call, and the returned cancel func must always be called.
+// If ctx carries a transaction started by a Transactor, the transaction is returned instead
+// so the queries are part of it.
+func withContext(ctx context.Context, db *gorm.DB) (*gorm.DB, context.CancelFunc) {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx, func() {}
+	}
+	opts := options(db)
+	cancel := func() {}
+	if opts.QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.QueryTimeout)
+	}
+	return connect(ctx, db), cancel
+}
+
+// connect returns a clone of db that runs every query with ctx over the same connection pool.
+// The clone keeps all of db's settings, such as its logger, callbacks and the clock set by Open.
+// A gorm.DB already in a transaction is returned as is, it was started with a context.
+func connect(ctx context.Context, db *gorm.DB) *gorm.DB {
+	sqlDB, ok := db.CommonDB().(*sql.DB)
+	if !ok {
+		return db
+	}
+	conn := ctxConn{db: sqlDB, ctx: ctx}
+	clone := db.New()
+	setConn(clone, conn)
+	clone.Dialect().SetDB(conn)
+	return clone
+}
+
+// setConn replaces the connection db runs its queries on.
+// gorm v1 can't pass a context to a query and only swaps the connection itself in BeginTx,
+// so the unexported field is set directly. gorm v1 is no longer developed, and the storage
+// tests fail if the field is ever renamed.
+func setConn(db *gorm.DB, conn gorm.SQLCommon) {
+	field := reflect.ValueOf(db).Elem().FieldByName("db")
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(conn))
+}
+
+// options returns the Options db was opened with.
+func options(db *gorm.DB) Options {
+	if v, ok := db.Get(optionsKey); ok {
+		return v.(Options)
+	}
+	return Options{}
+}
+
+// ctxConn is a database connection that runs every query with ctx.
+// It satisfies the interfaces gorm uses for a connection and for starting transactions.
+type ctxConn struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func (c ctxConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c ctxConn) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+func (c ctxConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c ctxConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+// Begin starts a transaction that is rolled back if ctx is done before it commits.
+func (c ctxConn) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+func (c ctxConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.db.BeginTx(ctx, opts)
+}
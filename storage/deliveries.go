@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"goafweb"
+
+	"github.com/jinzhu/gorm"
+)
+
+type deliveryStatusDB struct {
+	gorm *gorm.DB
+}
+
+// NewDeliveryStatusDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.DeliveryStatusDB interface.
+func NewDeliveryStatusDB(db *gorm.DB) *deliveryStatusDB {
+	return &deliveryStatusDB{
+		gorm: db,
+	}
+}
+
+// GetByEmail retrieves the DeliveryStatus of an email address.
+func (dsdb *deliveryStatusDB) GetByEmail(ctx context.Context, email string) (*goafweb.DeliveryStatus, error) {
+	db, cancel := withContext(ctx, dsdb.gorm)
+	defer cancel()
+	var ds goafweb.DeliveryStatus
+	if err := checkErr(db.Where("email = ?", email).First(&ds).Error); err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+// Save creates the DeliveryStatus if its ID is 0, otherwise updates it.
+func (dsdb *deliveryStatusDB) Save(ctx context.Context, ds *goafweb.DeliveryStatus) error {
+	db, cancel := withContext(ctx, dsdb.gorm)
+	defer cancel()
+	ds.LastEventAt = utc(ds.LastEventAt)
+	if ds.ID == 0 {
+		return checkErr(db.Create(ds).Error)
+	}
+	return checkErr(db.Save(ds).Error)
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	// Database drivers for every supported dialect.
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// Supported database dialects.
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
+// Open connects to the database, applying any settings the dialect needs.
+func Open(dialect, dsn string, opts Options) (*gorm.DB, error) {
+	db, err := gorm.Open(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.LogMode(opts.LogQueries).InstantSet(optionsKey, opts)
+	if dialect == DialectSQLite {
+		// SQLite only allows one writer, a single connection queues writes rather than failing them
+		// with "database is locked".
+		db.DB().SetMaxOpenConns(1)
+		// SQLite stores times as text and compares them as text, so they must all be in one time zone.
+		// Only this connection is changed, gorm.NowFunc is shared by every connection in the process.
+		db.SetNowFuncOverride(func() time.Time {
+			return time.Now().UTC()
+		})
+	}
+	return db, nil
+}
+
+// utc returns t in UTC, times used in queries must be in UTC so they compare correctly
+// with SQLite, which compares times as text. Other dialects are unaffected.
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
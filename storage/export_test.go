@@ -0,0 +1,5 @@
+package storage
+
+// Exported for the tests in storage_test.
+
+const MigrationLockTimeout = migrationLockTimeout
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"goafweb/hash"
+
+	"github.com/jinzhu/gorm"
+)
+
+type keyUsageDB struct {
+	gorm *gorm.DB
+}
+
+// NewKeyUsageDB returns a new service that reports which keys stored hashes were made with.
+func NewKeyUsageDB(db *gorm.DB) *keyUsageDB {
+	return &keyUsageDB{
+		gorm: db,
+	}
+}
+
+// Count returns how many values in column of table were hashed with a key other than currentID,
+// along with the total number of values.
+// Values are tagged with their key ID by hash.TagKeyID.
+func (kdb *keyUsageDB) Count(table, column, currentID string) (old, total int, err error) {
+	if !kdb.gorm.HasTable(table) {
+		return 0, 0, nil
+	}
+	values := kdb.gorm.Table(table).Where(column + " <> ''")
+	if err := values.Count(&total).Error; err != nil {
+		return 0, 0, checkErr(err)
+	}
+	// Values made with the legacy key have no prefix, any value with one uses another key.
+	if prefix := hash.TagKeyID(currentID, ""); prefix == "" {
+		err = values.Where(column+" LIKE ?", "%:%").Count(&old).Error
+	} else {
+		err = values.Where(column+" NOT LIKE ?", prefix+"%").Count(&old).Error
+	}
+	if err != nil {
+		return 0, 0, checkErr(err)
+	}
+	return old, total, nil
+}
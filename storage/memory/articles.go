@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"goafweb"
+	"sort"
+	"time"
+)
+
+type articleDB struct {
+	db *DB
+}
+
+// NewArticleDB returns a new service that fulfils goafweb.ArticleDB interface in memory.
+func NewArticleDB(db *DB) *articleDB {
+	return &articleDB{
+		db: db,
+	}
+}
+
+// GetByID will retreive an article.
+func (adb *articleDB) GetByID(ctx context.Context, id int) (*goafweb.Article, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer adb.db.rlock()()
+	article, ok := adb.db.articles[id]
+	if !ok || article.DeletedAt != nil {
+		return nil, goafweb.ErrNotFound
+	}
+	return &article, nil
+}
+
+// List will retreive a page of articles matching the query along with cursors
+// for the neighbouring pages, paging the same way as the gorm implementation.
+func (adb *articleDB) List(ctx context.Context, query *goafweb.ArticleQuery) (*goafweb.ArticleList, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	switch query.SortBy {
+	case "", goafweb.SortByID, goafweb.SortByCreated, goafweb.SortByUpdated:
+	default:
+		return nil, fmt.Errorf("Cannot sort articles by %q", query.SortBy)
+	}
+	var cursor goafweb.Cursor
+	if query.Cursor != "" {
+		var err error
+		if cursor, err = goafweb.DecodeCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+		if !cursor.Matches(query) {
+			return nil, goafweb.ErrCursorInvalid
+		}
+	}
+
+	unlock := adb.db.rlock()
+	matches := []goafweb.Article{}
+	for _, article := range adb.db.articles {
+		if article.DeletedAt == nil && matchesQuery(&article, query) {
+			matches = append(matches, article)
+		}
+	}
+	unlock()
+
+	list := goafweb.ArticleList{Articles: []*goafweb.Article{}, Total: len(matches)}
+	// Paging backwards walks the articles in reverse order, the results are flipped back afterwards.
+	desc := query.Desc != cursor.Before
+	sort.Slice(matches, func(i, j int) bool {
+		return before(&matches[i], matches[j].ID, sortValue(&matches[j], query.SortBy), query.SortBy) != desc
+	})
+	for i := range matches {
+		article := &matches[i]
+		if cursor.ID > 0 {
+			// Skip up to and including the article the cursor points at.
+			if article.ID == cursor.ID || before(article, cursor.ID, cursor.Time, query.SortBy) != desc {
+				continue
+			}
+		}
+		list.Articles = append(list.Articles, article)
+		if len(list.Articles) > query.Limit {
+			break
+		}
+	}
+	more := len(list.Articles) > query.Limit
+	if more {
+		list.Articles = list.Articles[:query.Limit]
+	}
+	if cursor.Before {
+		for i, j := 0, len(list.Articles)-1; i < j; i, j = i+1, j-1 {
+			list.Articles[i], list.Articles[j] = list.Articles[j], list.Articles[i]
+		}
+	}
+	list.SetCursors(query, cursor, more)
+	return &list, nil
+}
+
+// matchesQuery reports whether article matches the filters in query.
+func matchesQuery(article *goafweb.Article, query *goafweb.ArticleQuery) bool {
+	switch {
+	case query.Author > 0 && article.Author != query.Author,
+		!query.CreatedAfter.IsZero() && article.CreatedAt.Before(query.CreatedAfter),
+		!query.CreatedBefore.IsZero() && !article.CreatedAt.Before(query.CreatedBefore),
+		!query.UpdatedAfter.IsZero() && article.UpdatedAt.Before(query.UpdatedAfter),
+		!query.UpdatedBefore.IsZero() && !article.UpdatedAt.Before(query.UpdatedBefore):
+		return false
+	}
+	return true
+}
+
+// sortValue returns the time article is sorted by, sorting by ID has none.
+func sortValue(article *goafweb.Article, sortBy string) time.Time {
+	switch sortBy {
+	case goafweb.SortByCreated:
+		return article.CreatedAt
+	case goafweb.SortByUpdated:
+		return article.UpdatedAt
+	}
+	return time.Time{}
+}
+
+// before reports whether article sorts before the position given by id and t in ascending order.
+// ID breaks ties between equal times.
+func before(article *goafweb.Article, id int, t time.Time, sortBy string) bool {
+	if v := sortValue(article, sortBy); !v.Equal(t) {
+		return v.Before(t)
+	}
+	return article.ID < id
+}
+
+// Create will add a new article.
+func (adb *articleDB) Create(ctx context.Context, article *goafweb.Article) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer adb.db.lock(ctx, "articles")()
+	article.ID = adb.db.nextID("articles")
+	t := now()
+	if article.CreatedAt.IsZero() {
+		article.CreatedAt = t
+	}
+	article.UpdatedAt = t
+	adb.db.articles[article.ID] = *article
+	return nil
+}
+
+// Update will update an existing article.
+func (adb *articleDB) Update(ctx context.Context, article *goafweb.Article) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer adb.db.lock(ctx, "articles")()
+	existing, ok := adb.db.articles[article.ID]
+	if !ok || existing.DeletedAt != nil {
+		return goafweb.ErrNotFound
+	}
+	article.UpdatedAt = now()
+	adb.db.articles[article.ID] = *article
+	return nil
+}
+
+// Delete will remove an article.
+// Note: This is a soft delete, article will have DeletedAt set making it invisible
+// the same as the gorm implementation.
+func (adb *articleDB) Delete(ctx context.Context, id int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer adb.db.lock(ctx, "articles")()
+	article, ok := adb.db.articles[id]
+	if !ok || article.DeletedAt != nil {
+		return nil
+	}
+	t := now()
+	article.DeletedAt = &t
+	adb.db.articles[id] = article
+	return nil
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+)
+
+type deliveryStatusDB struct {
+	db *DB
+}
+
+// NewDeliveryStatusDB returns a new service that fulfils goafweb.DeliveryStatusDB interface in memory.
+func NewDeliveryStatusDB(db *DB) *deliveryStatusDB {
+	return &deliveryStatusDB{
+		db: db,
+	}
+}
+
+// GetByEmail retrieves the DeliveryStatus of an email address.
+func (dsdb *deliveryStatusDB) GetByEmail(ctx context.Context, email string) (*goafweb.DeliveryStatus, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer dsdb.db.rlock()()
+	for _, ds := range dsdb.db.deliveries {
+		if ds.Email == email {
+			return &ds, nil
+		}
+	}
+	return nil, goafweb.ErrNotFound
+}
+
+// Save creates the DeliveryStatus if its ID is 0, otherwise updates it.
+func (dsdb *deliveryStatusDB) Save(ctx context.Context, ds *goafweb.DeliveryStatus) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer dsdb.db.lock(ctx, "delivery_statuses")()
+	if ds.ID == 0 {
+		for _, existing := range dsdb.db.deliveries {
+			if existing.Email == ds.Email {
+				return errDuplicate("delivery_statuses", "email")
+			}
+		}
+		ds.ID = dsdb.db.nextID("delivery_statuses")
+		ds.CreatedAt = now()
+	} else if _, ok := dsdb.db.deliveries[ds.ID]; !ok {
+		return goafweb.ErrNotFound
+	}
+	ds.UpdatedAt = now()
+	dsdb.db.deliveries[ds.ID] = *ds
+	return nil
+}
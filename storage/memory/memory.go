@@ -0,0 +1,249 @@
+/*
+Package memory implements the storage interfaces defined in goafweb in memory.
+It behaves the same as the gorm implementations in storage, so it can be used for
+tests and demos without a database. Nothing is persisted when the process exits.
+*/
+package memory
+
+import (
+	"context"
+	"fmt"
+	"goafweb"
+	"sync"
+	"time"
+)
+
+// DB holds every table in memory, it is shared by the implementations of each interface.
+// It is safe for concurrent use.
+// It also fulfils goafweb.Transactor. Only one transaction runs at a time, other calls aren't
+// blocked by it and see its changes before it commits, except writes to a table the transaction
+// has written, which wait until it finishes.
+type DB struct {
+	mu sync.RWMutex
+	// txMu is held by the transaction in progress.
+	txMu sync.Mutex
+	// released is signalled when a transaction finishes, with mu as its lock.
+	released *sync.Cond
+	// undo restores each table the transaction in progress has written, keyed by table name.
+	undo map[string]func()
+
+	seq           map[string]int
+	users         map[int]goafweb.User
+	articles      map[int]goafweb.Article
+	pwResets      map[int]goafweb.PwReset
+	sessions      map[int]goafweb.Session
+	rotated       map[string]int // hash of a rotated token to the ID of its Session
+	verifications map[int]goafweb.EmailVerification
+	recoveryCodes map[int]goafweb.RecoveryCode
+	throttles     map[string]goafweb.Throttle
+	roles         map[int]map[string]bool
+	outbox        map[int]goafweb.OutboxMessage
+	deliveries    map[int]goafweb.DeliveryStatus
+}
+
+// NewDB returns an empty DB.
+func NewDB() *DB {
+	db := &DB{
+		seq:           map[string]int{},
+		users:         map[int]goafweb.User{},
+		articles:      map[int]goafweb.Article{},
+		pwResets:      map[int]goafweb.PwReset{},
+		sessions:      map[int]goafweb.Session{},
+		rotated:       map[string]int{},
+		verifications: map[int]goafweb.EmailVerification{},
+		recoveryCodes: map[int]goafweb.RecoveryCode{},
+		throttles:     map[string]goafweb.Throttle{},
+		roles:         map[int]map[string]bool{},
+		outbox:        map[int]goafweb.OutboxMessage{},
+		deliveries:    map[int]goafweb.DeliveryStatus{},
+	}
+	db.released = sync.NewCond(&db.mu)
+	return db
+}
+
+// txKey is the context key a transaction is stored under, its value is the DB it is on.
+type txKey struct{}
+
+// InTx runs fn in a transaction, if fn returns an error every change it made is undone.
+// Every call made with the context passed to fn is part of the transaction. If ctx is already
+// in a transaction fn joins it.
+// The DB is only locked for each call, not while fn runs, so fn may do slow work such as
+// hashing a password without holding up other callers.
+func (db *DB) InTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if db.inTx(ctx) {
+		return fn(ctx)
+	}
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+	db.mu.Lock()
+	db.undo = map[string]func(){}
+	db.mu.Unlock()
+	defer func() {
+		r := recover()
+		db.mu.Lock()
+		if r != nil || err != nil {
+			for _, restore := range db.undo {
+				restore()
+			}
+		}
+		db.undo = nil
+		db.released.Broadcast()
+		db.mu.Unlock()
+		if r != nil {
+			panic(r)
+		}
+	}()
+	return fn(context.WithValue(ctx, txKey{}, db))
+}
+
+// inTx reports whether ctx is in a transaction on db.
+func (db *DB) inTx(ctx context.Context) bool {
+	tx, _ := ctx.Value(txKey{}).(*DB)
+	return tx == db
+}
+
+// lock locks db for writing to tables and returns the func to unlock it.
+// In a transaction each table is copied the first time it is written, so it can be restored.
+// Otherwise lock waits while the transaction in progress has written any of tables, so a
+// rollback can't undo the write.
+func (db *DB) lock(ctx context.Context, tables ...string) func() {
+	db.mu.Lock()
+	if db.inTx(ctx) {
+		for _, table := range tables {
+			db.snapshot(table)
+		}
+		return db.mu.Unlock
+	}
+	for db.written(tables) {
+		db.released.Wait()
+	}
+	return db.mu.Unlock
+}
+
+// rlock locks db for reading and returns the func to unlock it.
+func (db *DB) rlock() func() {
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+// written reports whether the transaction in progress has written any of tables.
+// The caller must hold the lock.
+func (db *DB) written(tables []string) bool {
+	for _, table := range tables {
+		if _, ok := db.undo[table]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot copies table the first time the transaction in progress writes it, and adds the
+// func to restore it to undo. IDs used by the transaction are not given out again, the same as
+// a database. The caller must hold the lock.
+func (db *DB) snapshot(table string) {
+	if _, ok := db.undo[table]; ok || db.undo == nil {
+		return
+	}
+	var restore func()
+	switch table {
+	case "users":
+		users := make(map[int]goafweb.User, len(db.users))
+		for k, v := range db.users {
+			users[k] = v
+		}
+		restore = func() { db.users = users }
+	case "articles":
+		articles := make(map[int]goafweb.Article, len(db.articles))
+		for k, v := range db.articles {
+			articles[k] = v
+		}
+		restore = func() { db.articles = articles }
+	case "pw_resets":
+		pwResets := make(map[int]goafweb.PwReset, len(db.pwResets))
+		for k, v := range db.pwResets {
+			pwResets[k] = v
+		}
+		restore = func() { db.pwResets = pwResets }
+	case "sessions":
+		sessions := make(map[int]goafweb.Session, len(db.sessions))
+		for k, v := range db.sessions {
+			sessions[k] = v
+		}
+		restore = func() { db.sessions = sessions }
+	case "rotated_tokens":
+		rotated := make(map[string]int, len(db.rotated))
+		for k, v := range db.rotated {
+			rotated[k] = v
+		}
+		restore = func() { db.rotated = rotated }
+	case "email_verifications":
+		verifications := make(map[int]goafweb.EmailVerification, len(db.verifications))
+		for k, v := range db.verifications {
+			verifications[k] = v
+		}
+		restore = func() { db.verifications = verifications }
+	case "recovery_codes":
+		recoveryCodes := make(map[int]goafweb.RecoveryCode, len(db.recoveryCodes))
+		for k, v := range db.recoveryCodes {
+			recoveryCodes[k] = v
+		}
+		restore = func() { db.recoveryCodes = recoveryCodes }
+	case "throttles":
+		throttles := make(map[string]goafweb.Throttle, len(db.throttles))
+		for k, v := range db.throttles {
+			throttles[k] = v
+		}
+		restore = func() { db.throttles = throttles }
+	case "user_roles":
+		roles := make(map[int]map[string]bool, len(db.roles))
+		for k, userRoles := range db.roles {
+			roles[k] = map[string]bool{}
+			for role := range userRoles {
+				roles[k][role] = true
+			}
+		}
+		restore = func() { db.roles = roles }
+	case "outbox_messages":
+		outbox := make(map[int]goafweb.OutboxMessage, len(db.outbox))
+		for k, v := range db.outbox {
+			outbox[k] = v
+		}
+		restore = func() { db.outbox = outbox }
+	case "delivery_statuses":
+		deliveries := make(map[int]goafweb.DeliveryStatus, len(db.deliveries))
+		for k, v := range db.deliveries {
+			deliveries[k] = v
+		}
+		restore = func() { db.deliveries = deliveries }
+	default:
+		panic("memory: unknown table " + table)
+	}
+	db.undo[table] = restore
+}
+
+// nextID returns the next auto increment ID for table. The caller must hold the lock.
+func (db *DB) nextID(table string) int {
+	db.seq[table]++
+	return db.seq[table]
+}
+
+// errDuplicate is returned when a value breaks a unique index, as a database would.
+func errDuplicate(table, column string) error {
+	return goafweb.Internal("Database error", fmt.Errorf("duplicate value for %s.%s", table, column))
+}
+
+// now returns the time to use for CreatedAt and UpdatedAt, the same as gorm.
+func now() time.Time {
+	return time.Now()
+}
+
+// checkContext returns an error if ctx is done, as a database would refuse to run a query.
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return goafweb.Internal("Database error", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goafweb"
+	"goafweb/storage/memory"
+	"goafweb/storage/storagetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserDB(t *testing.T) {
+	storagetest.UserDB(t, func(t *testing.T) goafweb.UserDB {
+		return memory.NewUserDB(memory.NewDB())
+	})
+}
+
+func TestArticleDB(t *testing.T) {
+	storagetest.ArticleDB(t, func(t *testing.T) goafweb.ArticleDB {
+		return memory.NewArticleDB(memory.NewDB())
+	})
+}
+
+func TestPwResetDB(t *testing.T) {
+	storagetest.PwResetDB(t, func(t *testing.T) goafweb.PwResetDB {
+		return memory.NewPwResetDB(memory.NewDB())
+	})
+}
+
+func TestSessionDB(t *testing.T) {
+	storagetest.SessionDB(t, func(t *testing.T) goafweb.SessionDB {
+		return memory.NewSessionDB(memory.NewDB())
+	})
+}
+
+func TestOutboxDB(t *testing.T) {
+	storagetest.OutboxDB(t, func(t *testing.T) goafweb.OutboxDB {
+		return memory.NewOutboxDB(memory.NewDB())
+	})
+}
+
+func TestDeliveryStatusDB(t *testing.T) {
+	storagetest.DeliveryStatusDB(t, func(t *testing.T) goafweb.DeliveryStatusDB {
+		return memory.NewDeliveryStatusDB(memory.NewDB())
+	})
+}
+
+func TestTransactor(t *testing.T) {
+	storagetest.Transactor(t, func(t *testing.T) (goafweb.Transactor, goafweb.UserDB) {
+		db := memory.NewDB()
+		return db, memory.NewUserDB(db)
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	db := memory.NewDB()
+	udb := memory.NewUserDB(db)
+	adb := memory.NewArticleDB(db)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := &goafweb.User{Name: "test", Email: fmt.Sprintf("test%d@test.com", i)}
+			if err := udb.Create(ctx, user); err != nil {
+				t.Errorf("Create user: %v", err)
+				return
+			}
+			if err := adb.Create(ctx, &goafweb.Article{Author: user.ID, Title: "title", Content: "content"}); err != nil {
+				t.Errorf("Create article: %v", err)
+			}
+			if _, err := adb.List(ctx, &goafweb.ArticleQuery{Limit: 10}); err != nil {
+				t.Errorf("List: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	list, err := adb.List(ctx, &goafweb.ArticleQuery{Limit: 100})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list.Articles) != 32 {
+		t.Errorf("Got %d articles, wanted 32", len(list.Articles))
+	}
+}
+
+func TestInTxConcurrentUse(t *testing.T) {
+	db := memory.NewDB()
+	udb := memory.NewUserDB(db)
+	adb := memory.NewArticleDB(db)
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+	written, finish := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- db.InTx(ctx, func(ctx context.Context) error {
+			if err := udb.Create(ctx, &goafweb.User{Email: "tx@test.com", PasswordHash: "hash"}); err != nil {
+				return err
+			}
+			close(written)
+			<-finish
+			return errRollback
+		})
+	}()
+	<-written
+
+	// Calls outside the transaction aren't held up by it, unless they write a table it has written.
+	if _, err := udb.GetByEmail(ctx, "tx@test.com"); err != nil {
+		t.Errorf("GetByEmail during the transaction: %v", err)
+	}
+	if err := adb.Create(ctx, &goafweb.Article{Author: 1, Title: "title", Content: "content"}); err != nil {
+		t.Errorf("Create article during the transaction: %v", err)
+	}
+	created := make(chan error)
+	go func() {
+		created <- udb.Create(ctx, &goafweb.User{Email: "other@test.com", PasswordHash: "hash"})
+	}()
+	select {
+	case err := <-created:
+		t.Fatalf("Create user didn't wait for the transaction, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(finish)
+	if err := <-done; !errors.Is(err, errRollback) {
+		t.Fatalf("InTx: got %v, wanted %v", err, errRollback)
+	}
+	if err := <-created; err != nil {
+		t.Fatalf("Create user after the transaction: %v", err)
+	}
+	if _, err := udb.GetByEmail(ctx, "tx@test.com"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByEmail after rollback: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, err := udb.GetByEmail(ctx, "other@test.com"); err != nil {
+		t.Errorf("Create user waiting on the transaction was undone by its rollback: %v", err)
+	}
+	if _, err := adb.GetByID(ctx, 1); err != nil {
+		t.Errorf("Create article outside the transaction was undone by its rollback: %v", err)
+	}
+}
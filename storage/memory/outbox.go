@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+	"sort"
+	"time"
+)
+
+type outboxDB struct {
+	db *DB
+}
+
+// NewOutboxDB returns a new service that fulfils goafweb.OutboxDB interface in memory.
+func NewOutboxDB(db *DB) *outboxDB {
+	return &outboxDB{
+		db: db,
+	}
+}
+
+// Create will add a new OutboxMessage.
+func (odb *outboxDB) Create(ctx context.Context, msg *goafweb.OutboxMessage) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer odb.db.lock(ctx, "outbox_messages")()
+	msg.ID = odb.db.nextID("outbox_messages")
+	msg.CreatedAt, msg.UpdatedAt = now(), now()
+	odb.db.outbox[msg.ID] = *msg
+	return nil
+}
+
+// GetByID retrieves the OutboxMessage with id.
+func (odb *outboxDB) GetByID(ctx context.Context, id int) (*goafweb.OutboxMessage, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer odb.db.rlock()()
+	msg, ok := odb.db.outbox[id]
+	if !ok {
+		return nil, goafweb.ErrNotFound
+	}
+	return &msg, nil
+}
+
+// Claim returns up to limit pending messages due by now and leases them to the caller.
+func (odb *outboxDB) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*goafweb.OutboxMessage, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer odb.db.lock(ctx, "outbox_messages")()
+	var due []goafweb.OutboxMessage
+	for _, msg := range odb.db.outbox {
+		if msg.Status == goafweb.OutboxPending && !msg.NextAttemptAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]*goafweb.OutboxMessage, 0, len(due))
+	for i := range due {
+		msg := due[i]
+		msg.Attempts++
+		msg.NextAttemptAt, msg.UpdatedAt = now.Add(lease), now
+		odb.db.outbox[msg.ID] = msg
+		claimed = append(claimed, &msg)
+	}
+	return claimed, nil
+}
+
+// Update will save every field of an existing OutboxMessage.
+func (odb *outboxDB) Update(ctx context.Context, msg *goafweb.OutboxMessage) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer odb.db.lock(ctx, "outbox_messages")()
+	if _, ok := odb.db.outbox[msg.ID]; !ok {
+		return goafweb.ErrNotFound
+	}
+	msg.UpdatedAt = now()
+	odb.db.outbox[msg.ID] = *msg
+	return nil
+}
+
+// List returns up to limit messages with status, newest first, or with any status if it is empty.
+func (odb *outboxDB) List(ctx context.Context, status string, limit int) ([]*goafweb.OutboxMessage, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer odb.db.rlock()()
+	msgs := []*goafweb.OutboxMessage{}
+	for _, msg := range odb.db.outbox {
+		if status == "" || msg.Status == status {
+			msg := msg
+			msgs = append(msgs, &msg)
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID > msgs[j].ID })
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs, nil
+}
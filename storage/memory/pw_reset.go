@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+	"time"
+)
+
+type pwResetDB struct {
+	db *DB
+}
+
+// NewPwResetDB returns a new service that fulfils goafweb.PwResetDB interface in memory.
+func NewPwResetDB(db *DB) *pwResetDB {
+	return &pwResetDB{
+		db: db,
+	}
+}
+
+// GetByToken will lookup a pwReset using the hash of the token provided by the a User.
+func (pwrdb *pwResetDB) GetByToken(ctx context.Context, tokenHash string) (*goafweb.PwReset, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer pwrdb.db.rlock()()
+	for _, pwr := range pwrdb.db.pwResets {
+		if pwr.TokenHash == tokenHash && pwr.DeletedAt == nil {
+			return &pwr, nil
+		}
+	}
+	return nil, goafweb.ErrNotFound
+}
+
+// Create will add a new pwReset.
+func (pwrdb *pwResetDB) Create(ctx context.Context, pwr *goafweb.PwReset) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer pwrdb.db.lock(ctx, "pw_resets")()
+	for _, existing := range pwrdb.db.pwResets {
+		if existing.TokenHash == pwr.TokenHash {
+			return errDuplicate("pw_resets", "token_hash")
+		}
+	}
+	pwr.ID = pwrdb.db.nextID("pw_resets")
+	t := now()
+	pwr.CreatedAt, pwr.UpdatedAt = t, t
+	stored := *pwr
+	stored.Token = ""
+	pwrdb.db.pwResets[pwr.ID] = stored
+	return nil
+}
+
+// Delete will remove a pwReset.
+// Note: This is a soft delete, the same as the gorm implementation.
+// If it was already deleted goafweb.ErrNotFound is returned.
+func (pwrdb *pwResetDB) Delete(ctx context.Context, id int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer pwrdb.db.lock(ctx, "pw_resets")()
+	pwr, ok := pwrdb.db.pwResets[id]
+	if !ok || pwr.DeletedAt != nil {
+		return goafweb.ErrNotFound
+	}
+	t := now()
+	pwr.DeletedAt = &t
+	pwrdb.db.pwResets[id] = pwr
+	return nil
+}
+
+// DeleteByUser will remove every pwReset belonging to a User.
+// Note: This is a soft delete, the same as the gorm implementation.
+func (pwrdb *pwResetDB) DeleteByUser(ctx context.Context, userID int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer pwrdb.db.lock(ctx, "pw_resets")()
+	t := now()
+	for id, pwr := range pwrdb.db.pwResets {
+		if pwr.UserID == userID && pwr.DeletedAt == nil {
+			pwr.DeletedAt = &t
+			pwrdb.db.pwResets[id] = pwr
+		}
+	}
+	return nil
+}
+
+// DeleteExpired permanently removes every pwReset created before cutoff, including soft deleted ones.
+func (pwrdb *pwResetDB) DeleteExpired(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := checkContext(ctx); err != nil {
+		return 0, err
+	}
+	defer pwrdb.db.lock(ctx, "pw_resets")()
+	n := 0
+	for id, pwr := range pwrdb.db.pwResets {
+		if pwr.CreatedAt.Before(cutoff) {
+			delete(pwrdb.db.pwResets, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+)
+
+type recoveryCodeDB struct {
+	db *DB
+}
+
+// NewRecoveryCodeDB returns a new service that fulfils goafweb.RecoveryCodeDB interface in memory.
+func NewRecoveryCodeDB(db *DB) *recoveryCodeDB {
+	return &recoveryCodeDB{
+		db: db,
+	}
+}
+
+// GetByCode will lookup an unused RecoveryCode belonging to a User using the hash of the code.
+func (rcdb *recoveryCodeDB) GetByCode(ctx context.Context, userID int, codeHash string) (*goafweb.RecoveryCode, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer rcdb.db.rlock()()
+	for _, rc := range rcdb.db.recoveryCodes {
+		if rc.UserID == userID && rc.CodeHash == codeHash && rc.UsedAt == nil {
+			return &rc, nil
+		}
+	}
+	return nil, goafweb.ErrNotFound
+}
+
+// Create will add a new RecoveryCode.
+func (rcdb *recoveryCodeDB) Create(ctx context.Context, rc *goafweb.RecoveryCode) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer rcdb.db.lock(ctx, "recovery_codes")()
+	for _, existing := range rcdb.db.recoveryCodes {
+		if existing.CodeHash == rc.CodeHash {
+			return errDuplicate("recovery_codes", "code_hash")
+		}
+	}
+	rc.ID = rcdb.db.nextID("recovery_codes")
+	rc.CreatedAt = now()
+	stored := *rc
+	stored.Code = ""
+	rcdb.db.recoveryCodes[rc.ID] = stored
+	return nil
+}
+
+// Use will mark a RecoveryCode as used so it can't be used again.
+// If the code was used by another request first goafweb.ErrNotFound is returned.
+func (rcdb *recoveryCodeDB) Use(ctx context.Context, rc *goafweb.RecoveryCode) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer rcdb.db.lock(ctx, "recovery_codes")()
+	stored, ok := rcdb.db.recoveryCodes[rc.ID]
+	if !ok || stored.UsedAt != nil {
+		return goafweb.ErrNotFound
+	}
+	t := now()
+	stored.UsedAt = &t
+	rcdb.db.recoveryCodes[rc.ID] = stored
+	rc.UsedAt = &t
+	return nil
+}
+
+// DeleteByUser will remove every RecoveryCode belonging to a User.
+func (rcdb *recoveryCodeDB) DeleteByUser(ctx context.Context, userID int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer rcdb.db.lock(ctx, "recovery_codes")()
+	for id, rc := range rcdb.db.recoveryCodes {
+		if rc.UserID == userID {
+			delete(rcdb.db.recoveryCodes, id)
+		}
+	}
+	return nil
+}
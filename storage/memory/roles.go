@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"sort"
+)
+
+type roleDB struct {
+	db *DB
+}
+
+// NewRoleDB returns a new service that fulfils goafweb.RoleDB interface in memory.
+func NewRoleDB(db *DB) *roleDB {
+	return &roleDB{
+		db: db,
+	}
+}
+
+// ByUser retrieves the names of all roles granted to a User.
+func (rdb *roleDB) ByUser(ctx context.Context, userID int) ([]string, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer rdb.db.rlock()()
+	roles := []string{}
+	for role := range rdb.db.roles[userID] {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// Grant adds a role to a User.
+// Granting a role the User already holds is not an error.
+func (rdb *roleDB) Grant(ctx context.Context, userID int, role string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer rdb.db.lock(ctx, "user_roles")()
+	if rdb.db.roles[userID] == nil {
+		rdb.db.roles[userID] = map[string]bool{}
+	}
+	rdb.db.roles[userID][role] = true
+	return nil
+}
+
+// Revoke removes a role from a User.
+func (rdb *roleDB) Revoke(ctx context.Context, userID int, role string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer rdb.db.lock(ctx, "user_roles")()
+	delete(rdb.db.roles[userID], role)
+	return nil
+}
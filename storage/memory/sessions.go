@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+	"sort"
+)
+
+type sessionDB struct {
+	db *DB
+}
+
+// NewSessionDB returns a new service that fulfils goafweb.SessionDB interface in memory.
+func NewSessionDB(db *DB) *sessionDB {
+	return &sessionDB{
+		db: db,
+	}
+}
+
+// GetByToken will lookup a Session using the hash of the token provided by a User.
+func (sdb *sessionDB) GetByToken(ctx context.Context, tokenHash string) (*goafweb.Session, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer sdb.db.rlock()()
+	for _, session := range sdb.db.sessions {
+		if session.TokenHash == tokenHash {
+			return &session, nil
+		}
+	}
+	return nil, goafweb.ErrNotFound
+}
+
+// GetByRotatedToken will lookup the Session a refresh token was issued under,
+// using the hash of a token that has since been exchanged.
+func (sdb *sessionDB) GetByRotatedToken(ctx context.Context, tokenHash string) (*goafweb.Session, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer sdb.db.rlock()()
+	session, ok := sdb.db.sessions[sdb.db.rotated[tokenHash]]
+	if !ok {
+		return nil, goafweb.ErrNotFound
+	}
+	return &session, nil
+}
+
+// ByUser will retreive every Session belonging to a User, most recently used first.
+func (sdb *sessionDB) ByUser(ctx context.Context, userID int) ([]*goafweb.Session, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer sdb.db.rlock()()
+	sessions := []*goafweb.Session{}
+	for _, session := range sdb.db.sessions {
+		if session.UserID == userID {
+			s := session
+			sessions = append(sessions, &s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// Create will add a new Session.
+func (sdb *sessionDB) Create(ctx context.Context, session *goafweb.Session) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer sdb.db.lock(ctx, "sessions")()
+	if sdb.tokenTaken(session.TokenHash) {
+		return errDuplicate("sessions", "token_hash")
+	}
+	session.ID = sdb.db.nextID("sessions")
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now()
+	}
+	sdb.db.sessions[session.ID] = storedSession(session)
+	return nil
+}
+
+// Touch will update the time a Session was last seen, and its token hash in case it was rehashed.
+func (sdb *sessionDB) Touch(ctx context.Context, session *goafweb.Session) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer sdb.db.lock(ctx, "sessions")()
+	stored, ok := sdb.db.sessions[session.ID]
+	if !ok {
+		return nil
+	}
+	stored.TokenHash, stored.LastSeenAt = session.TokenHash, session.LastSeenAt
+	sdb.db.sessions[session.ID] = stored
+	return nil
+}
+
+// Rotate will replace the refresh token of a Session, recording the hash of the old token.
+// The replacement only happens if the old token is still current, otherwise another request
+// has already exchanged it and goafweb.ErrNotFound is returned.
+func (sdb *sessionDB) Rotate(ctx context.Context, oldTokenHash string, session *goafweb.Session) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer sdb.db.lock(ctx, "sessions", "rotated_tokens")()
+	stored, ok := sdb.db.sessions[session.ID]
+	if !ok || stored.TokenHash != oldTokenHash {
+		return goafweb.ErrNotFound
+	}
+	if _, ok := sdb.db.rotated[oldTokenHash]; ok {
+		return errDuplicate("rotated_tokens", "token_hash")
+	}
+	stored.TokenHash, stored.LastSeenAt = session.TokenHash, session.LastSeenAt
+	sdb.db.sessions[session.ID] = stored
+	sdb.db.rotated[oldTokenHash] = session.ID
+	return nil
+}
+
+// Delete will remove a Session, along with its rotated tokens.
+func (sdb *sessionDB) Delete(ctx context.Context, id int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer sdb.db.lock(ctx, "sessions", "rotated_tokens")()
+	sdb.delete(id)
+	return nil
+}
+
+// DeleteByUser will remove every Session belonging to a User, along with their rotated tokens.
+func (sdb *sessionDB) DeleteByUser(ctx context.Context, userID int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer sdb.db.lock(ctx, "sessions", "rotated_tokens")()
+	for id, session := range sdb.db.sessions {
+		if session.UserID == userID {
+			sdb.delete(id)
+		}
+	}
+	return nil
+}
+
+// delete removes a Session and its rotated tokens. The caller must hold the lock.
+func (sdb *sessionDB) delete(id int) {
+	delete(sdb.db.sessions, id)
+	for hash, sessionID := range sdb.db.rotated {
+		if sessionID == id {
+			delete(sdb.db.rotated, hash)
+		}
+	}
+}
+
+// tokenTaken reports whether a Session already has tokenHash. The caller must hold the lock.
+func (sdb *sessionDB) tokenTaken(tokenHash string) bool {
+	for _, session := range sdb.db.sessions {
+		if session.TokenHash == tokenHash {
+			return true
+		}
+	}
+	return false
+}
+
+// storedSession returns a copy of session without the fields that aren't stored.
+func storedSession(session *goafweb.Session) goafweb.Session {
+	s := *session
+	s.Token, s.Current = "", false
+	return s
+}
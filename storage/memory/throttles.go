@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+	"time"
+)
+
+type throttleDB struct {
+	db *DB
+}
+
+// NewThrottleDB returns a new service that fulfils goafweb.ThrottleDB interface in memory.
+func NewThrottleDB(db *DB) *throttleDB {
+	return &throttleDB{
+		db: db,
+	}
+}
+
+// Get retrieves the Throttle for key.
+func (tdb *throttleDB) Get(ctx context.Context, key string) (*goafweb.Throttle, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer tdb.db.rlock()()
+	t, ok := tdb.db.throttles[key]
+	if !ok {
+		return nil, goafweb.ErrNotFound
+	}
+	return &t, nil
+}
+
+// Increment adds a failure to the Throttle for key, creating it on the first failure.
+// Failures are counted from 1 again if the last was longer ago than window.
+func (tdb *throttleDB) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*goafweb.Throttle, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer tdb.db.lock(ctx, "throttles")()
+	t, ok := tdb.db.throttles[key]
+	if !ok {
+		t = goafweb.Throttle{ID: tdb.db.nextID("throttles"), Key: key, CreatedAt: now}
+	}
+	if t.LastFailureAt.Before(now.Add(-window)) {
+		t.Failures = 0
+	}
+	t.Failures++
+	t.LastFailureAt, t.UpdatedAt = now, now
+	tdb.db.throttles[key] = t
+	return &t, nil
+}
+
+// Lock stops any attempts against key until the time given.
+func (tdb *throttleDB) Lock(ctx context.Context, key string, until time.Time) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer tdb.db.lock(ctx, "throttles")()
+	if t, ok := tdb.db.throttles[key]; ok {
+		t.LockedUntil = &until
+		tdb.db.throttles[key] = t
+	}
+	return nil
+}
+
+// Delete will remove the Throttle for key.
+func (tdb *throttleDB) Delete(ctx context.Context, key string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer tdb.db.lock(ctx, "throttles")()
+	delete(tdb.db.throttles, key)
+	return nil
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+)
+
+type userDB struct {
+	db *DB
+}
+
+// NewUserDB returns a new service that fulfils goafweb.UserDB interface in memory.
+func NewUserDB(db *DB) *userDB {
+	return &userDB{
+		db: db,
+	}
+}
+
+// GetByID retrieves a User using the unique ID for lookup.
+func (udb *userDB) GetByID(ctx context.Context, id int) (*goafweb.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer udb.db.rlock()()
+	user, ok := udb.db.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, goafweb.ErrNotFound
+	}
+	return &user, nil
+}
+
+// GetByEmail retrieves a User using their email address for lookup.
+func (udb *userDB) GetByEmail(ctx context.Context, email string) (*goafweb.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer udb.db.rlock()()
+	for _, user := range udb.db.users {
+		if user.Email == email && user.DeletedAt == nil {
+			return &user, nil
+		}
+	}
+	return nil, goafweb.ErrNotFound
+}
+
+// Create will add a User, their email address must not be taken.
+func (udb *userDB) Create(ctx context.Context, user *goafweb.User) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer udb.db.lock(ctx, "users")()
+	if udb.emailTaken(user.Email, 0) {
+		return errDuplicate("users", "email")
+	}
+	user.ID = udb.db.nextID("users")
+	t := now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = t
+	}
+	user.UpdatedAt = t
+	udb.db.users[user.ID] = storedUser(user)
+	return nil
+}
+
+// Update will save every field of an existing User.
+func (udb *userDB) Update(ctx context.Context, user *goafweb.User) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer udb.db.lock(ctx, "users")()
+	existing, ok := udb.db.users[user.ID]
+	if !ok || existing.DeletedAt != nil {
+		return goafweb.ErrNotFound
+	}
+	if udb.emailTaken(user.Email, user.ID) {
+		return errDuplicate("users", "email")
+	}
+	user.UpdatedAt = now()
+	udb.db.users[user.ID] = storedUser(user)
+	return nil
+}
+
+// UseTOTPStep sets the Users TOTPLastStep to step, failing with goafweb.ErrNotFound
+// if the same or a later step has already been used.
+func (udb *userDB) UseTOTPStep(ctx context.Context, user *goafweb.User, step int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer udb.db.lock(ctx, "users")()
+	stored, ok := udb.db.users[user.ID]
+	if !ok || stored.DeletedAt != nil || stored.TOTPLastStep >= step {
+		return goafweb.ErrNotFound
+	}
+	stored.TOTPLastStep = step
+	udb.db.users[user.ID] = stored
+	user.TOTPLastStep = step
+	return nil
+}
+
+// emailTaken reports whether another User has email, soft deleted Users still hold theirs like a unique index.
+// The caller must hold the lock.
+func (udb *userDB) emailTaken(email string, exceptID int) bool {
+	for id, user := range udb.db.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// storedUser returns a copy of user without the fields that aren't stored.
+func storedUser(user *goafweb.User) goafweb.User {
+	u := *user
+	u.Password = ""
+	return u
+}
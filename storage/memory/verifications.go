@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"goafweb"
+)
+
+type emailVerificationDB struct {
+	db *DB
+}
+
+// NewEmailVerificationDB returns a new service that fulfils goafweb.EmailVerificationDB interface in memory.
+func NewEmailVerificationDB(db *DB) *emailVerificationDB {
+	return &emailVerificationDB{
+		db: db,
+	}
+}
+
+// GetByToken will lookup an EmailVerification using the hash of the token provided by the a User.
+func (evdb *emailVerificationDB) GetByToken(ctx context.Context, tokenHash string) (*goafweb.EmailVerification, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer evdb.db.rlock()()
+	for _, ev := range evdb.db.verifications {
+		if ev.TokenHash == tokenHash && ev.DeletedAt == nil {
+			return &ev, nil
+		}
+	}
+	return nil, goafweb.ErrNotFound
+}
+
+// LatestByUser will lookup the most recently created EmailVerification for a User.
+func (evdb *emailVerificationDB) LatestByUser(ctx context.Context, userID int) (*goafweb.EmailVerification, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer evdb.db.rlock()()
+	var latest *goafweb.EmailVerification
+	for _, ev := range evdb.db.verifications {
+		if ev.UserID == userID && ev.DeletedAt == nil && (latest == nil || ev.CreatedAt.After(latest.CreatedAt)) {
+			ev := ev
+			latest = &ev
+		}
+	}
+	if latest == nil {
+		return nil, goafweb.ErrNotFound
+	}
+	return latest, nil
+}
+
+// Create will add a new EmailVerification.
+func (evdb *emailVerificationDB) Create(ctx context.Context, ev *goafweb.EmailVerification) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer evdb.db.lock(ctx, "email_verifications")()
+	for _, existing := range evdb.db.verifications {
+		if existing.TokenHash == ev.TokenHash {
+			return errDuplicate("email_verifications", "token_hash")
+		}
+	}
+	ev.ID = evdb.db.nextID("email_verifications")
+	t := now()
+	ev.CreatedAt, ev.UpdatedAt = t, t
+	stored := *ev
+	stored.Token = ""
+	evdb.db.verifications[ev.ID] = stored
+	return nil
+}
+
+// DeleteByUser will remove every EmailVerification belonging to a User.
+// Note: This is a soft delete, the same as the gorm implementation.
+func (evdb *emailVerificationDB) DeleteByUser(ctx context.Context, userID int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	defer evdb.db.lock(ctx, "email_verifications")()
+	t := now()
+	for id, ev := range evdb.db.verifications {
+		if ev.UserID == userID && ev.DeletedAt == nil {
+			ev.DeletedAt = &t
+			evdb.db.verifications[id] = ev
+		}
+	}
+	return nil
+}
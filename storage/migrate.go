@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migrationLockTimeout is how long a lock is held before it is assumed the instance holding it
+// died mid migration, and another instance may take it over.
+const migrationLockTimeout = 15 * time.Minute
+
+// ErrMigrationLocked is returned when another instance is already running migrations.
+var ErrMigrationLocked = errors.New("Migrations are locked by another instance")
+
+// Migration is a single versioned change to the database schema.
+// Migrations are applied in order of ID and each runs in a transaction with the record of it being applied,
+// but note MySQL commits schema changes immediately so a failed migration there may be partly applied.
+// Up and Down must only use structs defined in the migration, never the app's types, so the migration
+// keeps doing the same thing however the app's types change later.
+type Migration struct {
+	ID   string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+// MigrationStatus reports whether a Migration has been applied.
+type MigrationStatus struct {
+	ID        string
+	AppliedAt *time.Time
+}
+
+// schemaMigration records a Migration that has been applied.
+type schemaMigration struct {
+	ID        string `gorm:"primary_key"`
+	AppliedAt time.Time
+}
+
+// schemaMigrationLock is held while migrations run, its primary key means only one instance can insert it.
+type schemaMigrationLock struct {
+	ID       int `gorm:"primary_key;auto_increment:false"`
+	Owner    string
+	LockedAt time.Time
+}
+
+// Migrator applies and rolls back Migrations, recording which have been applied in the schema_migrations table.
+type Migrator struct {
+	gorm       *gorm.DB
+	migrations []Migration
+	owner      string
+}
+
+// NewMigrator returns a Migrator for the app's migrations.
+func NewMigrator(db *gorm.DB) *Migrator {
+	host, _ := os.Hostname()
+	ms := append([]Migration(nil), migrations...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].ID < ms[j].ID })
+	return &Migrator{
+		gorm:       db,
+		migrations: ms,
+		owner:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}
+}
+
+// Status returns every Migration in order with when it was applied, AppliedAt is nil if it is pending.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i].ID = mig.ID
+		if sm, ok := applied[mig.ID]; ok {
+			statuses[i].AppliedAt = &sm.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Pending returns the IDs of migrations that have not been applied.
+func (m *Migrator) Pending() ([]string, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.ID)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending Migration in order, returning the IDs of those applied.
+func (m *Migrator) Up() ([]string, error) {
+	var done []string
+	err := m.locked(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.ID]; ok {
+				continue
+			}
+			err := m.gorm.Transaction(func(tx *gorm.DB) error {
+				if err := mig.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{ID: mig.ID, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("Migration %s failed: %w", mig.ID, err)
+			}
+			done = append(done, mig.ID)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last n applied migrations, newest first, returning the IDs of those rolled back.
+func (m *Migrator) Down(n int) ([]string, error) {
+	var done []string
+	err := m.locked(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.ID]; !ok {
+				continue
+			}
+			err := m.gorm.Transaction(func(tx *gorm.DB) error {
+				if err := mig.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{ID: mig.ID}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("Rolling back migration %s failed: %w", mig.ID, err)
+			}
+			done = append(done, mig.ID)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// init creates the tables the Migrator uses itself.
+func (m *Migrator) init() error {
+	return checkErr(m.gorm.AutoMigrate(&schemaMigration{}, &schemaMigrationLock{}).Error)
+}
+
+// applied returns the applied migrations by ID.
+func (m *Migrator) applied() (map[string]schemaMigration, error) {
+	var sms []schemaMigration
+	if err := m.gorm.Find(&sms).Error; err != nil {
+		return nil, checkErr(err)
+	}
+	applied := make(map[string]schemaMigration, len(sms))
+	for _, sm := range sms {
+		applied[sm.ID] = sm
+	}
+	return applied, nil
+}
+
+// locked runs fn while holding the migration lock, so two instances never migrate at once.
+// A lock older than migrationLockTimeout is taken over.
+func (m *Migrator) locked(fn func() error) error {
+	if err := m.init(); err != nil {
+		return err
+	}
+	now := time.Now()
+	lock := schemaMigrationLock{ID: 1, Owner: m.owner, LockedAt: now}
+	if err := m.gorm.Create(&lock).Error; err != nil {
+		var held schemaMigrationLock
+		if err := m.gorm.First(&held, 1).Error; err != nil {
+			return fmt.Errorf("Could not lock migrations: %w", checkErr(err))
+		}
+		if now.Sub(held.LockedAt) < migrationLockTimeout {
+			return fmt.Errorf("%w: %s since %s", ErrMigrationLocked, held.Owner, held.LockedAt.Format(time.RFC3339))
+		}
+		res := m.gorm.Model(&held).Where("owner = ?", held.Owner).
+			UpdateColumns(map[string]interface{}{"owner": m.owner, "locked_at": now})
+		if res.Error != nil {
+			return fmt.Errorf("Could not lock migrations: %w", checkErr(res.Error))
+		}
+		if res.RowsAffected == 0 {
+			return ErrMigrationLocked
+		}
+	}
+	defer m.gorm.Where("id = 1 AND owner = ?", m.owner).Delete(&schemaMigrationLock{})
+	return fn()
+}
@@ -0,0 +1,115 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMigratorDown(t *testing.T) {
+	db := newSQLite(t)
+	m := storage.NewMigrator(db)
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	last := []string{statuses[len(statuses)-2].ID, statuses[len(statuses)-1].ID}
+
+	done, err := m.Down(2)
+	if err != nil || !reflect.DeepEqual(done, []string{last[1], last[0]}) {
+		t.Fatalf("Down(2): got %v, %v, wanted %v newest first", done, err, []string{last[1], last[0]})
+	}
+	if pending, err := m.Pending(); err != nil || !reflect.DeepEqual(pending, last) {
+		t.Errorf("Pending after Down: got %v, %v, wanted %v", pending, err, last)
+	}
+	if done, err := m.Up(); err != nil || !reflect.DeepEqual(done, last) {
+		t.Errorf("Up: got %v, %v, wanted %v", done, err, last)
+	}
+
+	// Every migration can be rolled back and applied again.
+	done, err = m.Down(len(statuses) + 1)
+	if err != nil || len(done) != len(statuses) {
+		t.Fatalf("Down all: got %v, %v", done, err)
+	}
+	for _, table := range []string{"users", "sessions", "outbox_messages", "delivery_statuses"} {
+		if db.HasTable(table) {
+			t.Errorf("Table %s still exists after rolling back every migration", table)
+		}
+	}
+	if done, err := m.Up(); err != nil || len(done) != len(statuses) {
+		t.Errorf("Up after Down all: got %v, %v", done, err)
+	}
+	if pending, err := m.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("Pending: got %v, %v, wanted none", pending, err)
+	}
+}
+
+func TestMigratorLock(t *testing.T) {
+	db := newSQLite(t)
+	m := storage.NewMigrator(db)
+	lockedAt := time.Now()
+	if err := db.Exec("INSERT INTO schema_migration_locks (id, owner, locked_at) VALUES (1, ?, ?)", "other:1", lockedAt).Error; err != nil {
+		t.Fatalf("Insert lock: %v", err)
+	}
+	if _, err := m.Up(); !errors.Is(err, storage.ErrMigrationLocked) {
+		t.Errorf("Up while locked: got %v, wanted %v", err, storage.ErrMigrationLocked)
+	}
+	if _, err := m.Down(1); !errors.Is(err, storage.ErrMigrationLocked) {
+		t.Errorf("Down while locked: got %v, wanted %v", err, storage.ErrMigrationLocked)
+	}
+	if pending, err := m.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("Down rolled back %v while locked", pending)
+	}
+
+	// The instance holding the lock is assumed to have died once it is old enough.
+	stale := lockedAt.Add(-storage.MigrationLockTimeout - time.Minute)
+	if err := db.Exec("UPDATE schema_migration_locks SET locked_at = ? WHERE id = 1", stale).Error; err != nil {
+		t.Fatalf("Update lock: %v", err)
+	}
+	if done, err := m.Down(1); err != nil || len(done) != 1 {
+		t.Fatalf("Down with a stale lock: got %v, %v, wanted the lock taken over", done, err)
+	}
+	var held int
+	if err := db.Table("schema_migration_locks").Count(&held).Error; err != nil || held != 0 {
+		t.Errorf("Got %d locks, %v once finished, wanted the lock released", held, err)
+	}
+	if done, err := m.Up(); err != nil || len(done) != 1 {
+		t.Errorf("Up after the lock was released: got %v, %v", done, err)
+	}
+}
+
+func TestVerifyExistingUsersMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLite(t)
+	udb, evdb := storage.NewUserDB(db), storage.NewEmailVerificationDB(db)
+	existing := &goafweb.User{Name: "existing", Email: "existing@test.com", PasswordHash: "hash"}
+	unverified := &goafweb.User{Name: "unverified", Email: "unverified@test.com", PasswordHash: "hash"}
+	for _, user := range []*goafweb.User{existing, unverified} {
+		if err := udb.Create(ctx, user); err != nil {
+			t.Fatalf("Create user: %v", err)
+		}
+	}
+	// Signed up since verification was added, but hasn't followed the link yet.
+	if err := evdb.Create(ctx, &goafweb.EmailVerification{UserID: unverified.ID, TokenHash: "hash"}); err != nil {
+		t.Fatalf("Create verification: %v", err)
+	}
+
+	// Down does nothing, so Up runs the migration again against these users.
+	m := storage.NewMigrator(db)
+	if ids, err := m.Down(1); err != nil || len(ids) != 1 || ids[0] != "0006_verify_existing_users" {
+		t.Fatalf("Down: got %v, %v", ids, err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if got, err := udb.GetByID(ctx, existing.ID); err != nil || !got.Verified() {
+		t.Errorf("User from before verification: got %+v, %v, wanted them verified", got, err)
+	}
+	if got, err := udb.GetByID(ctx, unverified.ID); err != nil || got.Verified() {
+		t.Errorf("User with a verification token: got %+v, %v, wanted them unverified", got, err)
+	}
+}
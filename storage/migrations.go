@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migrations holds every Migration, new migrations are added to the end with the next ID.
+// Each one defines the structs it needs as they were when it was written, see Migration.
+var migrations = []Migration{
+	{
+		// The schema as it was when migrations replaced AutoMigrate, including pw_resets which
+		// AutoMigrate never created. AutoMigrate only adds what is missing so this is also safe
+		// to run against a database AutoMigrate created.
+		ID: "0001_initial_schema",
+		Up: func(tx *gorm.DB) error {
+			type user struct {
+				ID              int    `gorm:"primary_key;"`
+				Name            string `gorm:"not_null;"`
+				Email           string `gorm:"not_null;unique_index;"`
+				PasswordHash    string `gorm:"not_null;"`
+				EmailVerifiedAt *time.Time
+				TOTPSecret      string
+				TOTPEnabledAt   *time.Time
+				TOTPLastStep    int64
+				CreatedAt       time.Time
+				UpdatedAt       time.Time
+				DeletedAt       *time.Time
+			}
+			type article struct {
+				ID        int
+				Title     string `gorm:"not_null"`
+				Content   string `gorm:"not_null"`
+				Author    int    `gorm:"not_null"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+				DeletedAt *time.Time
+			}
+			type userRole struct {
+				ID        int
+				UserID    int    `gorm:"not null;unique_index:idx_user_role"`
+				Role      string `gorm:"not null;unique_index:idx_user_role"`
+				CreatedAt time.Time
+			}
+			type session struct {
+				ID         int
+				UserID     int    `gorm:"not null;index"`
+				TokenHash  string `gorm:"not null;unique_index"`
+				UserAgent  string
+				IP         string
+				CreatedAt  time.Time
+				LastSeenAt time.Time
+				ExpiresAt  time.Time
+			}
+			type rotatedToken struct {
+				ID        int
+				SessionID int    `gorm:"not null;index"`
+				TokenHash string `gorm:"not null;unique_index"`
+				CreatedAt time.Time
+			}
+			type emailVerification struct {
+				ID        int
+				UserID    int    `gorm:"not null;index"`
+				TokenHash string `gorm:"not null;unique_index"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+				DeletedAt *time.Time
+			}
+			type recoveryCode struct {
+				ID        int
+				UserID    int    `gorm:"not null;index"`
+				CodeHash  string `gorm:"not null;unique_index"`
+				UsedAt    *time.Time
+				CreatedAt time.Time
+			}
+			type throttle struct {
+				ID            int
+				Key           string `gorm:"not null;unique_index"`
+				Failures      int    `gorm:"not null"`
+				LastFailureAt time.Time
+				LockedUntil   *time.Time
+				CreatedAt     time.Time
+				UpdatedAt     time.Time
+			}
+			type pwReset struct {
+				ID        int
+				UserID    int    `gorm:"not null"`
+				TokenHash string `gorm:"not null;unique_index"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+				DeletedAt *time.Time
+			}
+			return migrateTables(tx, []table{
+				{"users", &user{}},
+				{"articles", &article{}},
+				{"user_roles", &userRole{}},
+				{"sessions", &session{}},
+				{"rotated_tokens", &rotatedToken{}},
+				{"email_verifications", &emailVerification{}},
+				{"recovery_codes", &recoveryCode{}},
+				{"throttles", &throttle{}},
+				{"pw_resets", &pwReset{}},
+			})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("pw_resets", "throttles", "recovery_codes", "email_verifications",
+				"rotated_tokens", "sessions", "user_roles", "articles", "users").Error
+		},
+	},
+	{
+		// Users had a single role before user_roles, and a single remember token before sessions.
+		// Databases created since never had them.
+		ID: "0002_drop_legacy_user_columns",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"remember_hash", "role"} {
+				if tx.Dialect().HasColumn("users", column) {
+					if err := tx.Table("users").DropColumn(column).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			// The values are gone, only the columns can be restored.
+			type user struct {
+				RememberHash string
+				Role         string
+			}
+			return tx.Table("users").AutoMigrate(&user{}).Error
+		},
+	},
+	{
+		// Reset tokens are found by user to invalidate earlier ones, and by age to purge expired ones.
+		ID: "0003_index_pw_resets",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Table("pw_resets").AddIndex("idx_pw_resets_user_id", "user_id").Error; err != nil {
+				return err
+			}
+			return tx.Table("pw_resets").AddIndex("idx_pw_resets_created_at", "created_at").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("pw_resets").RemoveIndex("idx_pw_resets_created_at").Error; err != nil {
+				return err
+			}
+			return tx.Table("pw_resets").RemoveIndex("idx_pw_resets_user_id").Error
+		},
+	},
+	{
+		// Emails are queued here in the same transaction as the change that sends them.
+		ID: "0004_create_outbox_messages",
+		Up: func(tx *gorm.DB) error {
+			type outboxMessage struct {
+				ID            int
+				From          string
+				To            string `gorm:"not null"`
+				Subject       string
+				Text          string    `gorm:"type:text"`
+				HTML          string    `gorm:"type:text"`
+				Status        string    `gorm:"not null;index:idx_outbox_due"`
+				Attempts      int       `gorm:"not null"`
+				NextAttemptAt time.Time `gorm:"index:idx_outbox_due"`
+				LastError     string    `gorm:"type:text"`
+				SentAt        *time.Time
+				CreatedAt     time.Time
+				UpdatedAt     time.Time
+			}
+			return migrateTables(tx, []table{{"outbox_messages", &outboxMessage{}}})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("outbox_messages").Error
+		},
+	},
+	{
+		// The result of the latest email sent to each address, reported by the mail provider.
+		ID: "0005_create_delivery_statuses",
+		Up: func(tx *gorm.DB) error {
+			type deliveryStatus struct {
+				ID          int
+				Email       string `gorm:"not null;unique_index"`
+				Status      string `gorm:"not null"`
+				Suppressed  bool   `gorm:"not null"`
+				Reason      string
+				LastEventAt time.Time
+				CreatedAt   time.Time
+				UpdatedAt   time.Time
+			}
+			return migrateTables(tx, []table{{"delivery_statuses", &deliveryStatus{}}})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("delivery_statuses").Error
+		},
+	},
+	{
+		// Accounts created before email verification was required have never been sent a verification
+		// token, so they can't verify and would lose access to anything requiring a verified address.
+		// They are treated as verified from now. Every account since has a token, even once used or expired.
+		ID: "0006_verify_existing_users",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE users SET email_verified_at = ? WHERE email_verified_at IS NULL "+
+				"AND id NOT IN (SELECT user_id FROM email_verifications)", utc(time.Now())).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			// Which accounts were verified by the migration isn't recorded, so they stay verified.
+			return nil
+		},
+	},
+}
+
+// table pairs a table name with the struct describing it in a Migration.
+type table struct {
+	name  string
+	value interface{}
+}
+
+// migrateTables creates each table from its struct, or adds any missing columns and indexes if it exists.
+func migrateTables(tx *gorm.DB, tables []table) error {
+	for _, t := range tables {
+		if err := tx.Table(t.name).AutoMigrate(t.value).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
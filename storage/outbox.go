@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"goafweb"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type outboxDB struct {
+	gorm *gorm.DB
+}
+
+// NewOutboxDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.OutboxDB interface.
+func NewOutboxDB(db *gorm.DB) *outboxDB {
+	return &outboxDB{
+		gorm: db,
+	}
+}
+
+// Create will add a new OutboxMessage to the database.
+func (odb *outboxDB) Create(ctx context.Context, msg *goafweb.OutboxMessage) error {
+	db, cancel := withContext(ctx, odb.gorm)
+	defer cancel()
+	msg.NextAttemptAt = utc(msg.NextAttemptAt)
+	return checkErr(db.Create(msg).Error)
+}
+
+// GetByID retrieves the OutboxMessage with id.
+func (odb *outboxDB) GetByID(ctx context.Context, id int) (*goafweb.OutboxMessage, error) {
+	db, cancel := withContext(ctx, odb.gorm)
+	defer cancel()
+	var msg goafweb.OutboxMessage
+	if err := checkErr(db.Where("id = ?", id).First(&msg).Error); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Claim returns up to limit pending messages due by now and leases them to the caller.
+// Each message is only claimed if its attempts haven't changed since it was read, so
+// when workers race for the same message only one of them gets it.
+func (odb *outboxDB) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*goafweb.OutboxMessage, error) {
+	db, cancel := withContext(ctx, odb.gorm)
+	defer cancel()
+	now = utc(now)
+	var due []*goafweb.OutboxMessage
+	err := db.Where("status = ? AND next_attempt_at <= ?", goafweb.OutboxPending, now).
+		Order("next_attempt_at, id").Limit(limit).Find(&due).Error
+	if err != nil {
+		return nil, checkErr(err)
+	}
+	claimed := make([]*goafweb.OutboxMessage, 0, len(due))
+	for _, msg := range due {
+		res := db.Model(&goafweb.OutboxMessage{}).
+			Where("id = ? AND status = ? AND attempts = ?", msg.ID, goafweb.OutboxPending, msg.Attempts).
+			UpdateColumns(map[string]interface{}{
+				"attempts":        msg.Attempts + 1,
+				"next_attempt_at": now.Add(lease),
+				"updated_at":      now,
+			})
+		if res.Error != nil {
+			return nil, checkErr(res.Error)
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		msg.Attempts++
+		msg.NextAttemptAt, msg.UpdatedAt = now.Add(lease), now
+		claimed = append(claimed, msg)
+	}
+	return claimed, nil
+}
+
+// Update will save every field of an existing OutboxMessage.
+func (odb *outboxDB) Update(ctx context.Context, msg *goafweb.OutboxMessage) error {
+	db, cancel := withContext(ctx, odb.gorm)
+	defer cancel()
+	msg.NextAttemptAt = utc(msg.NextAttemptAt)
+	return checkErr(db.Save(msg).Error)
+}
+
+// List returns up to limit messages with status, newest first, or with any status if it is empty.
+func (odb *outboxDB) List(ctx context.Context, status string, limit int) ([]*goafweb.OutboxMessage, error) {
+	db, cancel := withContext(ctx, odb.gorm)
+	defer cancel()
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	msgs := []*goafweb.OutboxMessage{}
+	if err := db.Order("id desc").Limit(limit).Find(&msgs).Error; err != nil {
+		return nil, checkErr(err)
+	}
+	return msgs, nil
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"goafweb"
+	"time"
 
 	"github.com/jinzhu/gorm"
 )
@@ -19,9 +21,11 @@ func NewPwResetDB(db *gorm.DB) *pwResetDB {
 }
 
 // GetByToken will lookup a pwReset using the token provided by the a User.
-func (pwrdb *pwResetDB) GetByToken(tokenHash string) (*goafweb.PwReset, error) {
+func (pwrdb *pwResetDB) GetByToken(ctx context.Context, tokenHash string) (*goafweb.PwReset, error) {
+	db, cancel := withContext(ctx, pwrdb.gorm)
+	defer cancel()
 	var pwr goafweb.PwReset
-	err := checkErr(pwrdb.gorm.Where("token_hash = ?", tokenHash).First(&pwr).Error)
+	err := checkErr(db.Where("token_hash = ?", tokenHash).First(&pwr).Error)
 	if err != nil {
 		return nil, err
 	}
@@ -29,14 +33,45 @@ func (pwrdb *pwResetDB) GetByToken(tokenHash string) (*goafweb.PwReset, error) {
 }
 
 // Create will add a new pwReset to the database.
-func (pwrdb *pwResetDB) Create(pwr *goafweb.PwReset) error {
-	return checkErr(pwrdb.gorm.Create(pwr).Error)
+func (pwrdb *pwResetDB) Create(ctx context.Context, pwr *goafweb.PwReset) error {
+	db, cancel := withContext(ctx, pwrdb.gorm)
+	defer cancel()
+	return checkErr(db.Create(pwr).Error)
 }
 
 // Delete will remove a pwReset entry from the database.
 // Note: This is a soft delete, pwReset will have DeletedAt field updated to time.Now()
 // making it invisible to normal queries, but will still retreival when needed.
-func (pwrdb *pwResetDB) Delete(id int) error {
+// If it was already deleted, i.e. by another request using the same token, goafweb.ErrNotFound is returned.
+func (pwrdb *pwResetDB) Delete(ctx context.Context, id int) error {
+	db, cancel := withContext(ctx, pwrdb.gorm)
+	defer cancel()
 	pwr := goafweb.PwReset{ID: id}
-	return checkErr(pwrdb.gorm.Delete(&pwr).Error)
+	res := db.Delete(&pwr)
+	if res.Error != nil {
+		return checkErr(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return goafweb.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteByUser will remove every pwReset belonging to a User.
+// Note: This is a soft delete, the same as Delete.
+func (pwrdb *pwResetDB) DeleteByUser(ctx context.Context, userID int) error {
+	db, cancel := withContext(ctx, pwrdb.gorm)
+	defer cancel()
+	return checkErr(db.Where("user_id = ?", userID).Delete(&goafweb.PwReset{}).Error)
+}
+
+// DeleteExpired permanently removes every pwReset created before cutoff, including soft deleted ones.
+func (pwrdb *pwResetDB) DeleteExpired(ctx context.Context, cutoff time.Time) (int, error) {
+	db, cancel := withContext(ctx, pwrdb.gorm)
+	defer cancel()
+	result := db.Unscoped().Where("created_at < ?", utc(cutoff)).Delete(&goafweb.PwReset{})
+	if err := checkErr(result.Error); err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected), nil
 }
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"goafweb"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type recoveryCodeDB struct {
+	gorm *gorm.DB
+}
+
+// NewRecoveryCodeDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.RecoveryCodeDB interface.
+func NewRecoveryCodeDB(db *gorm.DB) *recoveryCodeDB {
+	return &recoveryCodeDB{
+		gorm: db,
+	}
+}
+
+// GetByCode will lookup an unused RecoveryCode belonging to a User using the hash of the code.
+func (rcdb *recoveryCodeDB) GetByCode(ctx context.Context, userID int, codeHash string) (*goafweb.RecoveryCode, error) {
+	db, cancel := withContext(ctx, rcdb.gorm)
+	defer cancel()
+	var rc goafweb.RecoveryCode
+	err := checkErr(db.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).First(&rc).Error)
+	if err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+// Create will add a new RecoveryCode to the database.
+func (rcdb *recoveryCodeDB) Create(ctx context.Context, rc *goafweb.RecoveryCode) error {
+	db, cancel := withContext(ctx, rcdb.gorm)
+	defer cancel()
+	return checkErr(db.Create(rc).Error)
+}
+
+// Use will mark a RecoveryCode as used so it can't be used again.
+// If the code was used by another request first goafweb.ErrNotFound is returned.
+func (rcdb *recoveryCodeDB) Use(ctx context.Context, rc *goafweb.RecoveryCode) error {
+	db, cancel := withContext(ctx, rcdb.gorm)
+	defer cancel()
+	now := time.Now()
+	res := db.Model(rc).Where("used_at IS NULL").UpdateColumn("used_at", now)
+	if res.Error != nil {
+		return checkErr(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return goafweb.ErrNotFound
+	}
+	rc.UsedAt = &now
+	return nil
+}
+
+// DeleteByUser will remove every RecoveryCode belonging to a User.
+func (rcdb *recoveryCodeDB) DeleteByUser(ctx context.Context, userID int) error {
+	db, cancel := withContext(ctx, rcdb.gorm)
+	defer cancel()
+	return checkErr(db.Where("user_id = ?", userID).Delete(&goafweb.RecoveryCode{}).Error)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"goafweb"
+
+	"github.com/jinzhu/gorm"
+)
+
+type roleDB struct {
+	gorm *gorm.DB
+}
+
+// NewRoleDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.RoleDB interface.
+func NewRoleDB(db *gorm.DB) *roleDB {
+	return &roleDB{
+		gorm: db,
+	}
+}
+
+// ByUser retrieves the names of all roles granted to a User.
+func (rdb *roleDB) ByUser(ctx context.Context, userID int) ([]string, error) {
+	db, cancel := withContext(ctx, rdb.gorm)
+	defer cancel()
+	roles := []string{}
+	err := checkErr(db.Model(&goafweb.UserRole{}).Where("user_id = ?", userID).Order("role").Pluck("role", &roles).Error)
+	return roles, err
+}
+
+// Grant adds a role to a User.
+// Granting a role the User already holds is not an error.
+func (rdb *roleDB) Grant(ctx context.Context, userID int, role string) error {
+	db, cancel := withContext(ctx, rdb.gorm)
+	defer cancel()
+	ur := goafweb.UserRole{UserID: userID, Role: role}
+	return checkErr(db.Where(ur).FirstOrCreate(&ur).Error)
+}
+
+// Revoke removes a role from a User.
+// This is a hard delete, there is no need to keep revoked roles around.
+func (rdb *roleDB) Revoke(ctx context.Context, userID int, role string) error {
+	db, cancel := withContext(ctx, rdb.gorm)
+	defer cancel()
+	return checkErr(db.Where("user_id = ? AND role = ?", userID, role).Delete(&goafweb.UserRole{}).Error)
+}
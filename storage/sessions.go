@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"goafweb"
+
+	"github.com/jinzhu/gorm"
+)
+
+type sessionDB struct {
+	gorm *gorm.DB
+}
+
+// NewSessionDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.SessionDB interface.
+func NewSessionDB(db *gorm.DB) *sessionDB {
+	return &sessionDB{
+		gorm: db,
+	}
+}
+
+// GetByToken will lookup a Session using the hash of the token provided by a User.
+func (sdb *sessionDB) GetByToken(ctx context.Context, tokenHash string) (*goafweb.Session, error) {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	var session goafweb.Session
+	err := checkErr(db.Where("token_hash = ?", tokenHash).First(&session).Error)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetByRotatedToken will lookup the Session a refresh token was issued under,
+// using the hash of a token that has since been exchanged.
+func (sdb *sessionDB) GetByRotatedToken(ctx context.Context, tokenHash string) (*goafweb.Session, error) {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	var rotated goafweb.RotatedToken
+	err := checkErr(db.Where("token_hash = ?", tokenHash).First(&rotated).Error)
+	if err != nil {
+		return nil, err
+	}
+	var session goafweb.Session
+	err = checkErr(db.First(&session, rotated.SessionID).Error)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ByUser will retreive every Session belonging to a User, most recently used first.
+func (sdb *sessionDB) ByUser(ctx context.Context, userID int) ([]*goafweb.Session, error) {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	sessions := []*goafweb.Session{}
+	err := checkErr(db.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&sessions).Error)
+	return sessions, err
+}
+
+// Create will add a new Session to the database.
+func (sdb *sessionDB) Create(ctx context.Context, session *goafweb.Session) error {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	return checkErr(db.Create(session).Error)
+}
+
+// Touch will update the time a Session was last seen, and its token hash in case it was rehashed.
+func (sdb *sessionDB) Touch(ctx context.Context, session *goafweb.Session) error {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	return checkErr(db.Model(session).UpdateColumns(map[string]interface{}{
+		"token_hash":   session.TokenHash,
+		"last_seen_at": session.LastSeenAt,
+	}).Error)
+}
+
+// Rotate will replace the refresh token of a Session, recording the hash of the old token.
+// The replacement only happens if the old token is still current, otherwise another request
+// has already exchanged it and goafweb.ErrNotFound is returned.
+func (sdb *sessionDB) Rotate(ctx context.Context, oldTokenHash string, session *goafweb.Session) error {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	return checkErr(transaction(db, func(tx *gorm.DB) error {
+		res := tx.Model(session).Where("token_hash = ?", oldTokenHash).UpdateColumns(map[string]interface{}{
+			"token_hash":   session.TokenHash,
+			"last_seen_at": session.LastSeenAt,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&goafweb.RotatedToken{SessionID: session.ID, TokenHash: oldTokenHash}).Error
+	}))
+}
+
+// Delete will remove a Session from the database, along with its rotated tokens.
+// Note: This is a hard delete, a revoked session can never be used again so there
+// is nothing worth keeping.
+func (sdb *sessionDB) Delete(ctx context.Context, id int) error {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	return checkErr(transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", id).Delete(&goafweb.RotatedToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&goafweb.Session{ID: id}).Error
+	}))
+}
+
+// DeleteByUser will remove every Session belonging to a User, along with their rotated tokens.
+func (sdb *sessionDB) DeleteByUser(ctx context.Context, userID int) error {
+	db, cancel := withContext(ctx, sdb.gorm)
+	defer cancel()
+	return checkErr(transaction(db, func(tx *gorm.DB) error {
+		sessions := tx.Model(&goafweb.Session{}).Select("id").Where("user_id = ?", userID).SubQuery()
+		if err := tx.Where("session_id IN ?", sessions).Delete(&goafweb.RotatedToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&goafweb.Session{}).Error
+	}))
+}
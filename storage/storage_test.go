@@ -0,0 +1,74 @@
+package storage_test
+
+import (
+	"goafweb"
+	"goafweb/storage"
+	"goafweb/storage/storagetest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TestMain runs the tests with a local time zone behind UTC, times that are stored
+// in local time rather than UTC then sort and compare wrongly in SQLite.
+func TestMain(m *testing.M) {
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	os.Exit(m.Run())
+}
+
+// newSQLite returns a migrated in-memory SQLite database.
+func newSQLite(t *testing.T) *gorm.DB {
+	db, err := storage.Open(storage.DialectSQLite, ":memory:", storage.Options{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := storage.NewMigrator(db).Up(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func TestUserDB(t *testing.T) {
+	storagetest.UserDB(t, func(t *testing.T) goafweb.UserDB {
+		return storage.NewUserDB(newSQLite(t))
+	})
+}
+
+func TestArticleDB(t *testing.T) {
+	storagetest.ArticleDB(t, func(t *testing.T) goafweb.ArticleDB {
+		return storage.NewArticleDB(newSQLite(t))
+	})
+}
+
+func TestPwResetDB(t *testing.T) {
+	storagetest.PwResetDB(t, func(t *testing.T) goafweb.PwResetDB {
+		return storage.NewPwResetDB(newSQLite(t))
+	})
+}
+
+func TestSessionDB(t *testing.T) {
+	storagetest.SessionDB(t, func(t *testing.T) goafweb.SessionDB {
+		return storage.NewSessionDB(newSQLite(t))
+	})
+}
+
+func TestOutboxDB(t *testing.T) {
+	storagetest.OutboxDB(t, func(t *testing.T) goafweb.OutboxDB {
+		return storage.NewOutboxDB(newSQLite(t))
+	})
+}
+
+func TestDeliveryStatusDB(t *testing.T) {
+	storagetest.DeliveryStatusDB(t, func(t *testing.T) goafweb.DeliveryStatusDB {
+		return storage.NewDeliveryStatusDB(newSQLite(t))
+	})
+}
+
+func TestTransactor(t *testing.T) {
+	storagetest.Transactor(t, func(t *testing.T) (goafweb.Transactor, goafweb.UserDB) {
+		db := newSQLite(t)
+		return storage.NewTransactor(db), storage.NewUserDB(db)
+	})
+}
@@ -0,0 +1,565 @@
+/*
+Package storagetest provides a contract test suite for the storage interfaces defined in goafweb.
+Every implementation is run against the same tests so they all behave the same way.
+*/
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"testing"
+	"time"
+)
+
+// UserDB tests an implementation of goafweb.UserDB.
+// newDB must return an empty database each time it is called.
+func UserDB(t *testing.T, newDB func(t *testing.T) goafweb.UserDB) {
+	ctx := context.Background()
+	t.Run("Create and get", func(t *testing.T) {
+		db := newDB(t)
+		user := &goafweb.User{Name: "Test", Email: "test@test.com", PasswordHash: "hash"}
+		if err := db.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if user.ID <= 0 || user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+			t.Fatalf("Create did not set ID and timestamps: %+v", user)
+		}
+		byID, err := db.GetByID(ctx, user.ID)
+		if err != nil || byID.Email != user.Email {
+			t.Errorf("GetByID: got %v, %v", byID, err)
+		}
+		byEmail, err := db.GetByEmail(ctx, user.Email)
+		if err != nil || byEmail.ID != user.ID {
+			t.Errorf("GetByEmail: got %v, %v", byEmail, err)
+		}
+	})
+	t.Run("Not found", func(t *testing.T) {
+		db := newDB(t)
+		if _, err := db.GetByID(ctx, 1); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("GetByID: got %v, wanted %v", err, goafweb.ErrNotFound)
+		}
+		if _, err := db.GetByEmail(ctx, "test@test.com"); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("GetByEmail: got %v, wanted %v", err, goafweb.ErrNotFound)
+		}
+	})
+	t.Run("Unique email", func(t *testing.T) {
+		db := newDB(t)
+		if err := db.Create(ctx, &goafweb.User{Email: "test@test.com", PasswordHash: "hash"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := db.Create(ctx, &goafweb.User{Email: "test@test.com", PasswordHash: "hash"}); err == nil {
+			t.Errorf("Created a second user with the same email address")
+		}
+	})
+	t.Run("Update", func(t *testing.T) {
+		db := newDB(t)
+		user := &goafweb.User{Name: "Test", Email: "test@test.com", PasswordHash: "hash"}
+		if err := db.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		now := time.Now()
+		user.Name = "Updated"
+		user.EmailVerifiedAt = &now
+		if err := db.Update(ctx, user); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, err := db.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.Name != "Updated" || !got.Verified() {
+			t.Errorf("Update was not saved, got %+v", got)
+		}
+	})
+	t.Run("UseTOTPStep", func(t *testing.T) {
+		db := newDB(t)
+		user := &goafweb.User{Name: "Test", Email: "test@test.com", PasswordHash: "hash"}
+		if err := db.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := db.UseTOTPStep(ctx, user, 10); err != nil || user.TOTPLastStep != 10 {
+			t.Fatalf("UseTOTPStep: got %v, step %d", err, user.TOTPLastStep)
+		}
+		// A copy read before the step was used must not be able to use it again.
+		stale := &goafweb.User{ID: user.ID}
+		for _, step := range []int64{10, 9} {
+			if err := db.UseTOTPStep(ctx, stale, step); !errors.Is(err, goafweb.ErrNotFound) {
+				t.Errorf("UseTOTPStep with step %d: got %v, wanted %v", step, err, goafweb.ErrNotFound)
+			}
+		}
+		got, err := db.GetByID(ctx, user.ID)
+		if err != nil || got.TOTPLastStep != 10 || got.Name != "Test" {
+			t.Errorf("GetByID after UseTOTPStep: got %+v, %v", got, err)
+		}
+		if err := db.UseTOTPStep(ctx, user, 11); err != nil {
+			t.Errorf("UseTOTPStep with a later step: %v", err)
+		}
+	})
+	t.Run("Cancelled context", func(t *testing.T) {
+		db := newDB(t)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := db.Create(cancelled, &goafweb.User{Email: "test@test.com", PasswordHash: "hash"}); err == nil {
+			t.Errorf("Create: got nil, wanted an error")
+		}
+		if _, err := db.GetByEmail(cancelled, "test@test.com"); err == nil || errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("GetByEmail: got %v, wanted a context error", err)
+		}
+	})
+}
+
+// ArticleDB tests an implementation of goafweb.ArticleDB.
+// newDB must return an empty database each time it is called.
+func ArticleDB(t *testing.T, newDB func(t *testing.T) goafweb.ArticleDB) {
+	ctx := context.Background()
+	t.Run("CRUD", func(t *testing.T) {
+		db := newDB(t)
+		article := &goafweb.Article{Title: "Title", Content: "Content", Author: 1}
+		if err := db.Create(ctx, article); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if article.ID <= 0 || article.CreatedAt.IsZero() {
+			t.Fatalf("Create did not set ID and timestamps: %+v", article)
+		}
+		article.Title = "Updated"
+		if err := db.Update(ctx, article); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, err := db.GetByID(ctx, article.ID)
+		if err != nil || got.Title != "Updated" {
+			t.Fatalf("GetByID: got %v, %v", got, err)
+		}
+		if err := db.Delete(ctx, article.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := db.GetByID(ctx, article.ID); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("GetByID after Delete: got %v, wanted %v", err, goafweb.ErrNotFound)
+		}
+		list, err := db.List(ctx, &goafweb.ArticleQuery{SortBy: goafweb.SortByID, Limit: 10})
+		if err != nil || list.Total != 0 || len(list.Articles) != 0 {
+			t.Errorf("List after Delete: got %+v, %v", list, err)
+		}
+	})
+	t.Run("List", func(t *testing.T) {
+		db := newDB(t)
+		var ids []int
+		for i := 0; i < 5; i++ {
+			article := &goafweb.Article{Title: "Title", Content: "Content", Author: 1 + i%2}
+			if err := db.Create(ctx, article); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			ids = append(ids, article.ID)
+		}
+
+		// Page forwards through every article, then back again.
+		query := &goafweb.ArticleQuery{SortBy: goafweb.SortByCreated, Limit: 2}
+		var pages [][]int
+		for {
+			list, err := db.List(ctx, query)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if list.Total != 5 {
+				t.Errorf("Got Total %d, wanted 5", list.Total)
+			}
+			pages = append(pages, articleIDs(list))
+			if list.NextCursor == "" {
+				break
+			}
+			query.Cursor = list.NextCursor
+		}
+		want := [][]int{ids[0:2], ids[2:4], ids[4:5]}
+		if !equalPages(pages, want) {
+			t.Fatalf("Got pages %v, wanted %v", pages, want)
+		}
+		list, _ := db.List(ctx, query)
+		query.Cursor = list.PrevCursor
+		if list, err := db.List(ctx, query); err != nil || !equalPages([][]int{articleIDs(list)}, want[1:2]) {
+			t.Errorf("Previous page: got %v, %v, wanted %v", articleIDs(list), err, want[1])
+		}
+		// A cursor only means something in the sort field and order it came from.
+		for _, other := range []*goafweb.ArticleQuery{
+			{SortBy: goafweb.SortByUpdated, Limit: 2, Cursor: query.Cursor},
+			{SortBy: goafweb.SortByCreated, Desc: true, Limit: 2, Cursor: query.Cursor},
+		} {
+			if _, err := db.List(ctx, other); !errors.Is(err, goafweb.ErrCursorInvalid) {
+				t.Errorf("Cursor from another sort: got %v, wanted %v", err, goafweb.ErrCursorInvalid)
+			}
+		}
+		if _, err := db.List(ctx, &goafweb.ArticleQuery{SortBy: "title; DROP TABLE articles", Limit: 2}); err == nil {
+			t.Errorf("Unknown sort field: got nil, wanted an error")
+		}
+
+		// Filters and descending order.
+		list, err := db.List(ctx, &goafweb.ArticleQuery{Author: 1, SortBy: goafweb.SortByID, Desc: true, Limit: 10})
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if got, want := articleIDs(list), []int{ids[4], ids[2], ids[0]}; !equalPages([][]int{got}, [][]int{want}) || list.Total != 3 {
+			t.Errorf("By author: got %v total %d, wanted %v total 3", got, list.Total, want)
+		}
+		list, err = db.List(ctx, &goafweb.ArticleQuery{CreatedAfter: time.Now().Add(time.Hour), SortBy: goafweb.SortByID, Limit: 10})
+		if err != nil || list.Total != 0 {
+			t.Errorf("Created after: got %+v, %v, wanted none", list, err)
+		}
+	})
+}
+
+// PwResetDB tests an implementation of goafweb.PwResetDB.
+// newDB must return an empty database each time it is called.
+func PwResetDB(t *testing.T, newDB func(t *testing.T) goafweb.PwResetDB) {
+	ctx := context.Background()
+	db := newDB(t)
+	pwr := &goafweb.PwReset{UserID: 1, TokenHash: "hash"}
+	if err := db.Create(ctx, pwr); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if pwr.ID <= 0 || pwr.CreatedAt.IsZero() {
+		t.Fatalf("Create did not set ID and timestamps: %+v", pwr)
+	}
+	got, err := db.GetByToken(ctx, "hash")
+	if err != nil || got.ID != pwr.ID || got.UserID != 1 {
+		t.Fatalf("GetByToken: got %v, %v", got, err)
+	}
+	if _, err := db.GetByToken(ctx, "other"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByToken: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if err := db.Delete(ctx, pwr.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := db.GetByToken(ctx, "hash"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByToken after Delete: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	// Deleting is how a token is used up, so of two requests using the same token only one succeeds.
+	if err := db.Delete(ctx, pwr.ID); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("Delete again: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+
+	for _, hash := range []string{"first", "second"} {
+		if err := db.Create(ctx, &goafweb.PwReset{UserID: 2, TokenHash: hash}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	other := &goafweb.PwReset{UserID: 3, TokenHash: "other"}
+	if err := db.Create(ctx, other); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := db.DeleteByUser(ctx, 2); err != nil {
+		t.Fatalf("DeleteByUser: %v", err)
+	}
+	for _, hash := range []string{"first", "second"} {
+		if _, err := db.GetByToken(ctx, hash); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("GetByToken after DeleteByUser: got %v, wanted %v", err, goafweb.ErrNotFound)
+		}
+	}
+	if _, err := db.GetByToken(ctx, "other"); err != nil {
+		t.Errorf("DeleteByUser removed another users reset: %v", err)
+	}
+
+	// Every reset so far is expired by a cutoff in the future, deleted or not.
+	n, err := db.DeleteExpired(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != 4 {
+		t.Errorf("DeleteExpired: got %d, %v, wanted 4", n, err)
+	}
+	if n, err := db.DeleteExpired(ctx, time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Errorf("DeleteExpired again: got %d, %v, wanted 0", n, err)
+	}
+	if err := db.Create(ctx, &goafweb.PwReset{UserID: 3, TokenHash: "other"}); err != nil {
+		t.Errorf("Create after DeleteExpired: %v, the old row should be gone", err)
+	}
+	// The cutoff is compared as a time, whatever its time zone.
+	ahead, behind := time.FixedZone("UTC+10", 10*60*60), time.FixedZone("UTC-10", -10*60*60)
+	if n, err := db.DeleteExpired(ctx, time.Now().Add(-time.Minute).In(ahead)); err != nil || n != 0 {
+		t.Errorf("DeleteExpired with an earlier cutoff ahead of UTC: got %d, %v, wanted 0", n, err)
+	}
+	if n, err := db.DeleteExpired(ctx, time.Now().Add(time.Minute).In(behind)); err != nil || n != 1 {
+		t.Errorf("DeleteExpired with a later cutoff behind UTC: got %d, %v, wanted 1", n, err)
+	}
+}
+
+// SessionDB tests an implementation of goafweb.SessionDB.
+// newDB must return an empty database each time it is called.
+func SessionDB(t *testing.T, newDB func(t *testing.T) goafweb.SessionDB) {
+	ctx := context.Background()
+	db := newDB(t)
+	now := time.Now().Truncate(time.Second)
+	newSession := func(userID int, hash string, lastSeen time.Time) *goafweb.Session {
+		t.Helper()
+		session := &goafweb.Session{UserID: userID, TokenHash: hash, LastSeenAt: lastSeen, ExpiresAt: now.Add(time.Hour)}
+		if err := db.Create(ctx, session); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return session
+	}
+	session := newSession(1, "hash", now.Add(-time.Hour))
+	if session.ID <= 0 || session.CreatedAt.IsZero() {
+		t.Fatalf("Create did not set ID and timestamps: %+v", session)
+	}
+	if err := db.Create(ctx, &goafweb.Session{UserID: 2, TokenHash: "hash", ExpiresAt: now}); err == nil {
+		t.Errorf("Create with a duplicate token hash: got nil, wanted an error")
+	}
+	got, err := db.GetByToken(ctx, "hash")
+	if err != nil || got.ID != session.ID || got.UserID != 1 || !got.ExpiresAt.Equal(session.ExpiresAt) {
+		t.Fatalf("GetByToken: got %+v, %v", got, err)
+	}
+	if _, err := db.GetByToken(ctx, "other"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByToken: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+
+	session.TokenHash, session.LastSeenAt = "rehashed", now
+	if err := db.Touch(ctx, session); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	got, err = db.GetByToken(ctx, "rehashed")
+	if err != nil || !got.LastSeenAt.Equal(now) {
+		t.Errorf("GetByToken after Touch: got %+v, %v", got, err)
+	}
+
+	// Rotate only replaces the token if it is still the current one, so of two requests
+	// exchanging the same token only one succeeds.
+	session.TokenHash = "rotated"
+	if err := db.Rotate(ctx, "rehashed", session); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if got, err := db.GetByToken(ctx, "rotated"); err != nil || got.ID != session.ID {
+		t.Errorf("GetByToken after Rotate: got %+v, %v", got, err)
+	}
+	if _, err := db.GetByToken(ctx, "rehashed"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByToken with the old token after Rotate: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if got, err := db.GetByRotatedToken(ctx, "rehashed"); err != nil || got.ID != session.ID || got.TokenHash != "rotated" {
+		t.Errorf("GetByRotatedToken: got %+v, %v", got, err)
+	}
+	if _, err := db.GetByRotatedToken(ctx, "rotated"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByRotatedToken with the current token: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	loser := &goafweb.Session{ID: session.ID, TokenHash: "loser", LastSeenAt: now}
+	if err := db.Rotate(ctx, "rehashed", loser); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("Rotate with a token that was already rotated: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, err := db.GetByToken(ctx, "loser"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("A failed Rotate replaced the token: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, err := db.GetByToken(ctx, "rotated"); err != nil {
+		t.Errorf("A failed Rotate removed the current token: %v", err)
+	}
+
+	// Most recently used first, other users sessions are not included.
+	older := newSession(1, "older", now.Add(-2*time.Hour))
+	other := newSession(2, "other", now)
+	sessions, err := db.ByUser(ctx, 1)
+	if err != nil || len(sessions) != 2 || sessions[0].ID != session.ID || sessions[1].ID != older.ID {
+		t.Errorf("ByUser: got %v, %v, wanted sessions %d then %d", sessions, err, session.ID, older.ID)
+	}
+
+	if err := db.Delete(ctx, older.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := db.GetByToken(ctx, "older"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByToken after Delete: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	newSession(1, "another", now)
+	if err := db.DeleteByUser(ctx, 1); err != nil {
+		t.Fatalf("DeleteByUser: %v", err)
+	}
+	if sessions, err := db.ByUser(ctx, 1); err != nil || len(sessions) != 0 {
+		t.Errorf("ByUser after DeleteByUser: got %d sessions, %v, wanted none", len(sessions), err)
+	}
+	if _, err := db.GetByRotatedToken(ctx, "rehashed"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByRotatedToken after DeleteByUser: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	if _, err := db.GetByToken(ctx, other.TokenHash); err != nil {
+		t.Errorf("DeleteByUser removed another users session: %v", err)
+	}
+}
+
+// OutboxDB tests an implementation of goafweb.OutboxDB.
+// newDB must return an empty database each time it is called.
+func OutboxDB(t *testing.T, newDB func(t *testing.T) goafweb.OutboxDB) {
+	ctx := context.Background()
+	db := newDB(t)
+	now := time.Now()
+	for i, due := range []time.Time{now.Add(-time.Minute), now.Add(-time.Hour), now.Add(time.Hour)} {
+		msg := &goafweb.OutboxMessage{
+			From:          "from@example.com",
+			To:            "to@example.com",
+			Subject:       "Subject",
+			Text:          "Text",
+			Status:        goafweb.OutboxPending,
+			NextAttemptAt: due,
+		}
+		if err := db.Create(ctx, msg); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if msg.ID != i+1 || msg.CreatedAt.IsZero() {
+			t.Fatalf("Create did not set ID and timestamps: %+v", msg)
+		}
+	}
+	got, err := db.GetByID(ctx, 1)
+	if err != nil || got.Text != "Text" || got.Status != goafweb.OutboxPending {
+		t.Fatalf("GetByID: got %+v, %v", got, err)
+	}
+	if _, err := db.GetByID(ctx, 99); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByID: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+
+	// Only the two due messages are claimed, the longest overdue first.
+	claimed, err := db.Claim(ctx, now, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if len(claimed) != 2 || claimed[0].ID != 2 || claimed[1].ID != 1 {
+		t.Fatalf("Claim: got %+v, wanted messages 2 and 1", claimed)
+	}
+	for _, msg := range claimed {
+		if msg.Attempts != 1 || msg.NextAttemptAt.Before(now.Add(time.Minute).Add(-time.Second)) {
+			t.Errorf("Claim did not count an attempt and lease message %d: %+v", msg.ID, msg)
+		}
+	}
+	// Leased messages are not claimed again until the lease ends.
+	if again, err := db.Claim(ctx, now, time.Minute, 10); err != nil || len(again) != 0 {
+		t.Errorf("Claim during lease: got %d messages, %v, wanted none", len(again), err)
+	}
+	if again, err := db.Claim(ctx, now.Add(2*time.Minute), time.Minute, 1); err != nil || len(again) != 1 || again[0].Attempts != 2 {
+		t.Errorf("Claim after lease with limit 1: got %+v, %v, wanted one message on its second attempt", again, err)
+	}
+
+	sentAt := now
+	msg := claimed[0]
+	msg.Status, msg.SentAt, msg.Text = goafweb.OutboxSent, &sentAt, ""
+	if err := db.Update(ctx, msg); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := db.GetByID(ctx, msg.ID); err != nil || got.Status != goafweb.OutboxSent || got.SentAt == nil || got.Text != "" {
+		t.Errorf("GetByID after Update: got %+v, %v", got, err)
+	}
+	if again, err := db.Claim(ctx, now.Add(time.Hour*2), time.Minute, 10); err != nil || len(again) != 2 {
+		t.Errorf("Claim: got %d messages, %v, a sent message should not be claimed", len(again), err)
+	}
+
+	all, err := db.List(ctx, "", 10)
+	if err != nil || len(all) != 3 || all[0].ID != 3 {
+		t.Errorf("List: got %d messages, %v, wanted 3 newest first", len(all), err)
+	}
+	sent, err := db.List(ctx, goafweb.OutboxSent, 10)
+	if err != nil || len(sent) != 1 || sent[0].ID != msg.ID {
+		t.Errorf("List sent: got %+v, %v", sent, err)
+	}
+	if limited, err := db.List(ctx, "", 2); err != nil || len(limited) != 2 {
+		t.Errorf("List with limit 2: got %d messages, %v", len(limited), err)
+	}
+}
+
+// DeliveryStatusDB tests an implementation of goafweb.DeliveryStatusDB.
+// newDB must return an empty database each time it is called.
+func DeliveryStatusDB(t *testing.T, newDB func(t *testing.T) goafweb.DeliveryStatusDB) {
+	ctx := context.Background()
+	db := newDB(t)
+	if _, err := db.GetByEmail(ctx, "user@example.com"); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("GetByEmail: got %v, wanted %v", err, goafweb.ErrNotFound)
+	}
+	ds := &goafweb.DeliveryStatus{Email: "user@example.com", Status: goafweb.DeliveryDelivered, LastEventAt: time.Now()}
+	if err := db.Save(ctx, ds); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if ds.ID <= 0 || ds.CreatedAt.IsZero() {
+		t.Fatalf("Save did not set ID and timestamps: %+v", ds)
+	}
+	ds.Status, ds.Suppressed, ds.Reason = goafweb.DeliveryBounced, true, "No such user"
+	if err := db.Save(ctx, ds); err != nil {
+		t.Fatalf("Save existing: %v", err)
+	}
+	got, err := db.GetByEmail(ctx, "user@example.com")
+	if err != nil || got.ID != ds.ID || got.Status != goafweb.DeliveryBounced || !got.Suppressed || got.Reason != "No such user" {
+		t.Errorf("GetByEmail after Save: got %+v, %v", got, err)
+	}
+	if err := db.Save(ctx, &goafweb.DeliveryStatus{Email: "user@example.com", Status: goafweb.DeliveryDelivered}); err == nil {
+		t.Error("Save of a second status for the same address should fail")
+	}
+}
+
+// Transactor tests an implementation of goafweb.Transactor, using a goafweb.UserDB from the
+// same database to make changes. newDB must return an empty database each time it is called.
+func Transactor(t *testing.T, newDB func(t *testing.T) (goafweb.Transactor, goafweb.UserDB)) {
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+	t.Run("Commit", func(t *testing.T) {
+		tx, db := newDB(t)
+		err := tx.InTx(ctx, func(ctx context.Context) error {
+			if err := db.Create(ctx, &goafweb.User{Email: "test@test.com", PasswordHash: "hash"}); err != nil {
+				return err
+			}
+			// Changes are visible inside the transaction before it commits.
+			_, err := db.GetByEmail(ctx, "test@test.com")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("InTx: %v", err)
+		}
+		if _, err := db.GetByEmail(ctx, "test@test.com"); err != nil {
+			t.Errorf("GetByEmail after commit: %v", err)
+		}
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		tx, db := newDB(t)
+		err := tx.InTx(ctx, func(ctx context.Context) error {
+			if err := db.Create(ctx, &goafweb.User{Email: "test@test.com", PasswordHash: "hash"}); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("InTx: got %v, wanted %v", err, errRollback)
+		}
+		if _, err := db.GetByEmail(ctx, "test@test.com"); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("GetByEmail after rollback: got %v, wanted %v", err, goafweb.ErrNotFound)
+		}
+	})
+	t.Run("Nested", func(t *testing.T) {
+		tx, db := newDB(t)
+		err := tx.InTx(ctx, func(ctx context.Context) error {
+			err := tx.InTx(ctx, func(ctx context.Context) error {
+				return db.Create(ctx, &goafweb.User{Email: "test@test.com", PasswordHash: "hash"})
+			})
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("InTx: got %v, wanted %v", err, errRollback)
+		}
+		if _, err := db.GetByEmail(ctx, "test@test.com"); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("Inner transaction committed on its own, got %v", err)
+		}
+	})
+}
+
+func articleIDs(list *goafweb.ArticleList) []int {
+	if list == nil {
+		return nil
+	}
+	ids := make([]int, len(list.Articles))
+	for i, a := range list.Articles {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+func equalPages(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"goafweb"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type throttleDB struct {
+	gorm *gorm.DB
+}
+
+// NewThrottleDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.ThrottleDB interface.
+func NewThrottleDB(db *gorm.DB) *throttleDB {
+	return &throttleDB{
+		gorm: db,
+	}
+}
+
+// Get retrieves the Throttle for key.
+func (tdb *throttleDB) Get(ctx context.Context, key string) (*goafweb.Throttle, error) {
+	db, cancel := withContext(ctx, tdb.gorm)
+	defer cancel()
+	var t goafweb.Throttle
+	err := checkErr(db.Where(map[string]interface{}{"key": key}).First(&t).Error)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Increment adds a failure to the Throttle for key in a single update, so concurrent
+// failures are all counted. The Throttle is created on the first failure.
+func (tdb *throttleDB) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*goafweb.Throttle, error) {
+	db, cancel := withContext(ctx, tdb.gorm)
+	defer cancel()
+	now = utc(now)
+	updated, err := tdb.increment(db, key, now, window)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		t := goafweb.Throttle{Key: key, Failures: 1, LastFailureAt: now}
+		if err := db.Create(&t).Error; err != nil {
+			// Another request may have created it first, count against that one instead.
+			if updated, err2 := tdb.increment(db, key, now, window); err2 != nil || !updated {
+				return nil, checkErr(err)
+			}
+		}
+	}
+	return tdb.Get(ctx, key)
+}
+
+// increment reports whether there was a Throttle for key to update.
+func (tdb *throttleDB) increment(db *gorm.DB, key string, now time.Time, window time.Duration) (bool, error) {
+	// "key" is reserved in some dialects so must be quoted.
+	query := fmt.Sprintf(`UPDATE throttles SET
+		failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+		last_failure_at = ?, updated_at = ?
+		WHERE %s = ?`, db.Dialect().Quote("key"))
+	res := db.Exec(query, now.Add(-window), now, now, key)
+	if res.Error != nil {
+		return false, checkErr(res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// Lock stops any attempts against key until the time given.
+func (tdb *throttleDB) Lock(ctx context.Context, key string, until time.Time) error {
+	db, cancel := withContext(ctx, tdb.gorm)
+	defer cancel()
+	return checkErr(db.Model(&goafweb.Throttle{}).Where(map[string]interface{}{"key": key}).
+		UpdateColumn("locked_until", until).Error)
+}
+
+// Delete will remove the Throttle for key.
+func (tdb *throttleDB) Delete(ctx context.Context, key string) error {
+	db, cancel := withContext(ctx, tdb.gorm)
+	defer cancel()
+	return checkErr(db.Where(map[string]interface{}{"key": key}).Delete(&goafweb.Throttle{}).Error)
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// txKey is the context key a transaction started by a Transactor is stored under.
+type txKey struct{}
+
+type transactor struct {
+	gorm *gorm.DB
+}
+
+// NewTransactor returns a new service that implements a gorm database connection
+// that fulfils goafweb.Transactor interface.
+func NewTransactor(db *gorm.DB) *transactor {
+	return &transactor{
+		gorm: db,
+	}
+}
+
+// InTx runs fn in a transaction, which is committed if fn returns nil and rolled back otherwise.
+// Every storage call made with the context passed to fn is part of the transaction.
+// If ctx is already in a transaction fn joins it, and only the outermost InTx commits.
+// Note: The transaction is not limited by the QueryTimeout, only by ctx.
+func (t *transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	tx := t.gorm.BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return checkErr(tx.Error)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rbErr := tx.Rollback().Error; rbErr != nil && rbErr != sql.ErrTxDone {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return checkErr(tx.Commit().Error)
+}
+
+// transaction runs fn in a transaction, or as part of the one db is already in.
+// gorm can't start a transaction inside another, so this is used instead of db.Transaction.
+func transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fn(db)
+	}
+	return db.Transaction(fn)
+}
@@ -6,8 +6,8 @@ adheres to the types defined in goafweb.
 package storage
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"goafweb"
 
 	"github.com/jinzhu/gorm"
@@ -32,23 +32,27 @@ func checkErr(err error) error {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return goafweb.ErrNotFound
 		}
-		return fmt.Errorf("Database error: %v", err)
+		return goafweb.Internal("Database error", err)
 	}
 	return nil
 }
 
 // GetByID retrieves a User from the DB using the unique ID for lookup.
 // ID provided must be greater than 0.
-func (udb *userDB) GetByID(id int) (*goafweb.User, error) {
+func (udb *userDB) GetByID(ctx context.Context, id int) (*goafweb.User, error) {
+	db, cancel := withContext(ctx, udb.gorm)
+	defer cancel()
 	var user goafweb.User
-	err := checkErr(udb.gorm.First(&user, id).Error)
+	err := checkErr(db.First(&user, id).Error)
 	return &user, err
 }
 
 // GetByEmail retrieves a User from the DB using their email address for lookup.
-func (udb *userDB) GetByEmail(email string) (*goafweb.User, error) {
+func (udb *userDB) GetByEmail(ctx context.Context, email string) (*goafweb.User, error) {
+	db, cancel := withContext(ctx, udb.gorm)
+	defer cancel()
 	var user goafweb.User
-	err := checkErr(udb.gorm.Where("email = ?", email).First(&user).Error)
+	err := checkErr(db.Where("email = ?", email).First(&user).Error)
 	return &user, err
 }
 
@@ -61,11 +65,31 @@ func (udb *userDB) GetByRemember(token string) (*goafweb.User, error) {
 
 // Create adds a new User to the database.
 // Returns the user once its been added.
-func (udb *userDB) Create(user *goafweb.User) error {
-	return checkErr(udb.gorm.Create(user).Error)
+func (udb *userDB) Create(ctx context.Context, user *goafweb.User) error {
+	db, cancel := withContext(ctx, udb.gorm)
+	defer cancel()
+	return checkErr(db.Create(user).Error)
 }
 
 // Update updates an existing record in the database.
-func (udb *userDB) Update(user *goafweb.User) error {
-	return checkErr(udb.gorm.Save(user).Error)
+func (udb *userDB) Update(ctx context.Context, user *goafweb.User) error {
+	db, cancel := withContext(ctx, udb.gorm)
+	defer cancel()
+	return checkErr(db.Save(user).Error)
+}
+
+// UseTOTPStep sets the Users TOTPLastStep to step with a conditional update, so it fails with
+// goafweb.ErrNotFound if the same or a later step has already been used.
+func (udb *userDB) UseTOTPStep(ctx context.Context, user *goafweb.User, step int64) error {
+	db, cancel := withContext(ctx, udb.gorm)
+	defer cancel()
+	res := db.Model(&goafweb.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).UpdateColumn("totp_last_step", step)
+	if res.Error != nil {
+		return checkErr(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return goafweb.ErrNotFound
+	}
+	user.TOTPLastStep = step
+	return nil
 }
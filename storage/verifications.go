@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"goafweb"
+
+	"github.com/jinzhu/gorm"
+)
+
+type emailVerificationDB struct {
+	gorm *gorm.DB
+}
+
+// NewEmailVerificationDB returns a new service that implements a gorm database connection
+// that fulfils goafweb.EmailVerificationDB interface.
+func NewEmailVerificationDB(db *gorm.DB) *emailVerificationDB {
+	return &emailVerificationDB{
+		gorm: db,
+	}
+}
+
+// GetByToken will lookup an EmailVerification using the token provided by the a User.
+func (evdb *emailVerificationDB) GetByToken(ctx context.Context, tokenHash string) (*goafweb.EmailVerification, error) {
+	db, cancel := withContext(ctx, evdb.gorm)
+	defer cancel()
+	var ev goafweb.EmailVerification
+	err := checkErr(db.Where("token_hash = ?", tokenHash).First(&ev).Error)
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// LatestByUser will lookup the most recently created EmailVerification for a User.
+func (evdb *emailVerificationDB) LatestByUser(ctx context.Context, userID int) (*goafweb.EmailVerification, error) {
+	db, cancel := withContext(ctx, evdb.gorm)
+	defer cancel()
+	var ev goafweb.EmailVerification
+	err := checkErr(db.Where("user_id = ?", userID).Order("created_at DESC").First(&ev).Error)
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// Create will add a new EmailVerification to the database.
+func (evdb *emailVerificationDB) Create(ctx context.Context, ev *goafweb.EmailVerification) error {
+	db, cancel := withContext(ctx, evdb.gorm)
+	defer cancel()
+	return checkErr(db.Create(ev).Error)
+}
+
+// DeleteByUser will remove every EmailVerification belonging to a User.
+// Note: This is a soft delete, EmailVerification will have DeletedAt field updated to time.Now()
+// making it invisible to normal queries, but will still retreival when needed.
+func (evdb *emailVerificationDB) DeleteByUser(ctx context.Context, userID int) error {
+	db, cancel := withContext(ctx, evdb.gorm)
+	defer cancel()
+	return checkErr(db.Where("user_id = ?", userID).Delete(&goafweb.EmailVerification{}).Error)
+}
@@ -0,0 +1,117 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LockoutPolicy configures how failed attempts to log in or reset a password are throttled.
+// After each failure the next attempt is delayed by BaseDelay, doubling with every further
+// failure up to MaxDelay. Once MaxFailures is reached the account is locked for LockDuration,
+// IP addresses are locked in the same way after IPMaxFailures.
+// Failures are forgotten once there have been none for Window.
+type LockoutPolicy struct {
+	MaxFailures   int
+	IPMaxFailures int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	LockDuration  time.Duration
+	Window        time.Duration
+	// MaxResetRequests limits how many password resets can be requested per account or IP in Window.
+	MaxResetRequests int
+}
+
+// WithLockout enables throttling of failed logins and password reset requests.
+func WithLockout(policy LockoutPolicy) UserServiceOpt {
+	return func(us *userService) {
+		us.lockout = policy
+	}
+}
+
+// Throttle keys for each action that is throttled.
+func loginAccountKey(email string) string { return "login:account:" + normalizeThrottleEmail(email) }
+func loginIPKey(ip string) string         { return "login:ip:" + ip }
+func resetAccountKey(email string) string { return "reset:account:" + normalizeThrottleEmail(email) }
+func resetIPKey(ip string) string         { return "reset:ip:" + ip }
+
+// normalizeThrottleEmail makes sure the same account is throttled however the email address is typed.
+// The key is by email rather than user so that unknown addresses are throttled the same as real ones.
+func normalizeThrottleEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// throttled reports whether throttling is enabled.
+func (us *userService) throttled() bool {
+	return us.throttleDB != nil && us.lockout.MaxFailures > 0
+}
+
+// checkThrottle returns a RetryError if any of the keys are locked or still backing off.
+func (us *userService) checkThrottle(ctx context.Context, keys ...string) error {
+	if !us.throttled() {
+		return nil
+	}
+	now := us.now()
+	for _, key := range keys {
+		t, err := us.throttleDB.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("Could not check attempts: %w", err)
+		}
+		if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+			return &RetryError{Err: ErrLocked, RetryAfter: t.LockedUntil.Sub(now)}
+		}
+		if t.Failures == 0 || now.Sub(t.LastFailureAt) > us.lockout.Window {
+			continue
+		}
+		if wait := t.LastFailureAt.Add(us.backoff(t.Failures)).Sub(now); wait > 0 {
+			return &RetryError{Err: ErrRateLimited, RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt against key, locking it once it reaches max failures.
+func (us *userService) recordFailure(ctx context.Context, key string, max int) error {
+	if !us.throttled() {
+		return nil
+	}
+	now := us.now()
+	t, err := us.throttleDB.Increment(ctx, key, now, us.lockout.Window)
+	if err != nil {
+		return fmt.Errorf("Could not record attempt: %w", err)
+	}
+	if max > 0 && t.Failures >= max {
+		if err := us.throttleDB.Lock(ctx, key, now.Add(us.lockout.LockDuration)); err != nil {
+			return fmt.Errorf("Could not lock: %w", err)
+		}
+	}
+	return nil
+}
+
+// clearThrottle forgets any failed attempts against key.
+func (us *userService) clearThrottle(ctx context.Context, key string) error {
+	if !us.throttled() {
+		return nil
+	}
+	if err := us.throttleDB.Delete(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("Could not clear attempts: %w", err)
+	}
+	return nil
+}
+
+// backoff returns how long to wait after the given number of failures.
+func (us *userService) backoff(failures int) time.Duration {
+	delay := us.lockout.BaseDelay
+	for i := 1; i < failures && delay < us.lockout.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > us.lockout.MaxDelay {
+		delay = us.lockout.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,39 @@
+package goafweb_test
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/storage/memory"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateLockout(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t,
+		goafweb.WithLockout(goafweb.LockoutPolicy{MaxFailures: 3, IPMaxFailures: 10, LockDuration: time.Minute, Window: time.Minute}),
+	)
+	user := us.createUser(t, "test@test.com")
+
+	for i := 0; i < 3; i++ {
+		if _, err := us.Authenticate(ctx, user.Email, "wrong", "127.0.0.1"); !errors.Is(err, goafweb.ErrPWInvalid) {
+			t.Fatalf("Attempt %d: got %v, wanted %v", i+1, err, goafweb.ErrPWInvalid)
+		}
+	}
+	// The correct password is refused while the account is locked, whatever case the email is in.
+	_, err := us.Authenticate(ctx, "TEST@test.com", "password", "10.0.0.1")
+	var retry *goafweb.RetryError
+	if !errors.Is(err, goafweb.ErrLocked) || !errors.As(err, &retry) || retry.RetryAfter <= 0 {
+		t.Fatalf("Got %v, wanted %v with a RetryAfter", err, goafweb.ErrLocked)
+	}
+
+	// Once the lock expires the correct password works and the failures are forgotten.
+	us.clock.Add(time.Minute + time.Second)
+	if _, err := us.Authenticate(ctx, user.Email, "password", "127.0.0.1"); err != nil {
+		t.Fatalf("Got %v, wanted nil", err)
+	}
+	if _, err := memory.NewThrottleDB(us.db).Get(ctx, goafweb.LoginAccountKey(user.Email)); !errors.Is(err, goafweb.ErrNotFound) {
+		t.Errorf("Failures were not cleared after a successful login")
+	}
+}
@@ -0,0 +1,167 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// accessTokenTTL is how long an access token can be used before it must be refreshed.
+// Revoking a Session only takes effect once its access tokens expire, so keep this short.
+const accessTokenTTL = 15 * time.Minute
+
+// Token types, so a token signed for one purpose can't be used for another.
+const (
+	tokenTypeAccess = "access"
+	tokenTypeMFA    = "mfa"
+)
+
+// TokenPair is issued to a User when they log in or refresh their tokens.
+// The AccessToken authenticates requests, the RefreshToken can be exchanged once for a new TokenPair.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AccessClaims are the details of a User carried in a signed access token,
+// so requests can be authenticated without a database lookup.
+type AccessClaims struct {
+	Type        string      `json:"typ"`
+	UserID      int         `json:"uid"`
+	SessionID   int         `json:"sid"`
+	Name        string      `json:"name"`
+	Email       string      `json:"email"`
+	Permissions Permissions `json:"perms"`
+	VerifiedAt  int64       `json:"verified_at,omitempty"`
+	IssuedAt    int64       `json:"iat"`
+	ExpiresAt   int64       `json:"exp"`
+}
+
+// User returns the User the claims were issued to.
+func (c *AccessClaims) User() *User {
+	user := User{ID: c.UserID, Name: c.Name, Email: c.Email}
+	if c.VerifiedAt != 0 {
+		verifiedAt := time.Unix(c.VerifiedAt, 0)
+		user.EmailVerifiedAt = &verifiedAt
+	}
+	return &user
+}
+
+// Session returns the Session the claims were issued under.
+func (c *AccessClaims) Session() *Session {
+	return &Session{ID: c.SessionID, UserID: c.UserID}
+}
+
+// TokenSigner defines how access tokens are signed and verified.
+type TokenSigner interface {
+	Sign(claims interface{}) (string, error)
+	Verify(token string, dest interface{}) error
+}
+
+// Login starts a new Session for the User and issues them a TokenPair.
+// The Session groups every refresh token issued from this login, so they can be revoked together.
+// If the User has enabled two factor authentication ErrMFARequired is returned instead,
+// and they must log in with LoginMFA.
+func (us *userService) Login(ctx context.Context, user *User, userAgent, ip string) (*TokenPair, error) {
+	if user.TOTPEnabled() {
+		return nil, ErrMFARequired
+	}
+	return us.login(ctx, user, userAgent, ip)
+}
+
+// login starts a new Session for the User once they are fully authenticated.
+func (us *userService) login(ctx context.Context, user *User, userAgent, ip string) (*TokenPair, error) {
+	session, err := us.CreateSession(ctx, user, userAgent, ip)
+	if err != nil {
+		return nil, err
+	}
+	return us.issueTokens(ctx, user, session)
+}
+
+// Refresh exchanges a refresh token for a new TokenPair, the old refresh token can't be used again.
+// If a refresh token that has already been exchanged is presented it has most likely been stolen,
+// so the whole Session is revoked and ErrTokenReused returned.
+func (us *userService) Refresh(ctx context.Context, token string) (*TokenPair, error) {
+	session, err := us.sessionDB.GetByToken(ctx, token)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("Could not retreive session: %w", err)
+		}
+		if used, err := us.sessionDB.GetByRotatedToken(ctx, token); err == nil {
+			us.sessionDB.Delete(ctx, used.ID)
+			return nil, ErrTokenReused
+		}
+		return nil, ErrTokenInvalid
+	}
+	now := us.now()
+	if now.After(session.ExpiresAt) {
+		us.sessionDB.Delete(ctx, session.ID)
+		return nil, ErrSessionExpired
+	}
+	user, err := us.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retreive user: %w", err)
+	}
+	session.LastSeenAt = now
+	if err := us.sessionDB.Rotate(ctx, token, session); err != nil {
+		// Another request exchanged the token first.
+		if errors.Is(err, ErrNotFound) {
+			us.sessionDB.Delete(ctx, session.ID)
+			return nil, ErrTokenReused
+		}
+		return nil, fmt.Errorf("Could not rotate refresh token: %w", err)
+	}
+	return us.issueTokens(ctx, user, session)
+}
+
+// VerifyAccessToken checks the signature and expiry of an access token and returns its claims.
+func (us *userService) VerifyAccessToken(token string) (*AccessClaims, error) {
+	return us.verifyClaims(token, tokenTypeAccess)
+}
+
+// verifyClaims checks the signature, type and expiry of a signed token and returns its claims.
+func (us *userService) verifyClaims(token, tokenType string) (*AccessClaims, error) {
+	var claims AccessClaims
+	if err := us.signer.Verify(token, &claims); err != nil || claims.Type != tokenType {
+		return nil, ErrTokenInvalid
+	}
+	if us.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// issueTokens signs a new access token for the User and pairs it with the Session's refresh token.
+func (us *userService) issueTokens(ctx context.Context, user *User, session *Session) (*TokenPair, error) {
+	perms, err := us.Permissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := us.now()
+	claims := AccessClaims{
+		Type:        tokenTypeAccess,
+		UserID:      user.ID,
+		SessionID:   session.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Permissions: perms,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(accessTokenTTL).Unix(),
+	}
+	if user.Verified() {
+		claims.VerifiedAt = user.EmailVerifiedAt.Unix()
+	}
+	access, err := us.signer.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("Could not sign access token: %w", err)
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: session.Token,
+	}, nil
+}
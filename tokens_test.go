@@ -0,0 +1,131 @@
+package goafweb_test
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	first, err := us.Login(ctx, user, "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	second, err := us.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh did not rotate the refresh token")
+	}
+	firstClaims, err := us.VerifyAccessToken(first.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	secondClaims, err := us.VerifyAccessToken(second.AccessToken)
+	if err != nil || secondClaims.SessionID != firstClaims.SessionID || secondClaims.UserID != user.ID {
+		t.Fatalf("VerifyAccessToken: got %+v, %v, wanted a token for the same session", secondClaims, err)
+	}
+	third, err := us.Refresh(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh with the rotated token: %v", err)
+	}
+
+	us.clock.Add(goafweb.AccessTokenTTL)
+	if _, err := us.VerifyAccessToken(third.AccessToken); !errors.Is(err, goafweb.ErrTokenExpired) {
+		t.Errorf("Expired access token: got %v, wanted %v", err, goafweb.ErrTokenExpired)
+	}
+	if _, err := us.Refresh(ctx, "not a token"); !errors.Is(err, goafweb.ErrTokenInvalid) {
+		t.Errorf("Unknown refresh token: got %v, wanted %v", err, goafweb.ErrTokenInvalid)
+	}
+}
+
+func TestRefreshReuse(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	stolen, err := us.Login(ctx, user, "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	current, err := us.Refresh(ctx, stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := us.Refresh(ctx, stolen.RefreshToken); !errors.Is(err, goafweb.ErrTokenReused) {
+		t.Fatalf("Replayed refresh token: got %v, wanted %v", err, goafweb.ErrTokenReused)
+	}
+	// The whole session is revoked, including the token issued to whoever refreshed first.
+	if _, err := us.Refresh(ctx, current.RefreshToken); !errors.Is(err, goafweb.ErrTokenInvalid) {
+		t.Errorf("Refresh after reuse: got %v, wanted %v", err, goafweb.ErrTokenInvalid)
+	}
+	if sessions, err := us.Sessions(ctx, user.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("Got %d sessions, %v after reuse, wanted none", len(sessions), err)
+	}
+}
+
+func TestRefreshExpiredSession(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	tokens, err := us.Login(ctx, user, "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	us.clock.Add(goafweb.SessionTTL + time.Second)
+	if _, err := us.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, goafweb.ErrSessionExpired) {
+		t.Errorf("Got %v, wanted %v", err, goafweb.ErrSessionExpired)
+	}
+	if _, err := us.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, goafweb.ErrTokenInvalid) {
+		t.Errorf("Refresh after expiry: got %v, wanted %v as the session is removed", err, goafweb.ErrTokenInvalid)
+	}
+}
+
+// Two requests refreshing the same token at once must not both get new tokens.
+func TestRefreshRace(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	for i := 0; i < 20; i++ {
+		tokens, err := us.Login(ctx, user, "agent", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		var wg sync.WaitGroup
+		results := make([]*goafweb.TokenPair, 2)
+		errs := make([]error, 2)
+		for j := range results {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				results[j], errs[j] = us.Refresh(ctx, tokens.RefreshToken)
+			}(j)
+		}
+		wg.Wait()
+		winners, reused := 0, 0
+		for j, err := range errs {
+			switch {
+			case err == nil:
+				winners++
+				// The loser revoked the session, so the winners tokens are dead too.
+				if _, err := us.Refresh(ctx, results[j].RefreshToken); err == nil {
+					t.Errorf("Refresh with the winning token after a race: got nil, wanted the session to be revoked")
+				}
+			case errors.Is(err, goafweb.ErrTokenReused):
+				reused++
+			default:
+				t.Fatalf("Refresh: %v", err)
+			}
+		}
+		if winners != 1 || reused != 1 {
+			t.Fatalf("Got %d winners and %d ErrTokenReused, wanted one of each", winners, reused)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Package totp implements time-based one-time passwords as described in RFC 6238,
+compatible with authenticator apps such as Google Authenticator.
+*/
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"goafweb/rand"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of a generated code.
+	Digits = 6
+	// Period is how long each code is valid for.
+	Period = 30 * time.Second
+	// SecretBytes is the size of a generated secret, 160 bits as recommended by RFC 4226.
+	SecretBytes = 20
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret generates a random secret to share with an authenticator app.
+func NewSecret() ([]byte, error) {
+	return rand.Bytes(SecretBytes)
+}
+
+// EncodeSecret returns the secret in the base32 form authenticator apps expect when entered by hand.
+func EncodeSecret(secret []byte) string {
+	return b32.EncodeToString(secret)
+}
+
+// URI returns an otpauth:// URI for the secret, which can be shown as a QR code for an app to scan.
+func URI(issuer, account string, secret []byte) string {
+	v := url.Values{}
+	v.Set("secret", EncodeSecret(secret))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Step returns the time step t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for the secret at the given time step.
+func Code(secret []byte, step int64) string {
+	return hotp(secret, step, Digits)
+}
+
+// Validate checks code against the secret at time t, allowing skew steps either side
+// to cope with clock drift. It returns the step the code matched so callers can refuse
+// a code being used twice.
+func Validate(secret []byte, code string, t time.Time, skew int) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, now+i)), []byte(code)) == 1 {
+			return now + i, true
+		}
+	}
+	return 0, false
+}
+
+// hotp computes an HMAC-based one-time password as described in RFC 4226.
+func hotp(secret []byte, counter int64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, bin%mod)
+}
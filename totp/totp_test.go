@@ -0,0 +1,51 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 Appendix B, using the SHA1 secret.
+func TestHOTPVectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range tests {
+		step := Step(time.Unix(unix, 0))
+		if got := hotp(secret, step, 8); got != want {
+			t.Errorf("At %d: got %s, wanted %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	code := Code(secret, Step(now))
+
+	tests := map[string]struct {
+		want bool
+		code string
+		at   time.Time
+	}{
+		"Current step":   {want: true, code: code, at: now},
+		"Previous step":  {want: true, code: code, at: now.Add(Period)},
+		"Too old":        {want: false, code: code, at: now.Add(2 * Period)},
+		"Wrong code":     {want: false, code: "000000", at: now},
+		"Wrong length":   {want: false, code: "12345", at: now},
+		"Padded by user": {want: true, code: " " + code + " ", at: now},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, got := Validate(secret, tc.code, tc.at, 1); got != tc.want {
+				t.Errorf("Got %v, wanted %v", got, tc.want)
+			}
+		})
+	}
+}
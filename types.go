@@ -1,6 +1,7 @@
 package goafweb
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -8,16 +9,32 @@ import (
 // User defines a single User as stored in the database.
 // Used to model a user single user throughout the app and mirror in database.
 type User struct {
-	ID            int    `gorm:"primary_key;"`
-	Name          string `gorm:"not_null;"`
-	Email         string `gorm:"not_null;unique_index;" json:"email"`
-	Password      string `gorm:"-" `
-	PasswordHash  string `gorm:"not_null;"`
-	RememberToken string `gorm:"-"`
-	RememberHash  string `gorm:"not_null;unique_index;"`
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	DeletedAt     *time.Time
+	ID           int    `gorm:"primary_key;"`
+	Name         string `gorm:"not_null;"`
+	Email        string `gorm:"not_null;unique_index;" json:"email"`
+	Password     string `gorm:"-" `
+	PasswordHash string `gorm:"not_null;"`
+	// EmailVerifiedAt is nil until the User follows the link sent to their email address.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TOTPSecret is stored encrypted, it is set when the User starts enrolling in two factor
+	// authentication but is only used once TOTPEnabledAt is set by confirming a code.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	// TOTPLastStep is the time step of the last code used, so a code can't be used twice.
+	TOTPLastStep int64 `json:"-"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time
+}
+
+// Verified reports whether the User has verified their email address.
+func (u User) Verified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// TOTPEnabled reports whether the User must provide a TOTP code to log in.
+func (u User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
 
 // String retrns a User as a human readable value.
@@ -27,22 +44,166 @@ func (u User) String() string {
 
 // UserService defines the API for interacting with a User.
 type UserService interface {
-	Authenticate(email, password string) (*User, error)
+	Authenticate(ctx context.Context, email, password, ip string) (*User, error)
 	UserDB
-	InitiatePWReset(email string) (string, error)
-	CompletePWReset(token, newPW string) (*User, error)
+	SignUp(ctx context.Context, user *User) (string, error)
+	Login(ctx context.Context, user *User, userAgent, ip string) (*TokenPair, error)
+	MFAChallenge(user *User) (string, error)
+	LoginMFA(ctx context.Context, challenge, code, userAgent, ip string) (*TokenPair, error)
+	EnrollTOTP(ctx context.Context, userID int) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID int, code string) error
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	VerifyAccessToken(token string) (*AccessClaims, error)
+	CreateSession(ctx context.Context, user *User, userAgent, ip string) (*Session, error)
+	UserBySession(ctx context.Context, token string) (*User, *Session, error)
+	Sessions(ctx context.Context, userID int) ([]*Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID int) error
+	RevokeSessions(ctx context.Context, userID int) error
+	InitiateVerification(ctx context.Context, userID int) (string, error)
+	CompleteVerification(ctx context.Context, token string) (*User, error)
+	InitiatePWReset(ctx context.Context, email, ip string) (string, error)
+	CompletePWReset(ctx context.Context, token, newPW string) (*User, error)
+	PurgePWResets(ctx context.Context) (int, error)
+	ChangePassword(ctx context.Context, userID, sessionID int, currentPW, newPW string) error
+	GrantRole(ctx context.Context, userID int, role string) error
+	RevokeRole(ctx context.Context, userID int, role string) error
+	Roles(ctx context.Context, userID int) ([]string, error)
+	Permissions(ctx context.Context, userID int) (Permissions, error)
 }
 
 // UserDB defines all database interactions for a single user.
 type UserDB interface {
 	// Standard CRUD actions.
 	// Read - Methods for querying a user.
-	GetByID(id int) (*User, error)
-	GetByEmail(email string) (*User, error)
-	GetByRemember(token string) (*User, error)
+	GetByID(ctx context.Context, id int) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
 	// Methods for altering a user.
-	Create(user *User) error
-	Update(user *User) error
+	Create(ctx context.Context, user *User) error
+	Update(ctx context.Context, user *User) error
+	// UseTOTPStep records step as the last TOTP step the User used, only if it is later than the one stored,
+	// so of two logins with the same code only one succeeds. It returns ErrNotFound otherwise.
+	UseTOTPStep(ctx context.Context, user *User, step int64) error
+}
+
+// Transactor runs several storage calls as one unit of work.
+// Every call made with the context passed to fn is part of the transaction, which is
+// committed if fn returns nil and rolled back if it returns an error.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Session defines a single device a User is logged in on, as stored in the database.
+// Each login creates a new Session so a User can stay logged in on several devices.
+// The Token is the Session's current refresh token, it changes every time it is exchanged.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `gorm:"not null;index" json:"-"`
+	Token      string    `gorm:"-" json:"-"`
+	TokenHash  string    `gorm:"not null;unique_index" json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is set when listing sessions to mark the one making the request.
+	Current bool `gorm:"-" json:"current"`
+}
+
+// SessionDB defines all database interactions for a Session.
+type SessionDB interface {
+	GetByToken(ctx context.Context, token string) (*Session, error)
+	GetByRotatedToken(ctx context.Context, token string) (*Session, error)
+	ByUser(ctx context.Context, userID int) ([]*Session, error)
+	Create(ctx context.Context, session *Session) error
+	Touch(ctx context.Context, session *Session) error
+	Rotate(ctx context.Context, oldToken string, session *Session) error
+	Delete(ctx context.Context, id int) error
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+// RotatedToken defines how a refresh token that has already been exchanged is stored in the database.
+// They are kept for the life of their Session so reuse of a stolen token can be detected.
+type RotatedToken struct {
+	ID        int
+	SessionID int    `gorm:"not null;index"`
+	TokenHash string `gorm:"not null;unique_index"`
+	CreatedAt time.Time
+}
+
+// EmailVerification defines how an email verification entity is stored in the database.
+type EmailVerification struct {
+	ID        int
+	UserID    int    `gorm:"not null;index"`
+	Token     string `gorm:"-"`
+	TokenHash string `gorm:"not null;unique_index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// EmailVerificationDB defines all database interactions for an EmailVerification.
+type EmailVerificationDB interface {
+	GetByToken(ctx context.Context, token string) (*EmailVerification, error)
+	LatestByUser(ctx context.Context, userID int) (*EmailVerification, error)
+	Create(ctx context.Context, ev *EmailVerification) error
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+// RecoveryCode defines how a one time recovery code is stored in the database.
+// Recovery codes let a User log in when they lose access to their authenticator app.
+type RecoveryCode struct {
+	ID        int
+	UserID    int    `gorm:"not null;index"`
+	Code      string `gorm:"-"`
+	CodeHash  string `gorm:"not null;unique_index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// RecoveryCodeDB defines all database interactions for a RecoveryCode.
+type RecoveryCodeDB interface {
+	GetByCode(ctx context.Context, userID int, code string) (*RecoveryCode, error)
+	Create(ctx context.Context, rc *RecoveryCode) error
+	Use(ctx context.Context, rc *RecoveryCode) error
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+// Throttle defines how failed attempts against a single account or IP address are stored in the database.
+// Key identifies what is being throttled, i.e. "login:ip:127.0.0.1".
+type Throttle struct {
+	ID            int
+	Key           string `gorm:"not null;unique_index"`
+	Failures      int    `gorm:"not null"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// ThrottleDB defines all database interactions for a Throttle.
+type ThrottleDB interface {
+	Get(ctx context.Context, key string) (*Throttle, error)
+	// Increment adds a failure to the Throttle for key, creating it if needed.
+	// Failures are counted from 1 again if the last was longer ago than window.
+	Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*Throttle, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+// UserRole defines how a role granted to a User is stored in the database.
+type UserRole struct {
+	ID        int
+	UserID    int    `gorm:"not null;unique_index:idx_user_role"`
+	Role      string `gorm:"not null;unique_index:idx_user_role"`
+	CreatedAt time.Time
+}
+
+// RoleDB defines all database interactions for the roles granted to a User.
+type RoleDB interface {
+	ByUser(ctx context.Context, userID int) ([]string, error)
+	Grant(ctx context.Context, userID int, role string) error
+	Revoke(ctx context.Context, userID int, role string) error
 }
 
 // PwReset defines how a reset entity is stored in the database.
@@ -57,10 +218,15 @@ type PwReset struct {
 }
 
 // PwResetDB defines all database interactions for a PwReset.
+// Delete returns ErrNotFound if the PwReset was already deleted, which is how a token is used up.
+// DeleteExpired permanently removes every PwReset created before cutoff, including deleted ones,
+// and returns how many were removed.
 type PwResetDB interface {
-	GetByToken(token string) (*PwReset, error)
-	Create(pwr *PwReset) error
-	Delete(id int) error
+	GetByToken(ctx context.Context, token string) (*PwReset, error)
+	Create(ctx context.Context, pwr *PwReset) error
+	Delete(ctx context.Context, id int) error
+	DeleteByUser(ctx context.Context, userID int) error
+	DeleteExpired(ctx context.Context, cutoff time.Time) (int, error)
 }
 
 // Article defines a single Article as stored in the database.
@@ -76,22 +242,168 @@ type Article struct {
 }
 
 // ArticleService defines the API for interacting with an Article.
+// Methods that alter an Article take the User making the change so the
+// service can check they are allowed to make it.
 type ArticleService interface {
-	ArticleDB
+	GetByID(ctx context.Context, id int) (*Article, error)
+	List(ctx context.Context, query *ArticleQuery) (*ArticleList, error)
+	Create(ctx context.Context, user *User, article *Article) error
+	Update(ctx context.Context, user *User, article *Article) error
+	Delete(ctx context.Context, user *User, id int) error
 }
 
 // ArticleDB defines all database interactions for a single article.
 type ArticleDB interface {
 	// Standard CRUD actions.
 	// Read - Methods for querying an Article.
-	GetByID(id int) (*Article, error)
+	GetByID(ctx context.Context, id int) (*Article, error)
+	List(ctx context.Context, query *ArticleQuery) (*ArticleList, error)
 	// Methods for altering an Article.
-	Create(article *Article) error
-	Update(article *Article) error
-	Delete(id int) error
+	Create(ctx context.Context, article *Article) error
+	Update(ctx context.Context, article *Article) error
+	Delete(ctx context.Context, id int) error
+}
+
+// Fields an ArticleQuery can be sorted by.
+const (
+	SortByID      = "id"
+	SortByCreated = "created_at"
+	SortByUpdated = "updated_at"
+)
+
+// ArticleQuery defines the filters, sort order and page requested when listing Articles.
+// Zero values are ignored, so an empty query lists every Article.
+type ArticleQuery struct {
+	Author        int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	SortBy        string
+	Desc          bool
+	Limit         int
+	// Cursor is an opaque value taken from a previous ArticleList.
+	Cursor string
+}
+
+// ArticleList is a single page of Articles matching an ArticleQuery.
+// Total is the number of Articles matching the filters across all pages.
+type ArticleList struct {
+	Articles   []*Article `json:"articles"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	PrevCursor string     `json:"prev_cursor,omitempty"`
+	Total      int        `json:"total"`
 }
 
 // MailService defines the interface for sending mail to a User.
+// Render renders the named email template with data without sending it,
+// it returns ErrTemplateNotFound if there is no template with that name.
+// Preview and SendPreview let admins see a template rendered with sample data.
 type MailService interface {
-	ResetPw(toEmail, token string) error
+	ResetPw(ctx context.Context, toEmail, token string) error
+	VerifyEmail(ctx context.Context, toEmail, token string) error
+	Render(name string, data interface{}) (*Email, error)
+	// Templates lists the names of the email templates, in order.
+	Templates() []string
+	Preview(name string) (*Email, error)
+	// SendPreview sends the named template, rendered with sample data, to toEmail.
+	SendPreview(ctx context.Context, name, toEmail string) error
+}
+
+// Statuses of an OutboxMessage.
+const (
+	OutboxPending = "pending" // Waiting to be delivered, or to be retried
+	OutboxSent    = "sent"
+	OutboxDead    = "dead" // Failed permanently or too many times, only sent again if retried by an admin
+)
+
+// OutboxMessage defines how an email waiting to be delivered by the mail queue is stored in the database.
+// It is saved in the same transaction as the change that caused it, so the email is only sent if the change is.
+// Text and HTML are cleared once it is sent as they can contain tokens.
+type OutboxMessage struct {
+	ID            int        `json:"id"`
+	From          string     `json:"from"`
+	To            string     `gorm:"not null" json:"to"`
+	Subject       string     `json:"subject"`
+	Text          string     `gorm:"type:text" json:"-"`
+	HTML          string     `gorm:"type:text" json:"-"`
+	Status        string     `gorm:"not null;index:idx_outbox_due" json:"status"`
+	Attempts      int        `gorm:"not null" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index:idx_outbox_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// OutboxDB defines all database interactions for an OutboxMessage.
+type OutboxDB interface {
+	Create(ctx context.Context, msg *OutboxMessage) error
+	GetByID(ctx context.Context, id int) (*OutboxMessage, error)
+	// Claim returns up to limit pending messages due by now, oldest first, counting an attempt for each.
+	// Their NextAttemptAt is moved to now plus lease so no one else claims them while they are delivered.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*OutboxMessage, error)
+	Update(ctx context.Context, msg *OutboxMessage) error
+	// List returns up to limit messages with status, newest first, or with any status if it is empty.
+	List(ctx context.Context, status string, limit int) ([]*OutboxMessage, error)
+}
+
+// MailQueue lets admins see the email waiting to be delivered and retry messages that failed.
+type MailQueue interface {
+	List(ctx context.Context, status string, limit int) ([]*OutboxMessage, error)
+	// Retry queues a pending or dead message to be delivered again straight away, with its attempts reset.
+	// Returns ErrMessageSent if it was already sent.
+	Retry(ctx context.Context, id int) (*OutboxMessage, error)
+}
+
+// Delivery statuses of an email address, each is also the type of the DeliveryEvent that sets it.
+const (
+	DeliveryDelivered    = "delivered"
+	DeliveryBounced      = "bounced" // Permanently failed, the address doesn't exist or won't accept email
+	DeliveryComplained   = "complained"
+	DeliveryUnsubscribed = "unsubscribed"
+)
+
+// DeliveryEvent is a report from the mail provider about an email sent to Recipient.
+type DeliveryEvent struct {
+	Type      string
+	Recipient string
+	Timestamp time.Time
+	// Reason explains a bounce, as given by the receiving server.
+	Reason string
+}
+
+// DeliveryStatus defines how the result of the latest email sent to an address is stored in the database.
+// Suppressed is set when the address hard bounces, no more email is sent to it after that.
+type DeliveryStatus struct {
+	ID          int       `json:"-"`
+	Email       string    `gorm:"not null;unique_index" json:"email"`
+	Status      string    `gorm:"not null" json:"status"`
+	Suppressed  bool      `gorm:"not null" json:"suppressed"`
+	Reason      string    `json:"reason,omitempty"`
+	LastEventAt time.Time `json:"last_event_at"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+}
+
+// DeliveryStatusDB defines all database interactions for a DeliveryStatus.
+type DeliveryStatusDB interface {
+	GetByEmail(ctx context.Context, email string) (*DeliveryStatus, error)
+	// Save creates the DeliveryStatus if its ID is 0, otherwise updates it.
+	Save(ctx context.Context, ds *DeliveryStatus) error
+}
+
+// DeliveryService keeps track of what happened to the email sent to each address.
+type DeliveryService interface {
+	RecordEvent(ctx context.Context, ev *DeliveryEvent) error
+	// Suppressed reports whether email must not be sent to the address.
+	Suppressed(ctx context.Context, email string) (bool, error)
+}
+
+// Email is the content of an email rendered from a template.
+// HTML is empty if the template only has a text version.
+type Email struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
 }
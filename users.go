@@ -1,8 +1,10 @@
 package goafweb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"goafweb/hash"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -10,73 +12,365 @@ import (
 
 type userService struct {
 	UserDB
-	pwResetDB PwResetDB
-	PwPepper  string
+	pwResetDB  PwResetDB
+	verifyDB   EmailVerificationDB
+	sessionDB  SessionDB
+	roleDB     RoleDB
+	recoveryDB RecoveryCodeDB
+	throttleDB ThrottleDB
+	tx         Transactor
+	lockout    LockoutPolicy
+	signer     TokenSigner
+	totpIssuer string
+	totpCipher SecretCipher
+	hasher     PasswordHasher
+	pwResetTTL time.Duration
+	mail       MailService
+	now        func() time.Time
+}
+
+// defaultPWResetTTL is how long a password reset token can be used for unless WithPWResetTTL is used.
+const defaultPWResetTTL = 12 * time.Hour
+
+// WithPWResetTTL sets how long a password reset token can be used for.
+func WithPWResetTTL(ttl time.Duration) UserServiceOpt {
+	return func(us *userService) {
+		if ttl > 0 {
+			us.pwResetTTL = ttl
+		}
+	}
+}
+
+// WithMail sends the emails for signing up, verifying an email address and resetting a password.
+// They are sent inside the transaction that creates the token they contain, so with a MailService
+// that queues to an outbox the email is saved if, and only if, the token is.
+// Without it no emails are sent and callers must send the returned tokens themselves.
+func WithMail(ms MailService) UserServiceOpt {
+	return func(us *userService) {
+		us.mail = ms
+	}
+}
+
+// PasswordHasher defines how passwords are hashed for storage, including any pepper.
+// Hashes record the algorithm, cost and pepper used, so Compare works with hashes made
+// under older settings and NeedsRehash reports when one should be upgraded.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// PasswordPolicy decides whether a new password is strong enough to use.
+// Check returns an error explaining why not, personal are details of the User the password must not contain.
+type PasswordPolicy interface {
+	Check(password string, personal ...string) error
+}
+
+// WithPasswordHasher sets how passwords are hashed, bcrypt at its default cost without a pepper is used otherwise.
+func WithPasswordHasher(hasher PasswordHasher) UserServiceOpt {
+	return func(us *userService) {
+		us.hasher = hasher
+	}
+}
+
+// UserStores groups the storage used by the UserService.
+type UserStores struct {
+	Users         UserDB
+	PwResets      PwResetDB
+	Verifications EmailVerificationDB
+	Sessions      SessionDB
+	Roles         RoleDB
+	RecoveryCodes RecoveryCodeDB
+	Throttles     ThrottleDB
+	// Tx runs the steps of flows that change several records atomically.
+	// If it is nil each step is saved on its own.
+	Tx Transactor
 }
 
 // NewUserService returns a userService that implements the UserService interface.
-func NewUserService(userDB UserDB, pwrDB PwResetDB, pwPepper string) *userService {
-	return &userService{
-		UserDB:    userDB,
-		pwResetDB: pwrDB,
-		PwPepper:  pwPepper,
+// The signer is used to sign the access tokens issued when a User logs in.
+// Optional features are enabled with opts.
+func NewUserService(stores UserStores, signer TokenSigner, opts ...UserServiceOpt) *userService {
+	us := &userService{
+		UserDB:     stores.Users,
+		pwResetDB:  stores.PwResets,
+		verifyDB:   stores.Verifications,
+		sessionDB:  stores.Sessions,
+		roleDB:     stores.Roles,
+		recoveryDB: stores.RecoveryCodes,
+		throttleDB: stores.Throttles,
+		tx:         stores.Tx,
+		signer:     signer,
+		hasher:     hash.NewBcryptHasher(bcrypt.DefaultCost),
+		pwResetTTL: defaultPWResetTTL,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(us)
+	}
+	return us
+}
+
+// inTx runs fn as a single transaction if the service has a Transactor.
+func (us *userService) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if us.tx == nil {
+		return fn(ctx)
+	}
+	return us.tx.InTx(ctx, fn)
+}
+
+// SignUp creates a new User along with the token they need to verify their email address, and emails it to them.
+// Everything is saved together, so there is never an account without a way to verify it.
+func (us *userService) SignUp(ctx context.Context, user *User) (string, error) {
+	var token string
+	err := us.inTx(ctx, func(ctx context.Context) error {
+		if err := us.Create(ctx, user); err != nil {
+			return err
+		}
+		var err error
+		token, err = us.newVerification(ctx, user)
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
+	return token, nil
 }
 
 // Authenticate will match a users email/password to an exisiting database record and call Login() if details are correct.
 // Will return a blanket error if email or password are incorrect.
-func (us *userService) Authenticate(email, password string) (*User, error) {
-	user, err := us.GetByEmail(email)
+// Failed attempts are counted against both the account and the IP address they came from. Each failure
+// delays the next attempt for longer, and too many lock the account, returning a RetryError until it unlocks.
+func (us *userService) Authenticate(ctx context.Context, email, password, ip string) (*User, error) {
+	accountKey, ipKey := loginAccountKey(email), loginIPKey(ip)
+	if err := us.checkThrottle(ctx, accountKey, ipKey); err != nil {
+		return nil, err
+	}
+	user, err := us.authenticate(ctx, email, password)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrPWInvalid) {
+			if err := us.recordFailure(ctx, accountKey, us.lockout.MaxFailures); err != nil {
+				return nil, err
+			}
+			if err := us.recordFailure(ctx, ipKey, us.lockout.IPMaxFailures); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	if err := us.clearThrottle(ctx, accountKey); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// authenticate checks the email/password without any throttling.
+// If the password was hashed with outdated settings or a retired pepper it is rehashed with the current ones while it is available.
+func (us *userService) authenticate(ctx context.Context, email, password string) (*User, error) {
+	user, err := us.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, fmt.Errorf("Could not retreive user: %w", err)
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password+us.PwPepper))
+	ok, err := us.hasher.Compare(user.PasswordHash, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return nil, ErrPWInvalid
-		}
 		return nil, fmt.Errorf("Could not authenticate: %v", err)
 	}
+	if !ok {
+		return nil, ErrPWInvalid
+	}
+	if us.hasher.NeedsRehash(user.PasswordHash) {
+		// The User has authenticated either way, a failed rehash is tried again next time.
+		if pwhash, err := us.hasher.Hash(password); err == nil {
+			oldHash := user.PasswordHash
+			user.PasswordHash = pwhash
+			if err := us.Update(ctx, user); err != nil {
+				user.PasswordHash = oldHash
+			}
+		}
+	}
 	return user, nil
 }
 
 // InitiatePWReset will begin the process for an automated password reset.
-// If email address provided is not in db provides an error.
-// Otherwise creates a pwResetToken, stores in DB and emails it to the email address provided.
-func (us *userService) InitiatePWReset(email string) (string, error) {
-	user, err := us.GetByEmail(email)
+// Creates a pwResetToken for the User with the email address and stores its hash, the token is emailed to them and returned.
+// Any token issued before is invalidated, so only the latest email works.
+// If no User has the email address an empty token and no error is returned, so callers can
+// respond the same either way and not reveal which addresses have accounts.
+// Requests are throttled per account and per IP address.
+func (us *userService) InitiatePWReset(ctx context.Context, email, ip string) (string, error) {
+	accountKey, ipKey := resetAccountKey(email), resetIPKey(ip)
+	if err := us.checkThrottle(ctx, accountKey, ipKey); err != nil {
+		return "", err
+	}
+	if err := us.recordFailure(ctx, accountKey, us.lockout.MaxResetRequests); err != nil {
+		return "", err
+	}
+	if err := us.recordFailure(ctx, ipKey, us.lockout.MaxResetRequests); err != nil {
+		return "", err
+	}
+	user, err := us.GetByEmail(ctx, email)
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", nil
+		}
 		return "", fmt.Errorf("Could not retreive user: %w", err)
 	}
 
 	pwr := PwReset{
 		UserID: user.ID,
 	}
-	if err := us.pwResetDB.Create(&pwr); err != nil {
-		return "", fmt.Errorf("Unable to create reset token: %w", err)
+	err = us.inTx(ctx, func(ctx context.Context) error {
+		if err := us.pwResetDB.DeleteByUser(ctx, user.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("Unable to invalidate old reset tokens: %w", err)
+		}
+		if err := us.pwResetDB.Create(ctx, &pwr); err != nil {
+			return fmt.Errorf("Unable to create reset token: %w", err)
+		}
+		if us.mail != nil {
+			if err := us.mail.ResetPw(ctx, user.Email, pwr.Token); err != nil {
+				return fmt.Errorf("Could not send password reset email: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 	return pwr.Token, nil
 }
 
 // CompletePWReset validates the token provided by the user and update the database User with a new user provided password.
-// Tokens valid for 12 hours.
-func (us *userService) CompletePWReset(token, newPw string) (*User, error) {
-	pwr, err := us.pwResetDB.GetByToken(token)
+// Tokens are valid for the TTL set by WithPWResetTTL.
+// The new password is only saved if the token is used up with it, and every Session of the User
+// is revoked with it so anyone who knew the old password is logged out.
+// Resetting the password also unlocks the account if too many failed logins locked it.
+func (us *userService) CompletePWReset(ctx context.Context, token, newPw string) (*User, error) {
+	var user *User
+	err := us.inTx(ctx, func(ctx context.Context) error {
+		pwr, err := us.pwResetDB.GetByToken(ctx, token)
+		if err != nil {
+			return fmt.Errorf("Unble to retreive reset data: %w", err)
+		}
+		if us.now().Sub(pwr.CreatedAt) > us.pwResetTTL {
+			return ErrTokenExpired
+		}
+		// Only one request can delete the token, any other using it at the same time is rolled back.
+		if err := us.pwResetDB.Delete(ctx, pwr.ID); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrTokenInvalid
+			}
+			return fmt.Errorf("Unable to remove reset token: %w", err)
+		}
+		if user, err = us.GetByID(ctx, pwr.UserID); err != nil {
+			return fmt.Errorf("Unable to reset password: %w", err)
+		}
+		user.Password = newPw
+		if err := us.Update(ctx, user); err != nil {
+			return fmt.Errorf("Unable to reset password: %w", err)
+		}
+		if err := us.pwResetDB.DeleteByUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("Unable to remove reset tokens: %w", err)
+		}
+		if err := us.sessionDB.DeleteByUser(ctx, user.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("Unable to revoke sessions: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Unble to retreive reset data: %w", err)
+		return nil, err
 	}
+	if err := us.clearThrottle(ctx, loginAccountKey(user.Email)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
 
-	if time.Now().Sub(pwr.CreatedAt) > (12 * time.Hour) {
-		return nil, errors.New("Token no longer valid")
+// PurgePWResets permanently removes every password reset token that has expired, or was created
+// long enough ago that it would have, and returns how many were removed.
+// Used tokens are only hidden until then, it should be run regularly to keep the table small.
+func (us *userService) PurgePWResets(ctx context.Context) (int, error) {
+	n, err := us.pwResetDB.DeleteExpired(ctx, us.now().Add(-us.pwResetTTL))
+	if err != nil {
+		return 0, fmt.Errorf("Unable to purge reset tokens: %w", err)
 	}
-	user, err := us.GetByID(pwr.UserID)
+	return n, nil
+}
+
+// ChangePassword sets a new password for a logged in User once they confirm their current one.
+// Wrong passwords count as failed logins, so a stolen session can't be used to guess it.
+// Every other Session of the User is revoked with it, the same as a reset, so anyone who knew the
+// old password is logged out. sessionID is the Session making the change, which is kept, or 0 if
+// the request wasn't made with one.
+// Returns ErrPWInvalid if the current password is wrong.
+func (us *userService) ChangePassword(ctx context.Context, userID, sessionID int, currentPW, newPW string) error {
+	user, err := us.GetByID(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to reset password: %w", err)
+		return fmt.Errorf("Could not retreive user: %w", err)
 	}
-	user.Password = newPw
-	if err = us.Update(user); err != nil {
-		return nil, fmt.Errorf("Unable to reset password: %w", err)
+	accountKey := loginAccountKey(user.Email)
+	if err := us.checkThrottle(ctx, accountKey); err != nil {
+		return err
 	}
-	us.pwResetDB.Delete(pwr.ID)
-	return user, nil
+	ok, err := us.hasher.Compare(user.PasswordHash, currentPW)
+	if err != nil {
+		return fmt.Errorf("Could not authenticate: %v", err)
+	}
+	if !ok {
+		if err := us.recordFailure(ctx, accountKey, us.lockout.MaxFailures); err != nil {
+			return err
+		}
+		return ErrPWInvalid
+	}
+	return us.inTx(ctx, func(ctx context.Context) error {
+		user.Password = newPW
+		if err := us.Update(ctx, user); err != nil {
+			return fmt.Errorf("Unable to change password: %w", err)
+		}
+		sessions, err := us.sessionDB.ByUser(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("Unable to revoke sessions: %w", err)
+		}
+		for _, session := range sessions {
+			if session.ID == sessionID {
+				continue
+			}
+			if err := us.sessionDB.Delete(ctx, session.ID); err != nil {
+				return fmt.Errorf("Unable to revoke sessions: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GrantRole gives the User the role, and with it all of the roles permissions.
+func (us *userService) GrantRole(ctx context.Context, userID int, role string) error {
+	if _, err := us.GetByID(ctx, userID); err != nil {
+		return fmt.Errorf("Could not retreive user: %w", err)
+	}
+	if err := us.roleDB.Grant(ctx, userID, role); err != nil {
+		return fmt.Errorf("Could not grant role: %w", err)
+	}
+	return nil
+}
+
+// RevokeRole removes the role from the User.
+func (us *userService) RevokeRole(ctx context.Context, userID int, role string) error {
+	if err := us.roleDB.Revoke(ctx, userID, role); err != nil {
+		return fmt.Errorf("Could not revoke role: %w", err)
+	}
+	return nil
+}
+
+// Roles returns the roles granted to the User.
+func (us *userService) Roles(ctx context.Context, userID int) ([]string, error) {
+	return us.roleDB.ByUser(ctx, userID)
+}
+
+// Permissions returns every permission the User holds through their roles.
+func (us *userService) Permissions(ctx context.Context, userID int) (Permissions, error) {
+	roles, err := us.roleDB.ByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retreive roles: %w", err)
+	}
+	return PermissionsFor(roles), nil
 }
@@ -1,78 +1,119 @@
-package goafweb
+package goafweb_test
 
 import (
+	"context"
 	"errors"
+	"goafweb"
+	"goafweb/hash"
+	"goafweb/storage/memory"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-type mockDB struct {
-	users []*User
-}
+// testPepper is the pepper passwords were hashed with before peppers had key IDs.
+const testPepper = "pwPepper"
 
-func (m *mockDB) GetByID(id int) (*User, error) {
-	for _, user := range m.users {
-		if user.ID == id {
-			return user, nil
-		}
-	}
-	return nil, ErrNotFound
-}
-func (m *mockDB) GetByEmail(email string) (*User, error) {
-	for _, user := range m.users {
-		if user.Email == email {
-			return user, nil
-		}
-	}
-	return nil, ErrNotFound
-}
-func (m *mockDB) GetByRemember(token string) (*User, error) {
-	for _, user := range m.users {
-		if user.RememberToken == token {
-			return user, nil
-		}
-	}
-	return nil, ErrNotFound
+// legacyHasher hashes passwords the way they were hashed before peppers could be rotated.
+func legacyHasher() goafweb.PasswordHasher {
+	peppers, _ := hash.NewKeyring(hash.LegacyKeyID, map[string]string{hash.LegacyKeyID: testPepper})
+	return hash.NewPepperedHasher(hash.NewBcryptHasher(bcrypt.MinCost), peppers)
 }
 
-func (m *mockDB) Create(user *User) error {
-	m.users = append(m.users, user)
-	return nil
-}
-func (*mockDB) Update(user *User) error {
-	return nil
+// createLegacyUser stores a User whose password was hashed with bcrypt and testPepper, before peppers had key IDs.
+func (us *testUserService) createLegacyUser(t *testing.T, email, password string) {
+	t.Helper()
+	ctx := context.Background()
+	pwhash, _ := bcrypt.GenerateFromPassword([]byte(password+testPepper), bcrypt.MinCost)
+	if err := memory.NewUserDB(us.db).Create(ctx, &goafweb.User{Name: "test", Email: email, PasswordHash: string(pwhash)}); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
 }
 
 func TestAuthenticate(t *testing.T) {
-	mockDB := &mockDB{}
-	us := NewUserService(mockDB, nil, "pwPepper")
-
-	testUser := &User{Email: "test@test.com", Password: "test"}
-	pwhash, _ := bcrypt.GenerateFromPassword([]byte(testUser.Password+us.PwPepper), bcrypt.DefaultCost)
-	testUser.PasswordHash = string(pwhash)
-	mockDB.Create(testUser)
+	ctx := context.Background()
+	us := newTestUserService(t, goafweb.WithPasswordHasher(legacyHasher()))
+	us.createLegacyUser(t, "test@test.com", "test")
 
 	tests := map[string]struct {
-		want error
-		user *User
+		want     error
+		email    string
+		password string
 	}{
-		"Authentication OK": {want: nil, user: &User{Email: "test@test.com", Password: "test"}},
-		"Invalid email":     {want: ErrNotFound, user: &User{Email: "test@test.cm", Password: "test"}},
-		"Invalid pass":      {want: ErrPWInvalid, user: &User{Email: "test@test.com", Password: "test1"}},
-	}
-	for i, tc := range tests {
-		pwhash, _ := bcrypt.GenerateFromPassword([]byte(tc.user.Password+us.PwPepper), bcrypt.DefaultCost)
-		tc.user.PasswordHash = string(pwhash)
-		tests[i] = tc
+		"Authentication OK": {want: nil, email: "test@test.com", password: "test"},
+		"Invalid email":     {want: goafweb.ErrNotFound, email: "test@test.cm", password: "test"},
+		"Invalid pass":      {want: goafweb.ErrPWInvalid, email: "test@test.com", password: "test1"},
 	}
-
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			_, err := us.Authenticate(tc.user.Email, tc.user.Password)
+			_, err := us.Authenticate(ctx, tc.email, tc.password, "127.0.0.1")
 			if !errors.Is(err, tc.want) {
 				t.Errorf("Got %v, wanted %v", err, tc.want)
 			}
 		})
 	}
 }
+
+func TestAuthenticateRehash(t *testing.T) {
+	ctx := context.Background()
+	peppers, _ := hash.NewKeyring("2", map[string]string{hash.LegacyKeyID: testPepper, "2": "newPepper"})
+	argon := hash.NewArgon2idHasher(hash.Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hasher := hash.NewPepperedHasher(argon, peppers)
+	us := newTestUserService(t, goafweb.WithPasswordHasher(hasher))
+	// Hashed before the switch to Argon2id and the new pepper.
+	us.createLegacyUser(t, "test@test.com", "test")
+
+	user, err := us.Authenticate(ctx, "test@test.com", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Got %v, wanted nil", err)
+	}
+	if hasher.NeedsRehash(user.PasswordHash) || !strings.HasPrefix(user.PasswordHash, "2:$argon2id$") {
+		t.Fatalf("Password was not rehashed, got %s", user.PasswordHash)
+	}
+	if stored, err := us.GetByID(ctx, user.ID); err != nil || stored.PasswordHash != user.PasswordHash {
+		t.Fatalf("The new hash was not saved: %+v, %v", stored, err)
+	}
+	// The new hash must still authenticate.
+	if _, err := us.Authenticate(ctx, "test@test.com", "test", "127.0.0.1"); err != nil {
+		t.Errorf("Got %v after rehash, wanted nil", err)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user := us.createUser(t, "test@test.com")
+	other := us.createUser(t, "other@test.com")
+	var sessions []*goafweb.Session
+	for _, u := range []*goafweb.User{user, user, other} {
+		session, err := us.CreateSession(ctx, u, "agent", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	current := sessions[0]
+	if err := us.ChangePassword(ctx, user.ID, current.ID, "wrong", "new-password"); !errors.Is(err, goafweb.ErrPWInvalid) {
+		t.Fatalf("ChangePassword with the wrong password: got %v, wanted %v", err, goafweb.ErrPWInvalid)
+	}
+	if got, err := us.Sessions(ctx, user.ID); err != nil || len(got) != 2 {
+		t.Fatalf("Sessions after a failed change: got %d, %v, wanted 2", len(got), err)
+	}
+	if err := us.ChangePassword(ctx, user.ID, current.ID, "password", "new-password"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+
+	if _, _, err := us.UserBySession(ctx, current.Token); err != nil {
+		t.Errorf("Session making the change: got %v, wanted it kept", err)
+	}
+	if _, _, err := us.UserBySession(ctx, sessions[1].Token); err == nil {
+		t.Errorf("Other session of the user: got nil, wanted it revoked")
+	}
+	if _, _, err := us.UserBySession(ctx, sessions[2].Token); err != nil {
+		t.Errorf("Session of another user: got %v, wanted it kept", err)
+	}
+	if _, err := us.Authenticate(ctx, user.Email, "new-password", "127.0.0.1"); err != nil {
+		t.Errorf("Authenticate with the new password: %v", err)
+	}
+}
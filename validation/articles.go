@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"goafweb"
@@ -23,81 +24,124 @@ func NewArticleValidator(articleDB goafweb.ArticleDB) *articleValidator {
 	}
 }
 
-func (av *articleValidator) GetByID(id int) (*goafweb.Article, error) {
+func (av *articleValidator) GetByID(ctx context.Context, id int) (*goafweb.Article, error) {
 	article := &goafweb.Article{ID: id}
-	if err := runArticleValFuncs(article, av.idGreaterThan0); err != nil {
-		return nil, fmt.Errorf("Validation Error: %w", err)
+	if err := runValFuncs(field("id", av.idGreaterThan0(article))); err != nil {
+		return nil, goafweb.Invalid(err)
 	}
-	return av.ArticleDB.GetByID(article.ID)
+	return av.ArticleDB.GetByID(ctx, article.ID)
 }
 
-func (av *articleValidator) Create(article *goafweb.Article) error {
-	if err := runArticleValFuncs(article,
-		av.titleRequired,
-		av.contentRequired,
-		av.authorRequired,
+// Page sizes used when listing Articles.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// List validates the query before it is run, setting a default sort field and
+// clamping the page size between 1 and maxPageSize.
+func (av *articleValidator) List(ctx context.Context, query *goafweb.ArticleQuery) (*goafweb.ArticleList, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit > maxPageSize {
+		query.Limit = maxPageSize
+	}
+	errs := fieldErrors{}
+	switch query.SortBy {
+	case "":
+		query.SortBy = goafweb.SortByCreated
+	case goafweb.SortByID, goafweb.SortByCreated, goafweb.SortByUpdated:
+	default:
+		errs["sort"] = fmt.Sprintf("cannot sort by %q", query.SortBy)
+	}
+	if query.Author < 0 {
+		errs["author"] = "Invalid author"
+	}
+	if !query.CreatedAfter.IsZero() && !query.CreatedBefore.IsZero() && !query.CreatedAfter.Before(query.CreatedBefore) {
+		errs["created_after"] = "created_after must be before created_before"
+	}
+	if !query.UpdatedAfter.IsZero() && !query.UpdatedBefore.IsZero() && !query.UpdatedAfter.Before(query.UpdatedBefore) {
+		errs["updated_after"] = "updated_after must be before updated_before"
+	}
+	if query.Cursor != "" {
+		cursor, err := goafweb.DecodeCursor(query.Cursor)
+		if err != nil {
+			return nil, goafweb.Invalid(err)
+		}
+		if !cursor.Matches(query) {
+			errs["cursor"] = "cursor is for a different sort or order, start again from the first page"
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	return av.ArticleDB.List(ctx, query)
+}
+
+func (av *articleValidator) Create(ctx context.Context, article *goafweb.Article) error {
+	if err := runValFuncs(
+		field("title", av.titleRequired(article)),
+		field("content", av.contentRequired(article)),
+		field("author", av.authorRequired(article)),
 	); err != nil {
-		return fmt.Errorf("Validation Error: %w", err)
+		return goafweb.Invalid(err)
 	}
-	return av.ArticleDB.Create(article)
+	return av.ArticleDB.Create(ctx, article)
 }
-func (av *articleValidator) Update(article *goafweb.Article) error {
-	if err := runArticleValFuncs(article, av.idGreaterThan0, av.authorRequired, av.titleRequired); err != nil {
-		return fmt.Errorf("Validation Error: %w", err)
+func (av *articleValidator) Update(ctx context.Context, article *goafweb.Article) error {
+	if err := runValFuncs(
+		field("id", av.idGreaterThan0(article)),
+		field("author", av.authorRequired(article)),
+		field("title", av.titleRequired(article)),
+	); err != nil {
+		return goafweb.Invalid(err)
 	}
-	return av.ArticleDB.Update(article)
+	return av.ArticleDB.Update(ctx, article)
 }
 
-func (av *articleValidator) Delete(id int) error {
+func (av *articleValidator) Delete(ctx context.Context, id int) error {
 	article := goafweb.Article{ID: id}
-	if err := runArticleValFuncs(&article, av.idGreaterThan0); err != nil {
-		return fmt.Errorf("Validation Error: %w", err)
+	if err := runValFuncs(field("id", av.idGreaterThan0(&article))); err != nil {
+		return goafweb.Invalid(err)
 	}
-	return av.ArticleDB.Delete(article.ID)
+	return av.ArticleDB.Delete(ctx, article.ID)
 }
 
-// articleValFunc is a uniform type for all validation functions on an Article.
-// All validation functions will be of this type so they can be used as variadic
-// arguments in other functions.
-// These funtions will return a customized error message if the validation fails,
-// or nil if everything is okay.
-type articleValFunc func(article *goafweb.Article) error
-
-func runArticleValFuncs(article *goafweb.Article, fns ...articleValFunc) error {
-	for _, fn := range fns {
-		if err := fn(article); err != nil {
-			return err
+func (av *articleValidator) titleRequired(article *goafweb.Article) valFunc {
+	return func() error {
+		article.Title = strings.TrimSpace(article.Title)
+		if article.Title == "" {
+			return errors.New("Title is required")
 		}
+		return nil
 	}
-	return nil
 }
 
-func (av *articleValidator) titleRequired(article *goafweb.Article) error {
-	article.Title = strings.TrimSpace(article.Title)
-	if article.Title == "" {
-		return errors.New("Title is required")
-	}
-	return nil
-}
-
-func (av *articleValidator) contentRequired(article *goafweb.Article) error {
-	article.Content = strings.TrimSpace(article.Content)
-	if article.Content == "" {
-		return errors.New("Content is required")
+func (av *articleValidator) contentRequired(article *goafweb.Article) valFunc {
+	return func() error {
+		article.Content = strings.TrimSpace(article.Content)
+		if article.Content == "" {
+			return errors.New("Content is required")
+		}
+		return nil
 	}
-	return nil
 }
 
-func (av *articleValidator) idGreaterThan0(article *goafweb.Article) error {
-	if article.ID <= 0 {
-		return errors.New("ID cannot be zero")
+func (av *articleValidator) idGreaterThan0(article *goafweb.Article) valFunc {
+	return func() error {
+		if article.ID <= 0 {
+			return errors.New("ID cannot be zero")
+		}
+		return nil
 	}
-	return nil
 }
 
-func (av *articleValidator) authorRequired(article *goafweb.Article) error {
-	if article.Author <= 0 {
-		return errors.New("Author not set")
+func (av *articleValidator) authorRequired(article *goafweb.Article) valFunc {
+	return func() error {
+		if article.Author <= 0 {
+			return errors.New("Author not set")
+		}
+		return nil
 	}
-	return nil
 }
@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/storage/memory"
+	"reflect"
+	"testing"
+)
+
+func TestArticleListCursor(t *testing.T) {
+	ctx := context.Background()
+	av := NewArticleValidator(memory.NewArticleDB(memory.NewDB()))
+	for i := 0; i < 3; i++ {
+		if err := av.Create(ctx, &goafweb.Article{Title: "Title", Content: "Content", Author: 1}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	list, err := av.List(ctx, &goafweb.ArticleQuery{Limit: 1})
+	if err != nil || list.NextCursor == "" {
+		t.Fatalf("List: got %+v, %v, wanted a next page", list, err)
+	}
+	if _, err := av.List(ctx, &goafweb.ArticleQuery{Limit: 1, Cursor: list.NextCursor}); err != nil {
+		t.Errorf("List with the default sort: %v", err)
+	}
+
+	_, err = av.List(ctx, &goafweb.ArticleQuery{SortBy: goafweb.SortByID, Limit: 1, Cursor: list.NextCursor})
+	want := goafweb.ValidationErrors{"cursor": "cursor is for a different sort or order, start again from the first page"}
+	var got goafweb.ValidationErrors
+	if !errors.Is(err, goafweb.ErrInvalid) || !errors.As(err, &got) || !reflect.DeepEqual(got, want) {
+		t.Errorf("Cursor from another sort: got %v, wanted %v", err, want)
+	}
+	if _, err := av.List(ctx, &goafweb.ArticleQuery{Limit: 1, Cursor: "not a cursor"}); !errors.Is(err, goafweb.ErrCursorInvalid) {
+		t.Errorf("Malformed cursor: got %v, wanted %v", err, goafweb.ErrCursorInvalid)
+	}
+}
@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"strings"
+)
+
+// deliveryStatusValidator will be responsible for validation/normalizing a DeliveryStatus ready for
+// database storage/retreival.
+type deliveryStatusValidator struct {
+	goafweb.DeliveryStatusDB
+}
+
+// NewDeliveryStatusValidator creates a new deliveryStatusValidator.
+// It must receive something that satisfies the DeliveryStatusDB interface to satisfy
+// the next layer of the interface.
+func NewDeliveryStatusValidator(statusDB goafweb.DeliveryStatusDB) *deliveryStatusValidator {
+	return &deliveryStatusValidator{
+		DeliveryStatusDB: statusDB,
+	}
+}
+
+func (dsv *deliveryStatusValidator) GetByEmail(ctx context.Context, email string) (*goafweb.DeliveryStatus, error) {
+	ds := &goafweb.DeliveryStatus{Email: email}
+	if err := runValFuncs(field("email", dsv.emailNormalize(ds), dsv.emailRequired(ds))); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	return dsv.DeliveryStatusDB.GetByEmail(ctx, ds.Email)
+}
+
+func (dsv *deliveryStatusValidator) Save(ctx context.Context, ds *goafweb.DeliveryStatus) error {
+	err := runValFuncs(
+		field("email", dsv.emailNormalize(ds), dsv.emailRequired(ds)),
+		field("status", dsv.statusValid(ds)))
+	if err != nil {
+		return goafweb.Invalid(err)
+	}
+	return dsv.DeliveryStatusDB.Save(ctx, ds)
+}
+
+// emailNormalize matches the normalizing of User emails, so statuses are found for the address a User has.
+func (dsv *deliveryStatusValidator) emailNormalize(ds *goafweb.DeliveryStatus) valFunc {
+	return func() error {
+		ds.Email = strings.ToLower(strings.TrimSpace(ds.Email))
+		return nil
+	}
+}
+
+func (dsv *deliveryStatusValidator) emailRequired(ds *goafweb.DeliveryStatus) valFunc {
+	return func() error {
+		if ds.Email == "" {
+			return errors.New("Email address is required")
+		}
+		return nil
+	}
+}
+
+func (dsv *deliveryStatusValidator) statusValid(ds *goafweb.DeliveryStatus) valFunc {
+	return func() error {
+		switch ds.Status {
+		case goafweb.DeliveryDelivered, goafweb.DeliveryBounced, goafweb.DeliveryComplained, goafweb.DeliveryUnsubscribed:
+			return nil
+		}
+		return errors.New("Status must be delivered, bounced, complained or unsubscribed")
+	}
+}
@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"errors"
+	"goafweb"
+)
+
+// valFunc is a validation rule, made by a validator for the value it checks.
+// It returns an error with a message for the user if the rule fails, or nil if everything is okay.
+type valFunc func() error
+
+// runValFuncs runs every fn and returns all of the failures as goafweb.ValidationErrors.
+// Validation stops early only if a fn returns an error that isn't for a field, i.e. a database error.
+func runValFuncs(fns ...valFunc) error {
+	errs := fieldErrors{}
+	for _, fn := range fns {
+		if err := errs.add(fn()); err != nil {
+			return err
+		}
+	}
+	return errs.err()
+}
+
+// field combines the rules for a single field. They run in order until one fails, so later rules
+// can rely on earlier ones, e.g. an email address is only checked for taken once its format is valid.
+// So a field gets at most one message, a rule that can fail for several reasons at once, like the
+// password policy, lists them all in its message.
+func field(name string, fns ...valFunc) valFunc {
+	return func() error {
+		for _, fn := range fns {
+			if err := fn(); err != nil {
+				return invalidField(name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// fieldError is a validation failure of a single field.
+// field returns one so runValFuncs knows which field failed.
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+// invalidField marks err as a failure of field.
+// An err that is already a goafweb.Error, i.e. a database error, isn't the fault of the field
+// so is returned unchanged and stops validation.
+func invalidField(field string, err error) error {
+	var e *goafweb.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &fieldError{field: field, err: err}
+}
+
+// fieldErrors collects the failures found by runValFuncs, keyed by field.
+type fieldErrors goafweb.ValidationErrors
+
+// add records err if it is a fieldError.
+// Any other error is returned, validation should stop as the remaining fields can't be checked.
+func (fe fieldErrors) add(err error) error {
+	var ferr *fieldError
+	if !errors.As(err, &ferr) {
+		return err
+	}
+	if _, ok := fe[ferr.field]; !ok {
+		fe[ferr.field] = ferr.err.Error()
+	}
+	return nil
+}
+
+// err returns the failures as goafweb.ValidationErrors, or nil if there weren't any.
+func (fe fieldErrors) err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return goafweb.ValidationErrors(fe)
+}
+
+// invalid returns a validation error for a single field, for checks made without runValFuncs.
+func invalid(field, msg string) error {
+	return goafweb.Invalid(goafweb.ValidationErrors{field: msg})
+}
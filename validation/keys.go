@@ -0,0 +1,19 @@
+package validation
+
+import (
+	"errors"
+	"goafweb"
+	"goafweb/hash"
+)
+
+// lookupHashes calls lookup with the hash of input made by each key in turn, so values hashed
+// before a key was rotated are still found. It stops at the first result that isn't goafweb.ErrNotFound.
+func lookupHashes(h hash.HMAC, input string, lookup func(hash string) error) error {
+	err := goafweb.ErrNotFound
+	for _, hashed := range h.Hashes(input) {
+		if err = lookup(hashed); !errors.Is(err, goafweb.ErrNotFound) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"net/mail"
+	"time"
+)
+
+// outboxValidator will be responsible for validation/normalizing an OutboxMessage ready for
+// database storage/retreival.
+type outboxValidator struct {
+	goafweb.OutboxDB
+}
+
+// NewOutboxValidator creates a new outboxValidator.
+// It must receive something that satisfies the OutboxDB interface to satisfy
+// the next layer of the interface.
+func NewOutboxValidator(outboxDB goafweb.OutboxDB) *outboxValidator {
+	return &outboxValidator{
+		OutboxDB: outboxDB,
+	}
+}
+
+func (ov *outboxValidator) Create(ctx context.Context, msg *goafweb.OutboxMessage) error {
+	err := runValFuncs(
+		field("from", ov.addressValid(msg.From)),
+		field("to", ov.addressValid(msg.To)),
+		field("subject", ov.subjectRequired(msg)),
+		field("status", ov.defaultStatus(msg), ov.statusValid(msg)),
+		field("next_attempt_at", ov.defaultNextAttempt(msg)))
+	if err != nil {
+		return goafweb.Invalid(err)
+	}
+	return ov.OutboxDB.Create(ctx, msg)
+}
+
+func (ov *outboxValidator) GetByID(ctx context.Context, id int) (*goafweb.OutboxMessage, error) {
+	if id <= 0 {
+		return nil, invalid("id", "Invalid ID")
+	}
+	return ov.OutboxDB.GetByID(ctx, id)
+}
+
+func (ov *outboxValidator) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*goafweb.OutboxMessage, error) {
+	errs := fieldErrors{}
+	if lease <= 0 {
+		errs["lease"] = "Lease must be positive"
+	}
+	if limit <= 0 {
+		errs["limit"] = "Limit must be positive"
+	}
+	if err := errs.err(); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	return ov.OutboxDB.Claim(ctx, now, lease, limit)
+}
+
+func (ov *outboxValidator) Update(ctx context.Context, msg *goafweb.OutboxMessage) error {
+	err := runValFuncs(
+		field("id", ov.idRequired(msg)),
+		field("status", ov.statusValid(msg)))
+	if err != nil {
+		return goafweb.Invalid(err)
+	}
+	return ov.OutboxDB.Update(ctx, msg)
+}
+
+func (ov *outboxValidator) List(ctx context.Context, status string, limit int) ([]*goafweb.OutboxMessage, error) {
+	errs := fieldErrors{}
+	if status != "" && !outboxStatuses[status] {
+		errs["status"] = "Status must be pending, sent or dead"
+	}
+	if limit <= 0 {
+		errs["limit"] = "Limit must be positive"
+	}
+	if err := errs.err(); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	return ov.OutboxDB.List(ctx, status, limit)
+}
+
+// outboxStatuses holds every valid status of an OutboxMessage.
+var outboxStatuses = map[string]bool{
+	goafweb.OutboxPending: true,
+	goafweb.OutboxSent:    true,
+	goafweb.OutboxDead:    true,
+}
+
+func (ov *outboxValidator) idRequired(msg *goafweb.OutboxMessage) valFunc {
+	return func() error {
+		if msg.ID <= 0 {
+			return errors.New("ID Invalid")
+		}
+		return nil
+	}
+}
+
+// addressValid checks addr is a valid email address, with or without a name.
+func (ov *outboxValidator) addressValid(addr string) valFunc {
+	return func() error {
+		if addr == "" {
+			return errors.New("Email address is required")
+		}
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return errors.New("Email address is not valid")
+		}
+		return nil
+	}
+}
+
+func (ov *outboxValidator) subjectRequired(msg *goafweb.OutboxMessage) valFunc {
+	return func() error {
+		if msg.Subject == "" {
+			return errors.New("Subject is required")
+		}
+		return nil
+	}
+}
+
+func (ov *outboxValidator) defaultStatus(msg *goafweb.OutboxMessage) valFunc {
+	return func() error {
+		if msg.Status == "" {
+			msg.Status = goafweb.OutboxPending
+		}
+		return nil
+	}
+}
+
+func (ov *outboxValidator) statusValid(msg *goafweb.OutboxMessage) valFunc {
+	return func() error {
+		if !outboxStatuses[msg.Status] {
+			return errors.New("Status must be pending, sent or dead")
+		}
+		return nil
+	}
+}
+
+// defaultNextAttempt makes a new message due straight away unless it was given a time.
+func (ov *outboxValidator) defaultNextAttempt(msg *goafweb.OutboxMessage) valFunc {
+	return func() error {
+		if msg.NextAttemptAt.IsZero() {
+			msg.NextAttemptAt = time.Now()
+		}
+		return nil
+	}
+}
@@ -1,11 +1,13 @@
 package validation
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"goafweb"
 	"goafweb/hash"
 	"goafweb/rand"
+	"time"
 )
 
 // pwResetValidator will be responsible for validation/normalizing a pwReset ready for
@@ -26,63 +28,72 @@ func NewPwResetValidator(pwrDB goafweb.PwResetDB, hmac hash.HMAC) *pwResetValida
 	}
 }
 
-func (pwrv *pwResetValidator) GetByToken(token string) (*goafweb.PwReset, error) {
+func (pwrv *pwResetValidator) GetByToken(ctx context.Context, token string) (*goafweb.PwReset, error) {
 	pwr := &goafweb.PwReset{Token: token}
-	if err := runPWResetValFuncs(pwr, pwrv.tokenHashRequired); err != nil {
-		return nil, fmt.Errorf("Validation Error: %w", err)
+	if err := runValFuncs(field("token", pwrv.tokenHashRequired(pwr))); err != nil {
+		return nil, goafweb.Invalid(err)
 	}
-	return pwrv.PwResetDB.GetByToken(pwr.TokenHash)
+	err := lookupHashes(pwrv.hmac, pwr.Token, func(hash string) (err error) {
+		pwr, err = pwrv.PwResetDB.GetByToken(ctx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pwr, nil
 }
 
-func (pwrv *pwResetValidator) Create(pwr *goafweb.PwReset) error {
+func (pwrv *pwResetValidator) Create(ctx context.Context, pwr *goafweb.PwReset) error {
 	token, err := rand.RememberToken()
 	if err != nil {
 		return fmt.Errorf("Unable to create reset token: %w", err)
 	}
 	pwr.Token = token
-	if err := runPWResetValFuncs(pwr, pwrv.idRequired, pwrv.tokenHashRequired); err != nil {
-		return fmt.Errorf("Validation Error: %w", err)
+	if err := runValFuncs(field("user_id", pwrv.idRequired(pwr)), field("token", pwrv.tokenHashRequired(pwr))); err != nil {
+		return goafweb.Invalid(err)
 	}
-	return pwrv.PwResetDB.Create(pwr)
+	return pwrv.PwResetDB.Create(ctx, pwr)
 }
 
-func (pwrv *pwResetValidator) Delete(id int) error {
+func (pwrv *pwResetValidator) Delete(ctx context.Context, id int) error {
 	if id <= 0 {
-		return errors.New("Invalid ID")
+		return invalid("id", "Invalid ID")
 	}
-	return pwrv.PwResetDB.Delete(id)
+	return pwrv.PwResetDB.Delete(ctx, id)
 }
 
-// pwResetValFunc is a uniform type for all validation functions on a pwReset.
-// All validation functions will be of this type so they can be used as variadic
-// arguments in other functions.
-// These funtions will return a customized error message if the validation fails,
-// or nil if everything is okay.
-type pwResetValFunc func(pwr *goafweb.PwReset) error
+func (pwrv *pwResetValidator) DeleteByUser(ctx context.Context, userID int) error {
+	if userID <= 0 {
+		return invalid("user_id", "Invalid ID")
+	}
+	return pwrv.PwResetDB.DeleteByUser(ctx, userID)
+}
 
-func runPWResetValFuncs(pwr *goafweb.PwReset, fns ...pwResetValFunc) error {
-	for _, fn := range fns {
-		if err := fn(pwr); err != nil {
-			return err
-		}
+func (pwrv *pwResetValidator) DeleteExpired(ctx context.Context, cutoff time.Time) (int, error) {
+	if cutoff.IsZero() {
+		return 0, invalid("cutoff", "Cutoff is required")
 	}
-	return nil
+	return pwrv.PwResetDB.DeleteExpired(ctx, cutoff)
 }
 
-func (pwrv *pwResetValidator) idRequired(pwr *goafweb.PwReset) error {
-	if pwr.UserID <= 0 {
-		return errors.New("ID Invalid")
+func (pwrv *pwResetValidator) idRequired(pwr *goafweb.PwReset) valFunc {
+	return func() error {
+		if pwr.UserID <= 0 {
+			return errors.New("ID Invalid")
+		}
+		return nil
 	}
-	return nil
 }
 
-func (pwrv *pwResetValidator) tokenHashRequired(pwr *goafweb.PwReset) error {
-	if pwr.TokenHash == "" {
-		if pwr.Token != "" {
-			pwr.TokenHash = pwrv.hmac.Hash(pwr.Token)
-			return nil
+func (pwrv *pwResetValidator) tokenHashRequired(pwr *goafweb.PwReset) valFunc {
+	return func() error {
+		if pwr.TokenHash == "" {
+			if pwr.Token != "" {
+				pwr.TokenHash = pwrv.hmac.Hash(pwr.Token)
+				return nil
+			}
+			return errors.New("Remember Hash is required")
 		}
-		return errors.New("Remember Hash is required")
+		return nil
 	}
-	return nil
 }
@@ -0,0 +1,85 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/hash"
+)
+
+// recoveryCodeValidator will be responsible for validation/normalizing a RecoveryCode ready for
+// database storage/retreival.
+type recoveryCodeValidator struct {
+	goafweb.RecoveryCodeDB
+	hmac hash.HMAC
+}
+
+// NewRecoveryCodeValidator creates a new recoveryCodeValidator.
+// It must receive something that satisfies the RecoveryCodeDB interface to satisfy
+// the next layer of the interface. As well as any other arguments required for
+// validation.
+func NewRecoveryCodeValidator(rcDB goafweb.RecoveryCodeDB, hmac hash.HMAC) *recoveryCodeValidator {
+	return &recoveryCodeValidator{
+		RecoveryCodeDB: rcDB,
+		hmac:           hmac,
+	}
+}
+
+func (rcv *recoveryCodeValidator) GetByCode(ctx context.Context, userID int, code string) (*goafweb.RecoveryCode, error) {
+	rc := &goafweb.RecoveryCode{UserID: userID, Code: code}
+	if err := runValFuncs(field("user_id", rcv.idRequired(rc)), field("code", rcv.codeHashRequired(rc))); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	err := lookupHashes(rcv.hmac, rc.Code, func(hash string) (err error) {
+		rc, err = rcv.RecoveryCodeDB.GetByCode(ctx, userID, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Create stores the hash of the code, the code itself is never stored.
+func (rcv *recoveryCodeValidator) Create(ctx context.Context, rc *goafweb.RecoveryCode) error {
+	if err := runValFuncs(field("user_id", rcv.idRequired(rc)), field("code", rcv.codeHashRequired(rc))); err != nil {
+		return goafweb.Invalid(err)
+	}
+	return rcv.RecoveryCodeDB.Create(ctx, rc)
+}
+
+func (rcv *recoveryCodeValidator) Use(ctx context.Context, rc *goafweb.RecoveryCode) error {
+	if rc.ID <= 0 {
+		return invalid("id", "Invalid ID")
+	}
+	return rcv.RecoveryCodeDB.Use(ctx, rc)
+}
+
+func (rcv *recoveryCodeValidator) DeleteByUser(ctx context.Context, userID int) error {
+	if userID <= 0 {
+		return invalid("user_id", "Invalid ID")
+	}
+	return rcv.RecoveryCodeDB.DeleteByUser(ctx, userID)
+}
+
+func (rcv *recoveryCodeValidator) idRequired(rc *goafweb.RecoveryCode) valFunc {
+	return func() error {
+		if rc.UserID <= 0 {
+			return errors.New("ID Invalid")
+		}
+		return nil
+	}
+}
+
+func (rcv *recoveryCodeValidator) codeHashRequired(rc *goafweb.RecoveryCode) valFunc {
+	return func() error {
+		if rc.CodeHash == "" {
+			if rc.Code != "" {
+				rc.CodeHash = rcv.hmac.Hash(rc.Code)
+				return nil
+			}
+			return errors.New("Code is required")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"goafweb"
+)
+
+// roleValidator will be responsible for validation of the roles granted to a User
+// before they are stored/retreived.
+type roleValidator struct {
+	goafweb.RoleDB
+}
+
+// NewRoleValidator creates a new roleValidator.
+// It must receive something that satisfies the RoleDB interface to satisfy
+// the next layer of the interface.
+func NewRoleValidator(roleDB goafweb.RoleDB) *roleValidator {
+	return &roleValidator{
+		RoleDB: roleDB,
+	}
+}
+
+func (rv *roleValidator) ByUser(ctx context.Context, userID int) ([]string, error) {
+	if userID <= 0 {
+		return nil, invalid("user_id", "Invalid ID")
+	}
+	return rv.RoleDB.ByUser(ctx, userID)
+}
+
+func (rv *roleValidator) Grant(ctx context.Context, userID int, role string) error {
+	if err := rv.validate(userID, role); err != nil {
+		return goafweb.Invalid(err)
+	}
+	return rv.RoleDB.Grant(ctx, userID, role)
+}
+
+func (rv *roleValidator) Revoke(ctx context.Context, userID int, role string) error {
+	if err := rv.validate(userID, role); err != nil {
+		return goafweb.Invalid(err)
+	}
+	return rv.RoleDB.Revoke(ctx, userID, role)
+}
+
+// validate checks the ID is valid and the role is one the app knows about.
+func (rv *roleValidator) validate(userID int, role string) error {
+	errs := fieldErrors{}
+	if userID <= 0 {
+		errs["user_id"] = "Invalid ID"
+	}
+	if _, ok := goafweb.RolePermissions[role]; !ok {
+		errs["role"] = fmt.Sprintf("Unknown role %q", role)
+	}
+	return errs.err()
+}
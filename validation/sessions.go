@@ -0,0 +1,168 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goafweb"
+	"goafweb/hash"
+	"goafweb/rand"
+)
+
+// sessionValidator will be responsible for validation/normalizing a Session ready for
+// database storage/retreival.
+type sessionValidator struct {
+	goafweb.SessionDB
+	hmac hash.HMAC
+}
+
+// NewSessionValidator creates a new sessionValidator.
+// It must receive something that satisfies the SessionDB interface to satisfy
+// the next layer of the interface. As well as any other arguments required for
+// validation.
+func NewSessionValidator(sessionDB goafweb.SessionDB, hmac hash.HMAC) *sessionValidator {
+	return &sessionValidator{
+		SessionDB: sessionDB,
+		hmac:      hmac,
+	}
+}
+
+// GetByToken looks the Session up by the hash of token.
+// If the token was hashed with a retired key it is rehashed with the current key.
+func (sv *sessionValidator) GetByToken(ctx context.Context, token string) (*goafweb.Session, error) {
+	session := &goafweb.Session{Token: token}
+	if err := runValFuncs(field("token", sv.tokenHashRequired(session))); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	err := lookupHashes(sv.hmac, token, func(hash string) (err error) {
+		session, err = sv.SessionDB.GetByToken(ctx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !sv.hmac.IsCurrent(session.TokenHash) {
+		session.TokenHash = sv.hmac.Hash(token)
+		if err := sv.SessionDB.Touch(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+func (sv *sessionValidator) GetByRotatedToken(ctx context.Context, token string) (*goafweb.Session, error) {
+	session := &goafweb.Session{Token: token}
+	if err := runValFuncs(field("token", sv.tokenHashRequired(session))); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	err := lookupHashes(sv.hmac, token, func(hash string) (err error) {
+		session, err = sv.SessionDB.GetByRotatedToken(ctx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (sv *sessionValidator) ByUser(ctx context.Context, userID int) ([]*goafweb.Session, error) {
+	if userID <= 0 {
+		return nil, invalid("user_id", "Invalid ID")
+	}
+	return sv.SessionDB.ByUser(ctx, userID)
+}
+
+// Create generates a new Token for the Session, only the hash is stored.
+func (sv *sessionValidator) Create(ctx context.Context, session *goafweb.Session) error {
+	token, err := rand.RememberToken()
+	if err != nil {
+		return fmt.Errorf("Unable to create session token: %w", err)
+	}
+	session.Token = token
+	if err := runValFuncs(
+		field("user_id", sv.userIDRequired(session)),
+		field("token", sv.tokenHashRequired(session)),
+		field("expires_at", sv.expiryRequired(session)),
+	); err != nil {
+		return goafweb.Invalid(err)
+	}
+	return sv.SessionDB.Create(ctx, session)
+}
+
+func (sv *sessionValidator) Touch(ctx context.Context, session *goafweb.Session) error {
+	if session.ID <= 0 {
+		return invalid("id", "Invalid ID")
+	}
+	if session.TokenHash == "" {
+		return invalid("token", "Token is required")
+	}
+	return sv.SessionDB.Touch(ctx, session)
+}
+
+// Rotate generates a new Token for the Session to replace oldToken.
+// The stored hash of oldToken is used if the Session has it, as it may have been made with a retired key.
+func (sv *sessionValidator) Rotate(ctx context.Context, oldToken string, session *goafweb.Session) error {
+	if session.ID <= 0 || oldToken == "" {
+		return invalid("session", "Invalid session")
+	}
+	oldTokenHash := session.TokenHash
+	if oldTokenHash == "" {
+		oldTokenHash = sv.hmac.Hash(oldToken)
+	}
+	token, err := rand.RememberToken()
+	if err != nil {
+		return fmt.Errorf("Unable to create session token: %w", err)
+	}
+	session.Token = token
+	session.TokenHash = ""
+	if err := runValFuncs(field("token", sv.tokenHashRequired(session))); err != nil {
+		return goafweb.Invalid(err)
+	}
+	return sv.SessionDB.Rotate(ctx, oldTokenHash, session)
+}
+
+func (sv *sessionValidator) Delete(ctx context.Context, id int) error {
+	if id <= 0 {
+		return invalid("id", "Invalid ID")
+	}
+	return sv.SessionDB.Delete(ctx, id)
+}
+
+func (sv *sessionValidator) DeleteByUser(ctx context.Context, userID int) error {
+	if userID <= 0 {
+		return invalid("user_id", "Invalid ID")
+	}
+	return sv.SessionDB.DeleteByUser(ctx, userID)
+}
+
+func (sv *sessionValidator) userIDRequired(session *goafweb.Session) valFunc {
+	return func() error {
+		if session.UserID <= 0 {
+			return errors.New("ID Invalid")
+		}
+		return nil
+	}
+}
+
+func (sv *sessionValidator) expiryRequired(session *goafweb.Session) valFunc {
+	return func() error {
+		if session.ExpiresAt.IsZero() {
+			return errors.New("Expiry is required")
+		}
+		return nil
+	}
+}
+
+// tokenHashRequired will set the TokenHash from the Token if it is not already set.
+func (sv *sessionValidator) tokenHashRequired(session *goafweb.Session) valFunc {
+	return func() error {
+		if session.TokenHash == "" {
+			if session.Token != "" {
+				session.TokenHash = sv.hmac.Hash(session.Token)
+				return nil
+			}
+			return errors.New("Token is required")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"context"
+	"goafweb"
+	"time"
+)
+
+// throttleValidator will be responsible for validation of a Throttle before it is stored/retreived.
+type throttleValidator struct {
+	goafweb.ThrottleDB
+}
+
+// NewThrottleValidator creates a new throttleValidator.
+// It must receive something that satisfies the ThrottleDB interface to satisfy
+// the next layer of the interface.
+func NewThrottleValidator(throttleDB goafweb.ThrottleDB) *throttleValidator {
+	return &throttleValidator{
+		ThrottleDB: throttleDB,
+	}
+}
+
+func (tv *throttleValidator) Get(ctx context.Context, key string) (*goafweb.Throttle, error) {
+	if key == "" {
+		return nil, invalid("key", "Key is required")
+	}
+	return tv.ThrottleDB.Get(ctx, key)
+}
+
+func (tv *throttleValidator) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*goafweb.Throttle, error) {
+	if key == "" {
+		return nil, invalid("key", "Key is required")
+	}
+	return tv.ThrottleDB.Increment(ctx, key, now, window)
+}
+
+func (tv *throttleValidator) Lock(ctx context.Context, key string, until time.Time) error {
+	if key == "" {
+		return invalid("key", "Key is required")
+	}
+	return tv.ThrottleDB.Lock(ctx, key, until)
+}
+
+func (tv *throttleValidator) Delete(ctx context.Context, key string) error {
+	if key == "" {
+		return invalid("key", "Key is required")
+	}
+	return tv.ThrottleDB.Delete(ctx, key)
+}
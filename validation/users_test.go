@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"goafweb/hash"
+	"goafweb/password"
+	"goafweb/storage/memory"
+	"reflect"
+	"testing"
+)
+
+func TestUserValidationErrors(t *testing.T) {
+	ctx := context.Background()
+	uv := NewUserValidator(memory.NewUserDB(memory.NewDB()), hash.NewBcryptHasher(4), password.DefaultPolicy())
+	if err := uv.Create(ctx, &goafweb.User{Email: "taken@example.com", Password: "correct-Horse-battery"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := map[string]struct {
+		user *goafweb.User
+		want goafweb.ValidationErrors
+	}{
+		"Every field": {
+			user: &goafweb.User{Email: "", Password: "short"},
+			want: goafweb.ValidationErrors{"email": "Email address is required", "password": "Password must be at least 8 characters"},
+		},
+		"First failure per field": {
+			user: &goafweb.User{Email: "not an email"},
+			want: goafweb.ValidationErrors{"email": "Email is not a valid format", "password": "Password is required"},
+		},
+		"Email taken": {
+			user: &goafweb.User{Email: " Taken@example.com", Password: "correct-Horse-battery"},
+			want: goafweb.ValidationErrors{"email": "That email address is already taken"},
+		},
+		"Password policy": {
+			user: &goafweb.User{Name: "Jo Bloggs", Email: "jo@example.com", Password: "aaaaaaaabloggs"},
+			want: goafweb.ValidationErrors{"password": "Password is too easy to guess, make it longer or mix in upper case letters, numbers and symbols, " +
+				"Password must not contain your name or email address"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := uv.Create(ctx, tc.user)
+			if !errors.Is(err, goafweb.ErrInvalid) {
+				t.Fatalf("got %v, wanted a validation error", err)
+			}
+			var got goafweb.ValidationErrors
+			if !errors.As(err, &got) || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, wanted %v", got, tc.want)
+			}
+		})
+	}
+}
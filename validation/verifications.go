@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goafweb"
+	"goafweb/hash"
+	"goafweb/rand"
+)
+
+// emailVerificationValidator will be responsible for validation/normalizing an EmailVerification
+// ready for database storage/retreival.
+type emailVerificationValidator struct {
+	goafweb.EmailVerificationDB
+	hmac hash.HMAC
+}
+
+// NewEmailVerificationValidator creates a new emailVerificationValidator.
+// It must receive something that satisfies the EmailVerificationDB interface to satisfy
+// the next layer of the interface. As well as any other arguments required for
+// validation.
+func NewEmailVerificationValidator(evDB goafweb.EmailVerificationDB, hmac hash.HMAC) *emailVerificationValidator {
+	return &emailVerificationValidator{
+		EmailVerificationDB: evDB,
+		hmac:                hmac,
+	}
+}
+
+func (evv *emailVerificationValidator) GetByToken(ctx context.Context, token string) (*goafweb.EmailVerification, error) {
+	ev := &goafweb.EmailVerification{Token: token}
+	if err := runValFuncs(field("token", evv.tokenHashRequired(ev))); err != nil {
+		return nil, goafweb.Invalid(err)
+	}
+	err := lookupHashes(evv.hmac, ev.Token, func(hash string) (err error) {
+		ev, err = evv.EmailVerificationDB.GetByToken(ctx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+func (evv *emailVerificationValidator) LatestByUser(ctx context.Context, userID int) (*goafweb.EmailVerification, error) {
+	if userID <= 0 {
+		return nil, invalid("user_id", "Invalid ID")
+	}
+	return evv.EmailVerificationDB.LatestByUser(ctx, userID)
+}
+
+func (evv *emailVerificationValidator) Create(ctx context.Context, ev *goafweb.EmailVerification) error {
+	token, err := rand.RememberToken()
+	if err != nil {
+		return fmt.Errorf("Unable to create verification token: %w", err)
+	}
+	ev.Token = token
+	if err := runValFuncs(field("user_id", evv.idRequired(ev)), field("token", evv.tokenHashRequired(ev))); err != nil {
+		return goafweb.Invalid(err)
+	}
+	return evv.EmailVerificationDB.Create(ctx, ev)
+}
+
+func (evv *emailVerificationValidator) DeleteByUser(ctx context.Context, userID int) error {
+	if userID <= 0 {
+		return invalid("user_id", "Invalid ID")
+	}
+	return evv.EmailVerificationDB.DeleteByUser(ctx, userID)
+}
+
+func (evv *emailVerificationValidator) idRequired(ev *goafweb.EmailVerification) valFunc {
+	return func() error {
+		if ev.UserID <= 0 {
+			return errors.New("ID Invalid")
+		}
+		return nil
+	}
+}
+
+func (evv *emailVerificationValidator) tokenHashRequired(ev *goafweb.EmailVerification) valFunc {
+	return func() error {
+		if ev.TokenHash == "" {
+			if ev.Token != "" {
+				ev.TokenHash = evv.hmac.Hash(ev.Token)
+				return nil
+			}
+			return errors.New("Token is required")
+		}
+		return nil
+	}
+}
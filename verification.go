@@ -0,0 +1,95 @@
+package goafweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// verificationTTL is how long a User has to follow their verification link.
+	verificationTTL = 48 * time.Hour
+	// verificationResendInterval is the least time allowed between verification emails to the same User.
+	verificationResendInterval = 5 * time.Minute
+)
+
+// InitiateVerification creates a token the User can use to verify their email address and emails it to them.
+// Any earlier tokens stay valid until they expire or the address is verified.
+// Returns a RetryError if a token was issued too recently, so the endpoint can't be used to spam the User.
+func (us *userService) InitiateVerification(ctx context.Context, userID int) (string, error) {
+	user, err := us.GetByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("Could not retreive user: %w", err)
+	}
+	if user.Verified() {
+		return "", ErrAlreadyVerified
+	}
+	latest, err := us.verifyDB.LatestByUser(ctx, user.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("Could not retreive verification: %w", err)
+	}
+	if err == nil {
+		if wait := verificationResendInterval - us.now().Sub(latest.CreatedAt); wait > 0 {
+			return "", &RetryError{Err: ErrRateLimited, RetryAfter: wait}
+		}
+	}
+	var token string
+	err = us.inTx(ctx, func(ctx context.Context) error {
+		token, err = us.newVerification(ctx, user)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// newVerification creates a verification token for the User, emails it to them and returns it.
+// It should be called in a transaction so the token isn't saved if the email can't be.
+func (us *userService) newVerification(ctx context.Context, user *User) (string, error) {
+	ev := EmailVerification{
+		UserID: user.ID,
+	}
+	if err := us.verifyDB.Create(ctx, &ev); err != nil {
+		return "", fmt.Errorf("Unable to create verification token: %w", err)
+	}
+	if us.mail != nil {
+		if err := us.mail.VerifyEmail(ctx, user.Email, ev.Token); err != nil {
+			return "", fmt.Errorf("Could not send verification email: %w", err)
+		}
+	}
+	return ev.Token, nil
+}
+
+// CompleteVerification validates the token provided by the User and marks their email address as verified.
+// Tokens are single use, all of the Users tokens are removed once one has been used.
+// Tokens valid for 48 hours.
+func (us *userService) CompleteVerification(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := us.inTx(ctx, func(ctx context.Context) error {
+		ev, err := us.verifyDB.GetByToken(ctx, token)
+		if err != nil {
+			return fmt.Errorf("Unable to retreive verification data: %w", err)
+		}
+		if us.now().Sub(ev.CreatedAt) > verificationTTL {
+			return ErrTokenExpired
+		}
+		if user, err = us.GetByID(ctx, ev.UserID); err != nil {
+			return fmt.Errorf("Unable to verify email: %w", err)
+		}
+		now := us.now()
+		user.EmailVerifiedAt = &now
+		if err := us.Update(ctx, user); err != nil {
+			return fmt.Errorf("Unable to verify email: %w", err)
+		}
+		if err := us.verifyDB.DeleteByUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("Unable to remove verification tokens: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,73 @@
+package goafweb_test
+
+import (
+	"context"
+	"errors"
+	"goafweb"
+	"testing"
+	"time"
+)
+
+func TestVerificationResend(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user, first := us.signUp(t, "test@test.com")
+
+	_, err := us.InitiateVerification(ctx, user.ID)
+	var retry *goafweb.RetryError
+	if !errors.Is(err, goafweb.ErrRateLimited) || !errors.As(err, &retry) || retry.RetryAfter <= 0 {
+		t.Fatalf("Resending straight away: got %v, wanted a RetryError", err)
+	}
+	us.clock.Add(goafweb.VerificationResend + time.Second)
+	second, err := us.InitiateVerification(ctx, user.ID)
+	if err != nil || second == "" || second == first {
+		t.Fatalf("Resending after the interval: got %q, %v, wanted a new token", second, err)
+	}
+	// The earlier email still works.
+	if _, err := us.CompleteVerification(ctx, first); err != nil {
+		t.Errorf("CompleteVerification with the first token: %v", err)
+	}
+	if _, err := us.InitiateVerification(ctx, user.ID); !errors.Is(err, goafweb.ErrAlreadyVerified) {
+		t.Errorf("Resending once verified: got %v, wanted %v", err, goafweb.ErrAlreadyVerified)
+	}
+}
+
+func TestVerificationExpiry(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user, token := us.signUp(t, "test@test.com")
+
+	us.clock.Add(goafweb.VerificationTTL + time.Second)
+	if _, err := us.CompleteVerification(ctx, token); !errors.Is(err, goafweb.ErrTokenExpired) {
+		t.Errorf("Got %v, wanted %v", err, goafweb.ErrTokenExpired)
+	}
+	if got, err := us.GetByID(ctx, user.ID); err != nil || got.Verified() {
+		t.Errorf("Expired token verified the user: %+v, %v", got, err)
+	}
+}
+
+func TestVerificationSingleUse(t *testing.T) {
+	ctx := context.Background()
+	us := newTestUserService(t)
+	user, first := us.signUp(t, "test@test.com")
+	_, other := us.signUp(t, "other@test.com")
+	us.clock.Add(goafweb.VerificationResend + time.Second)
+	second, err := us.InitiateVerification(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("InitiateVerification: %v", err)
+	}
+
+	verified, err := us.CompleteVerification(ctx, second)
+	if err != nil || !verified.Verified() || !verified.EmailVerifiedAt.Equal(us.clock.Now()) {
+		t.Fatalf("CompleteVerification: got %+v, %v", verified, err)
+	}
+	// Using a token removes every token the user has, but nobody else's.
+	for _, token := range []string{second, first} {
+		if _, err := us.CompleteVerification(ctx, token); !errors.Is(err, goafweb.ErrNotFound) {
+			t.Errorf("Reusing a verification token: got %v, wanted %v", err, goafweb.ErrNotFound)
+		}
+	}
+	if _, err := us.CompleteVerification(ctx, other); err != nil {
+		t.Errorf("CompleteVerification for another user: %v", err)
+	}
+}